@@ -0,0 +1,168 @@
+package evidence
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+
+	"github.com/tendermint/tendermint/types"
+)
+
+// PendingAccusedValidators returns the distinct addresses of all validators
+// implicated by pending evidence, sorted in ascending order. For duplicate vote
+// evidence this is the validator that signed the votes and for light client
+// attack evidence these are all its byzantine validators.
+func (evpool *Pool) PendingAccusedValidators() ([][]byte, error) {
+	return evpool.accused.List(), nil
+}
+
+// HasEvidenceAgainst returns true if pending evidence implicates the validator
+// with the given address, as defined by PendingAccusedValidators. The pool
+// keeps an index of the implicated validators as evidence enters and leaves the
+// pending pool, so this is a map lookup rather than a scan of the evidence.
+func (evpool *Pool) HasEvidenceAgainst(addr []byte) (bool, error) {
+	return evpool.accused.Has(addr), nil
+}
+
+// SetPriorityValidators sets the validators whose evidence PendingEvidence and
+// related methods return first when not all evidence fits. It replaces the
+// previous set and a nil or empty set restores the default order.
+func (evpool *Pool) SetPriorityValidators(addrs [][]byte) {
+	var priority map[string]struct{}
+	if len(addrs) > 0 {
+		priority = make(map[string]struct{}, len(addrs))
+		for _, addr := range addrs {
+			priority[string(addr)] = struct{}{}
+		}
+	}
+
+	evpool.priorityMtx.Lock()
+	defer evpool.priorityMtx.Unlock()
+	evpool.priorityValidators = priority
+}
+
+// priorityValidatorSet returns the set of validators set with
+// SetPriorityValidators, which must not be modified.
+func (evpool *Pool) priorityValidatorSet() map[string]struct{} {
+	evpool.priorityMtx.Lock()
+	defer evpool.priorityMtx.Unlock()
+	return evpool.priorityValidators
+}
+
+// implicatesAny returns true if the evidence implicates any of the validators
+// in the set.
+func implicatesAny(ev types.Evidence, set map[string]struct{}) bool {
+	if len(set) == 0 {
+		return false
+	}
+	for _, addr := range accusedAddresses(ev) {
+		if _, ok := set[string(addr)]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// accusedSet keeps a reference count for every validator address implicated
+// by pending evidence, so that an address is only dropped once the last
+// evidence implicating it leaves the pending pool. The zero value is an empty
+// set.
+type accusedSet struct {
+	mtx    sync.Mutex
+	counts map[string]int
+}
+
+// Add references the addresses implicated by the evidence.
+func (set *accusedSet) Add(ev types.Evidence) {
+	set.mtx.Lock()
+	defer set.mtx.Unlock()
+	set.add(ev)
+}
+
+// Remove drops a reference to each of the addresses implicated by the
+// evidence.
+func (set *accusedSet) Remove(ev types.Evidence) {
+	set.mtx.Lock()
+	defer set.mtx.Unlock()
+
+	for _, addr := range accusedAddresses(ev) {
+		key := string(addr)
+		if set.counts[key] <= 1 {
+			delete(set.counts, key)
+		} else {
+			set.counts[key]--
+		}
+	}
+}
+
+// Reset replaces the contents of the set with the addresses implicated by the
+// given evidence.
+func (set *accusedSet) Reset(evList []types.Evidence) {
+	set.mtx.Lock()
+	defer set.mtx.Unlock()
+
+	set.counts = make(map[string]int)
+	for _, ev := range evList {
+		set.add(ev)
+	}
+}
+
+// Has returns true if the address is in the set.
+func (set *accusedSet) Has(addr []byte) bool {
+	set.mtx.Lock()
+	defer set.mtx.Unlock()
+
+	_, ok := set.counts[string(addr)]
+	return ok
+}
+
+// List returns the addresses in the set in ascending order.
+func (set *accusedSet) List() [][]byte {
+	set.mtx.Lock()
+	defer set.mtx.Unlock()
+
+	addrs := make([][]byte, 0, len(set.counts))
+	for addr := range set.counts {
+		addrs = append(addrs, []byte(addr))
+	}
+	sort.Slice(addrs, func(i, j int) bool { return bytes.Compare(addrs[i], addrs[j]) < 0 })
+	return addrs
+}
+
+func (set *accusedSet) add(ev types.Evidence) {
+	if set.counts == nil {
+		set.counts = make(map[string]int)
+	}
+	for _, addr := range accusedAddresses(ev) {
+		set.counts[string(addr)]++
+	}
+}
+
+// accusedAddresses returns the distinct addresses of the validators implicated
+// by the evidence.
+func accusedAddresses(ev types.Evidence) [][]byte {
+	switch ev := ev.(type) {
+	case *types.DuplicateVoteEvidence:
+		if ev.VoteA == nil {
+			return nil
+		}
+		return [][]byte{ev.VoteA.ValidatorAddress}
+
+	case *types.LightClientAttackEvidence:
+		var (
+			addrs = make([][]byte, 0, len(ev.ByzantineValidators))
+			seen  = make(map[string]struct{}, len(ev.ByzantineValidators))
+		)
+		for _, val := range ev.ByzantineValidators {
+			if _, ok := seen[string(val.Address)]; ok {
+				continue
+			}
+			seen[string(val.Address)] = struct{}{}
+			addrs = append(addrs, val.Address)
+		}
+		return addrs
+
+	default:
+		return nil
+	}
+}
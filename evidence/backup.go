@@ -0,0 +1,262 @@
+package evidence
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/google/orderedcode"
+	dbm "github.com/tendermint/tm-db"
+
+	tmproto "github.com/tendermint/tendermint/proto/tendermint/types"
+	"github.com/tendermint/tendermint/types"
+)
+
+const (
+	// backupProgressInterval is the number of entries after which the progress
+	// callback of Export and Import is called.
+	backupProgressInterval = 10000
+
+	// importBatchSize is the number of entries Import writes to the store at a
+	// time.
+	importBatchSize = 1000
+
+	// maxBackupEntrySize bounds the length of a single key or value read by
+	// Import so that a corrupt backup can't cause huge allocations.
+	maxBackupEntrySize = types.MaxBlockSizeBytes
+)
+
+// Export writes every entry stored under the evidence pool's prefixes to w, so
+// that it can later be restored with Import. Entries are streamed one at a time
+// as a uvarint length prefixed key followed by a uvarint length prefixed value,
+// so memory use does not grow with the size of the pool. If progress is not
+// nil, it is called with the number of entries written so far every
+// backupProgressInterval entries and once more when the export is complete.
+//
+// Evidence added or removed while the export is running may or may not be
+// included.
+func (evpool *Pool) Export(w io.Writer, progress func(entries int)) error {
+	var (
+		bw      = bufio.NewWriter(w)
+		buf     = make([]byte, binary.MaxVarintLen64)
+		entries int
+	)
+
+	writeField := func(bz []byte) error {
+		n := binary.PutUvarint(buf, uint64(len(bz)))
+		if _, err := bw.Write(buf[:n]); err != nil {
+			return err
+		}
+		_, err := bw.Write(bz)
+		return err
+	}
+
+	for _, prefix := range poolPrefixes {
+		iter, err := dbm.IteratePrefix(evpool.evidenceStore, prefixToBytes(prefix))
+		if err != nil {
+			return fmt.Errorf("database error: %v", err)
+		}
+
+		for ; iter.Valid(); iter.Next() {
+			if err := writeField(iter.Key()); err != nil {
+				iter.Close()
+				return fmt.Errorf("failed to export evidence: %w", err)
+			}
+			if err := writeField(iter.Value()); err != nil {
+				iter.Close()
+				return fmt.Errorf("failed to export evidence: %w", err)
+			}
+
+			entries++
+			if progress != nil && entries%backupProgressInterval == 0 {
+				progress(entries)
+			}
+		}
+
+		err = iter.Error()
+		iter.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to export evidence: %w", err)
+	}
+	if progress != nil {
+		progress(entries)
+	}
+
+	return nil
+}
+
+// Import reads entries written by Export from r and stores them, overwriting
+// entries with the same key. The backup is read and written in batches, so
+// memory use does not grow with its size. Once all entries are stored, expired
+// pending evidence is pruned and the remaining pending evidence is loaded into
+// the pool. progress is called like it is for Export. Import is intended to
+// restore a backup into an empty pool and must not be called concurrently
+// with other pool operations.
+func (evpool *Pool) Import(r io.Reader, progress func(entries int)) error {
+	if evpool.readOnly {
+		return ErrReadOnly
+	}
+
+	var (
+		br      = bufio.NewReader(r)
+		batch   = evpool.evidenceStore.NewBatch()
+		entries int
+	)
+	defer func() { batch.Close() }()
+
+	readField := func() ([]byte, error) {
+		n, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		if n > maxBackupEntrySize {
+			return nil, fmt.Errorf("entry of %d bytes exceeds the maximum of %d bytes", n, maxBackupEntrySize)
+		}
+		bz := make([]byte, n)
+		if _, err := io.ReadFull(br, bz); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		return bz, nil
+	}
+
+	for {
+		key, err := readField()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read key of entry %d: %w", entries, err)
+		}
+		value, err := readField()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return fmt.Errorf("failed to read value of entry %d: %w", entries, err)
+		}
+
+		if !isPoolKey(key) {
+			return fmt.Errorf("entry %d has key %X which is not under a prefix of the evidence pool", entries, key)
+		}
+
+		if err := batch.Set(key, value); err != nil {
+			return err
+		}
+
+		entries++
+		if entries%importBatchSize == 0 {
+			if err := batch.WriteSync(); err != nil {
+				return fmt.Errorf("failed to import evidence: %w", err)
+			}
+			batch.Close()
+			batch = evpool.evidenceStore.NewBatch()
+		}
+		if progress != nil && entries%backupProgressInterval == 0 {
+			progress(entries)
+		}
+	}
+
+	if err := batch.WriteSync(); err != nil {
+		return fmt.Errorf("failed to import evidence: %w", err)
+	}
+
+	evpool.valSetCache.Reset()
+	if err := evpool.loadPendingEvidence(); err != nil {
+		return err
+	}
+	if err := evpool.countQuarantined(); err != nil {
+		return err
+	}
+	if progress != nil {
+		progress(entries)
+	}
+
+	return nil
+}
+
+// ExportPending returns the pending evidence of the pool, oldest first, as a
+// serialized tmproto.EvidenceList that another node can add to its pool with
+// ImportPending. Unlike Export, it carries only the evidence itself, so the
+// importing node verifies it against its own state.
+func (evpool *Pool) ExportPending() ([]byte, error) {
+	iter, err := dbm.IteratePrefix(evpool.evidenceStore, prefixToBytes(prefixPending))
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer iter.Close()
+
+	var evList tmproto.EvidenceList
+	for ; iter.Valid(); iter.Next() {
+		evpb, ev, err := evpool.decodeListedEvidence(iter.Key(), iter.Value())
+		if err != nil {
+			return nil, err
+		}
+		if ev == nil {
+			continue
+		}
+		evList.Evidence = append(evList.Evidence, evpb)
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+
+	return evList.Marshal()
+}
+
+// ImportPending adds the evidence exported by ExportPending to the pool with
+// AddEvidence. Invalid, stale and known evidence is skipped, while any other
+// error stops the import and is returned.
+func (evpool *Pool) ImportPending(data []byte) error {
+	if evpool.readOnly {
+		return ErrReadOnly
+	}
+
+	var evList tmproto.EvidenceList
+	if err := evList.Unmarshal(data); err != nil {
+		return fmt.Errorf("failed to unmarshal evidence list: %w", err)
+	}
+
+	for i := range evList.Evidence {
+		ev, err := types.EvidenceFromProto(&evList.Evidence[i])
+		if err != nil {
+			evpool.logger.Info("dropping imported evidence that failed to decode", "err", err)
+			continue
+		}
+
+		err = evpool.AddEvidence(ev)
+		var invalidErr *types.ErrInvalidEvidence
+		switch {
+		case err == nil, errors.Is(err, ErrAlreadyCommitted):
+		case errors.As(err, &invalidErr), errors.Is(err, ErrStaleEvidence), errors.Is(err, ErrBelowRetainedHeight):
+			evpool.logger.Info("dropping imported evidence", append(evLogFields(ev), "err", err)...)
+		default:
+			return fmt.Errorf("failed to import evidence: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// isPoolKey returns true if the key starts with one of the pool's prefixes.
+func isPoolKey(key []byte) bool {
+	var prefix int64
+	if _, err := orderedcode.Parse(string(key), &prefix); err != nil {
+		return false
+	}
+	for _, p := range poolPrefixes {
+		if prefix == p {
+			return true
+		}
+	}
+	return false
+}
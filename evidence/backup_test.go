@@ -0,0 +1,211 @@
+package evidence_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/google/orderedcode"
+	"github.com/stretchr/testify/require"
+
+	dbm "github.com/tendermint/tm-db"
+
+	"github.com/tendermint/tendermint/evidence"
+	"github.com/tendermint/tendermint/types"
+)
+
+func TestExportImport(t *testing.T) {
+	var height int64 = 10
+	val := types.NewMockPV()
+	pool := newTestPool(t, height, val, dbm.NewMemDB(), evidence.WithCommittedEvidenceCopies(true))
+
+	committed := newTestDuplicateVoteEvidence(height-2, val)
+	require.NoError(t, pool.AddEvidence(committed))
+	for h := height; h > height-2; h-- {
+		require.NoError(t, pool.AddEvidence(newTestDuplicateVoteEvidence(h, val)))
+	}
+	state := pool.State()
+	state.LastBlockHeight++
+	pool.Update(state, types.EvidenceList{committed})
+
+	var (
+		backup   bytes.Buffer
+		progress []int
+	)
+	require.NoError(t, pool.Export(&backup, func(entries int) { progress = append(progress, entries) }))
+	// two pending evidence with info and hash index entries, one committed
+	// evidence with its copy and info, the record of its removal from the
+	// pending pool and the pruning point
+	require.Equal(t, []int{11}, progress)
+
+	restoredDB := dbm.NewMemDB()
+	restored := newTestPool(t, height, val, restoredDB)
+	progress = nil
+	require.NoError(t, restored.Import(bytes.NewReader(backup.Bytes()), func(entries int) {
+		progress = append(progress, entries)
+	}))
+	require.Equal(t, []int{11}, progress)
+
+	require.EqualValues(t, 2, restored.Size())
+	expected, _ := pool.PendingEvidence(-1)
+	evList, _ := restored.PendingEvidence(-1)
+	require.Equal(t, expected, evList)
+	require.Equal(t, expected[0], restored.EvidenceFront().Value.(types.Evidence))
+	require.Error(t, restored.CheckEvidence(types.EvidenceList{committed}))
+
+	var reexported bytes.Buffer
+	require.NoError(t, restored.Export(&reexported, nil))
+	require.Equal(t, backup.Bytes(), reexported.Bytes())
+
+	// truncated backups are rejected
+	require.Error(t, restored.Import(bytes.NewReader(backup.Bytes()[:backup.Len()-1]), nil))
+
+	// as are entries from other subsystems
+	var foreign bytes.Buffer
+	key, err := orderedcode.Append(nil, int64(1), "block")
+	require.NoError(t, err)
+	buf := make([]byte, binary.MaxVarintLen64)
+	for _, field := range [][]byte{key, []byte("value")} {
+		n := binary.PutUvarint(buf, uint64(len(field)))
+		foreign.Write(buf[:n])
+		foreign.Write(field)
+	}
+	require.Error(t, restored.Import(&foreign, nil))
+}
+
+func TestExportImportPending(t *testing.T) {
+	var height int64 = 10
+	val := types.NewMockPV()
+	pool := newTestPool(t, height, val, dbm.NewMemDB())
+	importer := newTestPool(t, height, val, dbm.NewMemDB())
+
+	var evList []types.Evidence
+	for h := height - 2; h <= height; h++ {
+		ev := newTestDuplicateVoteEvidence(h, val)
+		require.NoError(t, pool.AddEvidence(ev))
+		evList = append(evList, ev)
+	}
+	// evidence against a validator the importer doesn't know
+	invalid := newTestDuplicateVoteEvidence(height-1, types.NewMockPV())
+	require.NoError(t, pool.AddVerifiedEvidence(invalid))
+
+	data, err := pool.ExportPending()
+	require.NoError(t, err)
+
+	// evidence the importer already committed is ignored
+	require.NoError(t, importer.AddEvidence(evList[0]))
+	state := importer.State()
+	state.LastBlockHeight++
+	importer.Update(state, types.EvidenceList{evList[0]})
+
+	require.NoError(t, importer.ImportPending(data))
+	imported, _ := importer.PendingEvidence(-1)
+	require.ElementsMatch(t, evList[1:], imported)
+
+	// importing again changes nothing
+	require.NoError(t, importer.ImportPending(data))
+	require.EqualValues(t, 2, importer.Size())
+
+	// and an empty pool exports an empty list
+	data, err = newTestPool(t, height, val, dbm.NewMemDB()).ExportPending()
+	require.NoError(t, err)
+	require.NoError(t, importer.ImportPending(data))
+	require.EqualValues(t, 2, importer.Size())
+
+	require.Error(t, importer.ImportPending([]byte("not an evidence list")))
+}
+
+func TestExportImportBoundedMemory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping large export in short mode")
+	}
+
+	const (
+		numEntries = 200000
+		// far less than the size of the backup
+		maxHeapGrowth = 1 << 20
+	)
+
+	var height int64 = 10
+	val := types.NewMockPV()
+	evidenceDB := dbm.NewMemDB()
+
+	// committed markers, which accumulate over the lifetime of a node
+	batch := evidenceDB.NewBatch()
+	buf := make([]byte, binary.MaxVarintLen64)
+	for i := 0; i < numEntries; i++ {
+		hash := sha256.Sum256(buf[:binary.PutUvarint(buf, uint64(i))])
+		key, err := orderedcode.Append(nil, int64(8), int64(i+1), string(hash[:]))
+		require.NoError(t, err)
+		require.NoError(t, batch.Set(key, []byte{1}))
+	}
+	require.NoError(t, batch.WriteSync())
+	require.NoError(t, batch.Close())
+
+	pool := newTestPool(t, height, val, evidenceDB)
+
+	path := filepath.Join(t.TempDir(), "evidence.backup")
+	file, err := os.Create(path)
+	require.NoError(t, err)
+
+	var peak int64
+	sample := func(int) {
+		if heap := liveHeap(); heap > peak {
+			peak = heap
+		}
+	}
+
+	baseline := liveHeap()
+	require.NoError(t, pool.Export(file, sample))
+	require.NoError(t, file.Close())
+
+	stat, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Greater(t, stat.Size(), int64(4*maxHeapGrowth))
+	require.Less(t, peak-baseline, int64(maxHeapGrowth), "export used %d bytes", peak-baseline)
+
+	// import into a store that discards writes, so only the memory used by
+	// Import itself is measured
+	restored := newTestPool(t, height, val, discardDB{dbm.NewMemDB()})
+	file, err = os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var entries int
+	peak = 0
+	baseline = liveHeap()
+	require.NoError(t, restored.Import(file, func(n int) {
+		entries = n
+		sample(n)
+	}))
+	// the committed markers and the pruning point
+	require.Equal(t, numEntries+1, entries)
+	require.Less(t, peak-baseline, int64(maxHeapGrowth), "import used %d bytes", peak-baseline)
+}
+
+// liveHeap returns the size of the heap after a garbage collection.
+func liveHeap() int64 {
+	var stats runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&stats)
+	return int64(stats.HeapAlloc)
+}
+
+// discardDB drops all batched writes.
+type discardDB struct {
+	dbm.DB
+}
+
+func (discardDB) NewBatch() dbm.Batch { return discardBatch{} }
+
+type discardBatch struct{}
+
+func (discardBatch) Set(key, value []byte) error { return nil }
+func (discardBatch) Delete(key []byte) error     { return nil }
+func (discardBatch) Write() error                { return nil }
+func (discardBatch) WriteSync() error            { return nil }
+func (discardBatch) Close() error                { return nil }
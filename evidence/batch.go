@@ -0,0 +1,101 @@
+package evidence
+
+import (
+	"context"
+	"errors"
+
+	"github.com/tendermint/tendermint/types"
+)
+
+// AddEvidenceBatch is like AddEvidence for several evidence at once, but stores
+// the new evidence with a single write. Evidence that is known, repeated or
+// fails verification is skipped; the first verification error is returned
+// along with the number of evidence added.
+func (evpool *Pool) AddEvidenceBatch(evList []types.Evidence) (added int, err error) {
+	if evpool.readOnly {
+		return 0, ErrReadOnly
+	}
+
+	var (
+		firstErr error
+		valid    []types.Evidence
+		seen     = make(map[string]struct{}, len(evList))
+	)
+	for _, ev := range evList {
+		if err := checkKeyable(ev); err != nil {
+			if firstErr == nil || errors.Is(firstErr, ErrStaleEvidence) {
+				firstErr = err
+			}
+			continue
+		}
+		key := evMapKey(ev)
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+
+		known, err := evpool.isKnown(ev)
+		if err != nil {
+			return 0, err
+		}
+		if known {
+			evpool.logger.Debug("evidence already pending or committed; ignoring", evLogFields(ev)...)
+			continue
+		}
+
+		if err := evpool.verify(ev); err != nil {
+			quarantined, err := evpool.quarantine(ev, staleOrInvalid(err))
+			if !quarantined {
+				evpool.verificationFailed(ev, err, EvidenceSourceGossip)
+			}
+			if firstErr == nil || (errors.Is(firstErr, ErrStaleEvidence) && !errors.Is(err, ErrStaleEvidence)) {
+				firstErr = err
+			}
+			continue
+		}
+		valid = append(valid, ev)
+	}
+
+	if evpool.maxPendingEvidence > 0 {
+		room := int(evpool.maxPendingEvidence) - int(evpool.Size())
+		if room < 0 {
+			room = 0
+		}
+		if len(valid) > room && evpool.evictionPolicy == EvictOldest {
+			room += evpool.evictOldest(len(valid) - room)
+		}
+		if len(valid) > room {
+			valid = valid[:room]
+			if firstErr == nil {
+				firstErr = ErrEvidencePoolFull
+			}
+		}
+	}
+	if len(valid) == 0 {
+		return 0, firstErr
+	}
+
+	addedHeight := evpool.State().LastBlockHeight
+	err = evpool.withStoreRetry(context.Background(), func() error {
+		batch := evpool.evidenceStore.NewBatch()
+		defer batch.Close()
+		for _, ev := range valid {
+			if err := evpool.setPendingEvidence(batch, ev, false, addedHeight); err != nil {
+				return err
+			}
+		}
+		return batch.WriteSync()
+	})
+	if err != nil {
+		return 0, persistError{err}
+	}
+
+	params := evpool.EvidenceParams()
+	for _, ev := range valid {
+		evpool.pendingEvidenceAdded(ev, addedHeight)
+		evpool.schedulePruning(ev, params)
+		evpool.evidenceList.PushBack(ev)
+		evpool.logger.Info("verified new evidence of byzantine behavior", evLogFields(ev)...)
+	}
+	return len(valid), firstErr
+}
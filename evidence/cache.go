@@ -0,0 +1,173 @@
+package evidence
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/tendermint/tendermint/types"
+)
+
+// defaultValidatorSetCacheSize is the number of validator sets the pool caches
+// for verification by default.
+const defaultValidatorSetCacheSize = 100
+
+// valSetCache is a concurrency-safe LRU cache of validator sets keyed by
+// height. Sets are copied on the way in and out, so callers can't modify the
+// cached sets.
+type valSetCache struct {
+	mtx      sync.Mutex
+	size     int
+	cacheMap map[int64]*list.Element
+	list     *list.List
+}
+
+type valSetCacheEntry struct {
+	height int64
+	valSet *types.ValidatorSet
+}
+
+// newValSetCache returns a new cache holding up to size validator sets. A size
+// of 0 disables caching.
+func newValSetCache(size int) *valSetCache {
+	return &valSetCache{
+		size:     size,
+		cacheMap: make(map[int64]*list.Element, size),
+		list:     list.New(),
+	}
+}
+
+// Get returns the cached validator set at the given height, if any.
+func (cache *valSetCache) Get(height int64) (*types.ValidatorSet, bool) {
+	cache.mtx.Lock()
+	defer cache.mtx.Unlock()
+
+	e, ok := cache.cacheMap[height]
+	if !ok {
+		return nil, false
+	}
+	cache.list.MoveToBack(e)
+	return e.Value.(valSetCacheEntry).valSet.Copy(), true
+}
+
+// Add caches the validator set at the given height, evicting the least
+// recently used set if the cache is full.
+func (cache *valSetCache) Add(height int64, valSet *types.ValidatorSet) {
+	if cache.size <= 0 {
+		return
+	}
+
+	cache.mtx.Lock()
+	defer cache.mtx.Unlock()
+
+	entry := valSetCacheEntry{height: height, valSet: valSet.Copy()}
+	if e, ok := cache.cacheMap[height]; ok {
+		e.Value = entry
+		cache.list.MoveToBack(e)
+		return
+	}
+
+	if cache.list.Len() >= cache.size {
+		if popped := cache.list.Front(); popped != nil {
+			delete(cache.cacheMap, popped.Value.(valSetCacheEntry).height)
+			cache.list.Remove(popped)
+		}
+	}
+	cache.cacheMap[height] = cache.list.PushBack(entry)
+}
+
+// InvalidateFrom removes the validator sets at the given height and above.
+func (cache *valSetCache) InvalidateFrom(height int64) {
+	cache.mtx.Lock()
+	defer cache.mtx.Unlock()
+
+	for h, e := range cache.cacheMap {
+		if h >= height {
+			delete(cache.cacheMap, h)
+			cache.list.Remove(e)
+		}
+	}
+}
+
+// Reset empties the cache.
+func (cache *valSetCache) Reset() {
+	cache.mtx.Lock()
+	defer cache.mtx.Unlock()
+
+	cache.cacheMap = make(map[int64]*list.Element, cache.size)
+	cache.list.Init()
+}
+
+// committedLookupCacheSize is the number of evidence hashes for which the pool
+// remembers how far it has looked for the evidence in the block store, see
+// WithBlockStoreCommittedLookup.
+const committedLookupCacheSize = 1000
+
+// lookupCache is a concurrency-safe LRU cache of the height up to which the
+// blocks have been searched for evidence without finding it, keyed by evidence
+// hash.
+type lookupCache struct {
+	mtx      sync.Mutex
+	size     int
+	cacheMap map[string]*list.Element
+	list     *list.List
+}
+
+type lookupCacheEntry struct {
+	hash   string
+	height int64
+}
+
+// newLookupCache returns a new cache holding up to size heights.
+func newLookupCache(size int) *lookupCache {
+	return &lookupCache{
+		size:     size,
+		cacheMap: make(map[string]*list.Element, size),
+		list:     list.New(),
+	}
+}
+
+// Get returns the height up to which the blocks have been searched for the
+// evidence with the given hash, if any.
+func (cache *lookupCache) Get(hash []byte) (int64, bool) {
+	cache.mtx.Lock()
+	defer cache.mtx.Unlock()
+
+	e, ok := cache.cacheMap[string(hash)]
+	if !ok {
+		return 0, false
+	}
+	cache.list.MoveToBack(e)
+	return e.Value.(lookupCacheEntry).height, true
+}
+
+// Add records that the blocks up to the given height have been searched for
+// the evidence with the given hash, evicting the least recently used entry if
+// the cache is full.
+func (cache *lookupCache) Add(hash []byte, height int64) {
+	cache.mtx.Lock()
+	defer cache.mtx.Unlock()
+
+	entry := lookupCacheEntry{hash: string(hash), height: height}
+	if e, ok := cache.cacheMap[entry.hash]; ok {
+		e.Value = entry
+		cache.list.MoveToBack(e)
+		return
+	}
+
+	if cache.list.Len() >= cache.size {
+		if popped := cache.list.Front(); popped != nil {
+			delete(cache.cacheMap, popped.Value.(lookupCacheEntry).hash)
+			cache.list.Remove(popped)
+		}
+	}
+	cache.cacheMap[entry.hash] = cache.list.PushBack(entry)
+}
+
+// Reset empties the cache.
+func (cache *lookupCache) Reset() {
+	cache.mtx.Lock()
+	defer cache.mtx.Unlock()
+
+	cache.cacheMap = make(map[string]*list.Element, cache.size)
+	cache.list.Init()
+}
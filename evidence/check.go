@@ -0,0 +1,218 @@
+package evidence
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/tendermint/tendermint/types"
+)
+
+// VerifyEvidence runs the same checks as AddEvidence and returns the same
+// error without adding the evidence to the pool or writing to the store.
+func (evpool *Pool) VerifyEvidence(ev types.Evidence) error {
+	if evpool.readOnly {
+		return ErrReadOnly
+	}
+	pending, err := evpool.checkPending(ev)
+	if err != nil || pending {
+		return err
+	}
+	committed, err := evpool.checkCommitted(ev)
+	if err != nil {
+		return err
+	}
+	if committed {
+		return ErrAlreadyCommitted
+	}
+	if evpool.rejectsNewEvidence() {
+		return ErrEvidencePoolFull
+	}
+	return staleOrInvalid(evpool.verify(ev))
+}
+
+// CheckEvidenceDetailed is like CheckEvidence but checks all the evidence
+// rather than stopping at the first problem, returning an error, or nil, for
+// each evidence in evList.
+func (evpool *Pool) CheckEvidenceDetailed(evList types.EvidenceList) []error {
+	var (
+		errs = make([]error, len(evList))
+		seen = make(map[string]struct{}, len(evList))
+	)
+	if evpool.readOnly {
+		for idx := range errs {
+			errs[idx] = ErrReadOnly
+		}
+		return errs
+	}
+	for idx, ev := range evList {
+		if err := evpool.checkBlockEvidence(ev); err != nil {
+			errs[idx] = err
+			continue
+		}
+
+		if isDuplicate(seen, ev) {
+			errs[idx] = &types.ErrInvalidEvidence{Evidence: ev, Reason: errors.New("duplicate evidence")}
+		}
+	}
+
+	return errs
+}
+
+// checkBlockEvidence checks a single evidence from a block for CheckEvidence,
+// leaving out whether the block contains it twice.
+func (evpool *Pool) checkBlockEvidence(ev types.Evidence) error {
+	if err := evpool.checkBounds(ev); err != nil {
+		return err
+	}
+	if evpool.fastCheck(ev) {
+		return nil
+	}
+
+	// check that the evidence isn't already committed
+	committed, err := evpool.checkCommitted(ev)
+	if err != nil {
+		return err
+	}
+	if committed {
+		return &types.ErrInvalidEvidence{Evidence: ev, Reason: errors.New("evidence was already committed")}
+	}
+
+	if evpool.syncing != nil && evpool.syncing() {
+		// While syncing, the block has already been committed by the
+		// network, so only the structure of the evidence is checked. It is
+		// not added to the pending pool as it is about to be committed.
+		if err := ev.ValidateBasic(); err != nil {
+			return types.NewErrInvalidEvidence(ev, err)
+		}
+		return nil
+	}
+	return evpool.checkNewEvidence(ev)
+}
+
+// checkBounds rejects evidence from a block that accuses too many validators
+// or is too large, before any expensive work is done on it. The number of
+// byzantine validators is checked first, as it's known without encoding the
+// evidence.
+func (evpool *Pool) checkBounds(ev types.Evidence) error {
+	if lcae, ok := ev.(*types.LightClientAttackEvidence); ok && evpool.maxByzantineValidators > 0 &&
+		len(lcae.ByzantineValidators) > evpool.maxByzantineValidators {
+		return types.NewErrInvalidEvidence(ev, fmt.Errorf("%w: %d > %d",
+			ErrTooManyByzantineValidators, len(lcae.ByzantineValidators), evpool.maxByzantineValidators))
+	}
+
+	maxBytes := evpool.maxEvidenceBytes
+	if maxBytes <= 0 {
+		maxBytes = evpool.EvidenceParams().MaxBytes
+	}
+	if size := evidenceBytes(ev); maxBytes > 0 && size > maxBytes {
+		return types.NewErrInvalidEvidence(ev, fmt.Errorf("%w: %d > %d bytes", ErrEvidenceTooLarge, size, maxBytes))
+	}
+	return nil
+}
+
+// isDuplicate returns true if the hash of the evidence is in seen, the hashes
+// of the evidence before it in the block that passed its checks, and adds it
+// otherwise.
+func isDuplicate(seen map[string]struct{}, ev types.Evidence) bool {
+	hash := string(ev.Hash())
+	if _, ok := seen[hash]; ok {
+		return true
+	}
+	seen[hash] = struct{}{}
+	return false
+}
+
+// Sources of evidence passed to the callback set with SetOnInvalidEvidence.
+const (
+	// EvidenceSourceGossip is evidence added through AddEvidence and related
+	// methods, whether received from peers or submitted locally.
+	EvidenceSourceGossip = "gossip"
+	// EvidenceSourceBlock is evidence in a block passed to CheckEvidence.
+	EvidenceSourceBlock = "block"
+)
+
+// SetOnInvalidEvidence sets a callback called on the caller's goroutine, without
+// holding any locks, whenever evidence fails verification, with the evidence,
+// the error and its source. A nil callback removes it.
+func (evpool *Pool) SetOnInvalidEvidence(callback func(ev types.Evidence, reason error, source string)) {
+	evpool.mtx.Lock()
+	defer evpool.mtx.Unlock()
+	evpool.onInvalidEvidence = callback
+}
+
+// verificationFailed accounts for evidence from the given source that failed
+// verification with err.
+func (evpool *Pool) verificationFailed(ev types.Evidence, err error, source string) {
+	evpool.metrics.FailedVerifications.Add(1)
+
+	evpool.mtx.RLock()
+	callback := evpool.onInvalidEvidence
+	height := evpool.state.LastBlockHeight
+	evpool.mtx.RUnlock()
+	if callback != nil {
+		callback(ev, err, source)
+	}
+	evpool.publishEvent(TransitionRejected, ev, height)
+}
+
+// addUnpersisted keeps verified evidence from a block that couldn't be stored
+// in memory, so that the block can be checked again and its evidence looked up
+// without verifying it again.
+func (evpool *Pool) addUnpersisted(ev types.Evidence) {
+	evpool.unpersistedMtx.Lock()
+	defer evpool.unpersistedMtx.Unlock()
+	if evpool.unpersisted == nil {
+		evpool.unpersisted = make(map[string]types.Evidence)
+	}
+	evpool.unpersisted[evMapKey(ev)] = ev
+}
+
+// getUnpersisted returns the evidence kept in memory with the same key as ev,
+// if any.
+func (evpool *Pool) getUnpersisted(ev types.Evidence) (types.Evidence, bool) {
+	evpool.unpersistedMtx.Lock()
+	defer evpool.unpersistedMtx.Unlock()
+	unpersisted, ok := evpool.unpersisted[evMapKey(ev)]
+	return unpersisted, ok
+}
+
+// getUnpersistedByHash returns the evidence kept in memory with the given
+// hash, if any.
+func (evpool *Pool) getUnpersistedByHash(hash []byte) (types.Evidence, bool) {
+	evpool.unpersistedMtx.Lock()
+	defer evpool.unpersistedMtx.Unlock()
+	for _, ev := range evpool.unpersisted {
+		if bytes.Equal(ev.Hash(), hash) {
+			return ev, true
+		}
+	}
+	return nil, false
+}
+
+// retryUnpersisted forgets the evidence kept in memory that has been committed
+// in the block or has expired, and tries again to store the rest as pending.
+func (evpool *Pool) retryUnpersisted(committed types.EvidenceList) {
+	evpool.unpersistedMtx.Lock()
+	defer evpool.unpersistedMtx.Unlock()
+	if len(evpool.unpersisted) == 0 {
+		return
+	}
+
+	for _, ev := range committed {
+		delete(evpool.unpersisted, evMapKey(ev))
+	}
+	state := evpool.State()
+	for key, ev := range evpool.unpersisted {
+		if evpool.isExpired(ev) || evpool.isCommitted(ev) {
+			delete(evpool.unpersisted, key)
+			continue
+		}
+		if err := evpool.addPendingEvidence(ev, false, state.LastBlockHeight); err != nil {
+			evpool.logger.Error("failed to add evidence to pending list", append(evLogFields(ev), "err", err)...)
+			continue
+		}
+		evpool.schedulePruning(ev, state.ConsensusParams.Evidence)
+		delete(evpool.unpersisted, key)
+	}
+}
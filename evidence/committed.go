@@ -0,0 +1,326 @@
+package evidence
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/gogo/protobuf/proto"
+	gogotypes "github.com/gogo/protobuf/types"
+	"github.com/google/orderedcode"
+	dbm "github.com/tendermint/tm-db"
+
+	"github.com/tendermint/tendermint/types"
+)
+
+// committedEvidenceBufferSize is the number of committed evidence buffered in
+// the channel returned by CommittedEvidenceChan before evidence is dropped.
+const committedEvidenceBufferSize = 100
+
+// CommittedEvidence returns the committed evidence, ordered by height from
+// oldest to newest, within maxBytes, along with its total size. If maxBytes is
+// -1, there's no cap on the size of returned evidence. Only evidence committed
+// while WithCommittedEvidenceCopies was enabled is returned.
+func (evpool *Pool) CommittedEvidence(maxBytes int64) ([]types.Evidence, int64) {
+	evidence, size, err := evpool.listEvidence(prefixCommittedEvidence, maxBytes)
+	if err != nil {
+		evpool.logger.Error("failed to retrieve committed evidence", "err", err)
+	}
+	return evidence, size
+}
+
+// CommittedHeight returns the height of the block in which the evidence was
+// committed and whether the evidence is known to be committed. Evidence
+// committed by older versions of the pool records its own height instead.
+// Errors loading or decoding the height are logged and reported as not found.
+func (evpool *Pool) CommittedHeight(ev types.Evidence) (int64, bool) {
+	key := keyCommitted(ev)
+	bz, err := evpool.evidenceStore.Get(key)
+	if err != nil {
+		evpool.logger.Error("failed to load committed evidence", append(evLogFields(ev), "err", err)...)
+		return 0, false
+	}
+	if bz == nil {
+		return 0, false
+	}
+
+	var h gogotypes.Int64Value
+	if err := proto.Unmarshal(bz, &h); err != nil {
+		evpool.logger.Error("failed to unmarshal committed evidence", append(evLogFields(ev), "err", err)...)
+		return 0, false
+	}
+	return h.Value, true
+}
+
+// checkCommitted is like isCommitted but returns DB errors and also looks in
+// the block store if WithBlockStoreCommittedLookup is set. It must not be called
+// while holding mtx.
+func (evpool *Pool) checkCommitted(evidence types.Evidence) (bool, error) {
+	ok, err := evpool.hasCommitted(evidence)
+	if err != nil || ok || !evpool.blockStoreCommittedLookup {
+		return ok, err
+	}
+	return evpool.findCommittedInBlocks(evidence)
+}
+
+// hasCommitted returns true if the evidence is marked as committed in the
+// evidence store.
+func (evpool *Pool) hasCommitted(evidence types.Evidence) (bool, error) {
+	ok, err := evpool.evidenceStore.Has(keyCommitted(evidence))
+	if err != nil {
+		return false, fmt.Errorf("failed to find committed evidence: %w", err)
+	}
+	return ok, nil
+}
+
+// findCommittedInBlocks looks for the evidence in the blocks after its height
+// in which it hadn't expired yet, resuming where an earlier lookup stopped.
+// Evidence that is found is marked as committed at the height of its block.
+func (evpool *Pool) findCommittedInBlocks(ev types.Evidence) (bool, error) {
+	loader, ok := evpool.blockStore.(blockLoader)
+	if !ok {
+		return false, nil
+	}
+
+	var (
+		hash      = ev.Hash()
+		emptyHash = types.EvidenceList(nil).Hash()
+		state     = evpool.State()
+		params    = evpool.expiryParams(ev, state.ConsensusParams.Evidence)
+	)
+	from := ev.Height() + 1
+	if searched, ok := evpool.committedLookups.Get(hash); ok && searched >= from {
+		from = searched + 1
+	}
+	if store, ok := evpool.blockStore.(baser); ok && store.Base() > from {
+		from = store.Base()
+	}
+	// The block being checked by CheckEvidence may already be saved, for
+	// example when syncing blocks, so blocks after the state aren't consulted.
+	to := state.LastBlockHeight
+
+	for height := from; height <= to; height++ {
+		meta := evpool.blockStore.LoadBlockMeta(height)
+		if meta == nil {
+			continue
+		}
+		if height-ev.Height() > params.MaxAgeNumBlocks && meta.Header.Time.Sub(ev.Time()) > params.MaxAgeDuration {
+			break
+		}
+		if bytes.Equal(meta.Header.EvidenceHash, emptyHash) {
+			continue
+		}
+		block := loader.LoadBlock(height)
+		if block == nil {
+			continue
+		}
+		for _, committed := range block.Evidence.Evidence {
+			if bytes.Equal(committed.Hash(), hash) {
+				// the evidence is committed even if that can't be recorded
+				if err := evpool.backfillCommitted(ev, height); err != nil {
+					evpool.logger.Error("failed to mark evidence as committed", append(evLogFields(ev), "err", err)...)
+				}
+				return true, nil
+			}
+		}
+	}
+	evpool.committedLookups.Add(hash, to)
+	return false, nil
+}
+
+// backfillCommitted marks evidence found in the block at the given height as
+// committed at that height.
+func (evpool *Pool) backfillCommitted(ev types.Evidence, height int64) error {
+	heightBytes, err := proto.Marshal(&gogotypes.Int64Value{Value: height})
+	if err != nil {
+		return fmt.Errorf("failed to marshal committed evidence height: %w", err)
+	}
+	var evBytes []byte
+	if evpool.keepCommittedEvidence {
+		evpb, err := types.EvidenceToProto(ev)
+		if err != nil {
+			return fmt.Errorf("failed to convert committed evidence to proto: %w", err)
+		}
+		if evBytes, err = evpb.Marshal(); err != nil {
+			return fmt.Errorf("failed to marshal committed evidence: %w", err)
+		}
+	}
+
+	batch := evpool.evidenceStore.NewBatch()
+	defer batch.Close()
+	if err := evpool.commitEvidence(batch, ev, heightBytes, evBytes, false); err != nil {
+		return fmt.Errorf("failed to save committed evidence: %w", err)
+	}
+	if err := evpool.writeCommitted(batch, 1); err != nil {
+		return fmt.Errorf("failed to save committed evidence: %w", err)
+	}
+	evpool.logger.Info("found committed evidence in block store", append(evLogFields(ev), "block_height", height)...)
+	return nil
+}
+
+// pruneCommittedEvidence deletes all committed evidence from below the
+// committed retention period, along with its metadata.
+func (evpool *Pool) pruneCommittedEvidence(height int64) {
+	if evpool.committedRetention <= 0 {
+		return
+	}
+	cutoff := height - evpool.committedRetention
+	if cutoff <= 0 {
+		return
+	}
+
+	batch := evpool.evidenceStore.NewBatch()
+	defer batch.Close()
+	pruned, err := deleteCommittedInfo(evpool.evidenceStore, batch, cutoff)
+	if err != nil {
+		evpool.logger.Error("failed to prune committed evidence", "err", err)
+		return
+	}
+	for _, prefix := range []int64{prefixCommitted, prefixCommittedEvidence} {
+		// committed evidence is keyed by height first, so the evidence to prune
+		// forms a single range
+		end, err := orderedcode.Append(nil, prefix, cutoff)
+		if err != nil {
+			panic(err)
+		}
+		if _, err := deleteRange(evpool.evidenceStore, batch, prefixToBytes(prefix), end); err != nil {
+			evpool.logger.Error("failed to prune committed evidence", "err", err)
+			return
+		}
+	}
+	if pruned == 0 {
+		return
+	}
+	if err := evpool.writeCommitted(batch, -int64(pruned)); err != nil {
+		evpool.logger.Error("failed to prune committed evidence", "err", err)
+		return
+	}
+	evpool.logger.Debug("pruned committed evidence", "count", pruned, "below height", cutoff)
+}
+
+// deleteCommittedInfo adds the deletion of the metadata of the committed
+// evidence from below the cutoff height to the batch and returns the number of
+// committed evidence. Metadata is keyed like committed evidence, but may belong
+// to pending evidence too, so it is deleted one committed evidence at a time.
+func deleteCommittedInfo(db dbm.DB, batch dbm.Batch, cutoff int64) (int, error) {
+	end, err := orderedcode.Append(nil, prefixCommitted, cutoff)
+	if err != nil {
+		panic(err)
+	}
+	iter, err := db.Iterator(prefixToBytes(prefixCommitted), end)
+	if err != nil {
+		return 0, err
+	}
+	defer iter.Close()
+
+	n := 0
+	for ; iter.Valid(); iter.Next() {
+		height, hash, err := parseEvidenceKey(iter.Key())
+		if err != nil {
+			return n, err
+		}
+		infoKey, err := orderedcode.Append(nil, prefixInfo, height, string(hash))
+		if err != nil {
+			return n, err
+		}
+		if err := batch.Delete(infoKey); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, iter.Error()
+}
+
+// deleteRange adds the deletion of all keys from start to end, exclusive, to
+// the batch and returns the number of keys deleted.
+func deleteRange(db dbm.DB, batch dbm.Batch, start, end []byte) (int, error) {
+	iter, err := db.Iterator(start, end)
+	if err != nil {
+		return 0, err
+	}
+	defer iter.Close()
+
+	n := 0
+	for ; iter.Valid(); iter.Next() {
+		if err := batch.Delete(iter.Key()); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, iter.Error()
+}
+
+// CommittedCount returns the amount of committed evidence the pool knows of,
+// not counting pruned evidence. The store is only counted the first time and
+// after Restore or Reset.
+func (evpool *Pool) CommittedCount() (uint32, error) {
+	evpool.committedCountMtx.Lock()
+	defer evpool.committedCountMtx.Unlock()
+	if !evpool.committedCounted {
+		n, err := countKeys(evpool.evidenceStore, prefixCommitted)
+		if err != nil {
+			return 0, fmt.Errorf("failed to count committed evidence: %w", err)
+		}
+		evpool.committedCount, evpool.committedCounted = n, true
+	}
+	return evpool.committedCount, nil
+}
+
+// resetCommittedCount makes CommittedCount count the committed evidence in the
+// store again.
+func (evpool *Pool) resetCommittedCount() {
+	evpool.committedCountMtx.Lock()
+	defer evpool.committedCountMtx.Unlock()
+	evpool.committedCount, evpool.committedCounted = 0, false
+}
+
+// writeCommitted writes a batch adding or removing delta committed evidence
+// and updates the count of committed evidence accordingly. The batch is
+// written while the count is locked, so that it's never counted twice.
+func (evpool *Pool) writeCommitted(batch dbm.Batch, delta int64) error {
+	evpool.committedCountMtx.Lock()
+	defer evpool.committedCountMtx.Unlock()
+	if err := batch.WriteSync(); err != nil {
+		return err
+	}
+	if evpool.committedCounted {
+		evpool.committedCount = uint32(int64(evpool.committedCount) + delta)
+	}
+	return nil
+}
+
+// commitEvidence adds the committed height and, unless evBytes is nil, the
+// evidence itself to the batch. If the evidence is pending, the deletion of its
+// pending key and the record of why it was removed are added as well.
+func (evpool *Pool) commitEvidence(batch dbm.Batch, ev types.Evidence, height, evBytes []byte, pending bool) error {
+	if pending {
+		if err := batch.Delete(keyPending(ev)); err != nil {
+			return err
+		}
+		if err := batch.Delete(keyHashIndex(ev.Hash())); err != nil {
+			return err
+		}
+		err := evpool.setTombstone(batch, ev.Height(), ev.Hash(), RemovalCommitted, evpool.State().LastBlockHeight)
+		if err != nil {
+			return err
+		}
+	}
+	if err := batch.Set(keyCommitted(ev), height); err != nil {
+		return err
+	}
+
+	// keep the evidence itself as well, so that it can be listed without the
+	// block store
+	if evBytes == nil {
+		return nil
+	}
+	return batch.Set(keyCommittedEvidence(ev), evBytes)
+}
+
+func keyCommittedEvidence(evidence types.Evidence) []byte {
+	var height int64 = evidence.Height()
+	key, err := orderedcode.Append(nil, prefixCommittedEvidence, height, string(evidence.Hash()))
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
@@ -0,0 +1,274 @@
+package evidence
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/google/orderedcode"
+	dbm "github.com/tendermint/tm-db"
+
+	"github.com/tendermint/tendermint/types"
+)
+
+// maxPrefixProbeKeys is the number of keys under each prefix that are checked
+// for foreign data when the pool is created.
+const maxPrefixProbeKeys = 1000
+
+// ValidateStore returns the keys of the pending evidence entries that don't
+// decode, don't re-encode to the stored bytes or are stored under the wrong
+// key. See RemoveCorruptEvidence to delete them.
+func (evpool *Pool) ValidateStore() (corrupt [][]byte, err error) {
+	iter, err := dbm.IteratePrefix(evpool.evidenceStore, prefixToBytes(prefixPending))
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer iter.Close()
+
+	for ; iter.Valid(); iter.Next() {
+		if _, err := validateEntry(iter.Key(), iter.Value()); err != nil {
+			evpool.logger.Error("found corrupt pending evidence", "key", iter.Key(), "err", err)
+			// the iterator may reuse the key's buffer
+			corrupt = append(corrupt, append([]byte(nil), iter.Key()...))
+		}
+	}
+
+	return corrupt, iter.Error()
+}
+
+// CheckConsistency checks that the pending evidence in memory, the pending
+// evidence in the store and the size of the pool agree, returning an
+// *InconsistencyError otherwise. It's meant for operators and tests.
+func (evpool *Pool) CheckConsistency() error {
+	stored := make(map[string][]byte) // hashes by key
+	iter, err := dbm.IteratePrefix(evpool.evidenceStore, prefixToBytes(prefixPending))
+	if err != nil {
+		return fmt.Errorf("database error: %v", err)
+	}
+	defer iter.Close()
+	for ; iter.Valid(); iter.Next() {
+		// go by the key, so that entries which fail to decode are still counted
+		_, hash, err := parseEvidenceKey(iter.Key())
+		if err != nil {
+			evpool.logger.Error("found malformed pending evidence key", "key", iter.Key(), "err", err)
+			continue
+		}
+		stored[string(iter.Key())] = hash
+	}
+	if err := iter.Error(); err != nil {
+		return fmt.Errorf("database error: %v", err)
+	}
+
+	var (
+		inconsistency = &InconsistencyError{StoredSize: uint32(len(stored)), Size: evpool.Size()}
+		listed        = make(map[string]struct{})
+	)
+	for e := evpool.evidenceList.Front(); e != nil; e = e.Next() {
+		ev := e.Value.(types.Evidence)
+		listed[evMapKey(ev)] = struct{}{}
+		if _, ok := stored[evMapKey(ev)]; !ok {
+			inconsistency.MissingFromStore = append(inconsistency.MissingFromStore, ev.Hash())
+		}
+	}
+	for key, hash := range stored {
+		if _, ok := listed[key]; !ok {
+			inconsistency.MissingFromList = append(inconsistency.MissingFromList, hash)
+		}
+	}
+	sort.Slice(inconsistency.MissingFromList, func(i, j int) bool {
+		return bytes.Compare(inconsistency.MissingFromList[i], inconsistency.MissingFromList[j]) < 0
+	})
+
+	if len(inconsistency.MissingFromList) > 0 || len(inconsistency.MissingFromStore) > 0 ||
+		inconsistency.StoredSize != inconsistency.Size {
+		return inconsistency
+	}
+	return nil
+}
+
+// RemoveCorruptEvidence deletes the given pending evidence entries, as returned
+// by ValidateStore, from the store. Each entry is validated again beforehand
+// and keys of entries that are valid, missing or not pending evidence are
+// skipped.
+func (evpool *Pool) RemoveCorruptEvidence(keys [][]byte) error {
+	if evpool.readOnly {
+		return ErrReadOnly
+	}
+	evpool.mtx.Lock()
+	defer evpool.mtx.Unlock()
+
+	type entryID struct {
+		height int64
+		hash   []byte
+	}
+
+	var (
+		batch   = evpool.evidenceStore.NewBatch()
+		removed = make(map[string]struct{})
+		decoded uint32
+		size    int64
+		deleted []entryID
+	)
+	defer batch.Close()
+
+	for _, key := range keys {
+		if !bytes.HasPrefix(key, prefixToBytes(prefixPending)) {
+			continue
+		}
+		value, err := evpool.evidenceStore.Get(key)
+		if err != nil {
+			return fmt.Errorf("failed to load pending evidence: %w", err)
+		}
+		if value == nil {
+			continue
+		}
+		ev, err := validateEntry(key, value)
+		if err == nil {
+			continue
+		}
+
+		if err := batch.Delete(key); err != nil {
+			return err
+		}
+		// drop the entry's metadata if it can be located
+		if height, hash, err := parseEvidenceKey(key); err == nil {
+			infoKey, err := orderedcode.Append(nil, prefixInfo, height, string(hash))
+			if err != nil {
+				return err
+			}
+			if err := batch.Delete(infoKey); err != nil {
+				return err
+			}
+			// the index may point to valid evidence stored under its own key
+			indexed, err := evpool.evidenceStore.Get(keyHashIndex(hash))
+			if err != nil {
+				return err
+			}
+			if bytes.Equal(indexed, key) {
+				if err := batch.Delete(keyHashIndex(hash)); err != nil {
+					return err
+				}
+			}
+			if err := evpool.setTombstone(batch, height, hash, RemovalManual, evpool.state.LastBlockHeight); err != nil {
+				return err
+			}
+			deleted = append(deleted, entryID{height: height, hash: hash})
+		}
+		// evidence that decodes and is stored under its own key was loaded into
+		// the pool and counted. Entries under a foreign key may duplicate valid
+		// evidence, which must stay in the pool.
+		if ev != nil && bytes.Equal(keyPending(ev), key) {
+			removed[evMapKey(ev)] = struct{}{}
+			decoded++
+			size += evidenceBytes(ev)
+			evpool.accused.Remove(ev)
+		}
+	}
+
+	if err := batch.WriteSync(); err != nil {
+		return fmt.Errorf("failed to remove corrupt evidence: %w", err)
+	}
+
+	evpool.removeEvidenceFromList(removed)
+	evpool.decrementSize(decoded, size)
+	for _, id := range deleted {
+		evpool.publishMutation(MutationRemoved, id.height, id.hash)
+	}
+	return nil
+}
+
+// RecalculateSize rebuilds the evidence list and its size from the pending
+// evidence in the store, dropping evidence that is already committed. It must
+// be called while the pool isn't in use.
+func (evpool *Pool) RecalculateSize() error {
+	before := evpool.Size()
+	if err := evpool.reloadPendingEvidence(); err != nil {
+		return fmt.Errorf("failed to recalculate size: %w", err)
+	}
+	if after := evpool.Size(); after != before {
+		evpool.logger.Info("corrected number of pending evidence", "before", before, "after", after)
+	}
+	return nil
+}
+
+// probeForeignKeys logs an error if any of the first keys under each of the
+// pool's prefixes is not an evidence key, which means another subsystem writes
+// under the same prefix.
+func (evpool *Pool) probeForeignKeys() {
+	for _, prefix := range poolPrefixes {
+		if prefix == prefixPruning {
+			// not an evidence key
+			continue
+		}
+		iter, err := dbm.IteratePrefix(evpool.evidenceStore, prefixToBytes(prefix))
+		if err != nil {
+			evpool.logger.Error("failed to probe evidence store for foreign keys", "prefix", prefix, "err", err)
+			continue
+		}
+
+		var probed, foreign int
+		var example []byte
+		for ; iter.Valid() && probed < maxPrefixProbeKeys; iter.Next() {
+			probed++
+			var err error
+			if prefix == prefixHashIndex {
+				_, err = parseHashIndexKey(iter.Key())
+			} else {
+				_, _, err = parseEvidenceKey(iter.Key())
+			}
+			if err != nil {
+				if foreign == 0 {
+					example = append([]byte(nil), iter.Key()...)
+				}
+				foreign++
+			}
+		}
+		iter.Close()
+
+		if foreign > 0 {
+			evpool.logger.Error(
+				"found keys that are not evidence under a prefix reserved by the evidence pool; "+
+					"another subsystem may be sharing the evidence database",
+				"prefix", prefix,
+				"foreign_keys", foreign,
+				"probed_keys", probed,
+				"example_key", fmt.Sprintf("%X", example),
+			)
+		}
+	}
+}
+
+// validateEntry checks that a pending evidence entry round-trips through its
+// proto encoding and is stored under its own height and hash. The decoded
+// evidence is returned if the value could be decoded, even if the entry is
+// invalid.
+func validateEntry(key, value []byte) (types.Evidence, error) {
+	ev, err := bytesToEv(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode evidence: %w", err)
+	}
+
+	evpb, err := types.EvidenceToProto(ev)
+	if err != nil {
+		return ev, fmt.Errorf("failed to convert to proto: %w", err)
+	}
+	evBytes, err := evpb.Marshal()
+	if err != nil {
+		return ev, fmt.Errorf("failed to marshal evidence: %w", err)
+	}
+	if !bytes.Equal(evBytes, value) {
+		return ev, errors.New("evidence is not canonically encoded")
+	}
+
+	height, hash, err := parseEvidenceKey(key)
+	if err != nil {
+		return ev, err
+	}
+	if height != ev.Height() || !bytes.Equal(hash, ev.Hash()) {
+		return ev, fmt.Errorf("evidence stored under height %d and hash %X has height %d and hash %X",
+			height, hash, ev.Height(), ev.Hash())
+	}
+
+	return ev, nil
+}
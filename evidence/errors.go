@@ -0,0 +1,172 @@
+package evidence
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	tmbytes "github.com/tendermint/tendermint/libs/bytes"
+	"github.com/tendermint/tendermint/types"
+)
+
+var (
+	// ErrValidatorSetMismatch is returned in multi-verifier mode when the state
+	// store and the secondary validator set provider disagree on the validator
+	// set at the evidence height.
+	ErrValidatorSetMismatch = errors.New("validator set providers disagree")
+
+	// ErrStoreUnavailable is returned when the evidence store kept reporting
+	// temporary unavailability until the store retry timeout elapsed. The
+	// operation may be retried later.
+	ErrStoreUnavailable = errors.New("evidence store temporarily unavailable")
+
+	// ErrBelowRetainedHeight is returned when evidence can't be verified because
+	// its height is below the earliest block retained by the block store. This
+	// is not invalid evidence and the sender should not be punished for it.
+	ErrBelowRetainedHeight = errors.New("evidence height is below the earliest retained block")
+
+	// ErrNoValidatorSetForHeight is returned when evidence can't be verified
+	// because the validator set at its height can't be loaded from the state
+	// store, for example because the state has been pruned. This is not invalid
+	// evidence and the evidence may be retried later.
+	ErrNoValidatorSetForHeight = errors.New("no validator set for evidence height")
+
+	// ErrEvidencePoolFull is returned when evidence is rejected because the pool
+	// holds the maximum number of pending evidence. It says nothing about the
+	// validity of the evidence.
+	ErrEvidencePoolFull = errors.New("evidence pool is full")
+
+	// ErrStaleEvidence is returned by AddEvidence for evidence that would have
+	// been valid but has since expired. Unlike *types.ErrInvalidEvidence it
+	// doesn't imply the sender misbehaved, as a peer that is behind may still
+	// consider the evidence recent. Evidence that is already committed is
+	// likewise benign, see ErrAlreadyCommitted.
+	ErrStaleEvidence = errors.New("evidence is stale")
+
+	// ErrExpired is another name for ErrStaleEvidence, so that errors.Is matches
+	// expired evidence under either.
+	ErrExpired = ErrStaleEvidence
+
+	// ErrPoolAlreadyOpen is returned by NewPool when another pool in the same
+	// process is open on the evidence store with the same chain ID prefix, see
+	// WithChainIDPrefix, or when a pool with a prefix and one without would
+	// share the store. Both pools would then use the same pending evidence, so
+	// their sizes and lists would diverge from the store. A pool only stops
+	// being open once it is closed, see NewPool.
+	ErrPoolAlreadyOpen = errors.New("an evidence pool is already open on the evidence store")
+
+	// ErrNotPending is returned by RemovePending for evidence that isn't
+	// pending, either because it was never added or because it has since been
+	// committed or removed.
+	ErrNotPending = errors.New("evidence is not pending")
+
+	// ErrAlreadyCommitted is returned by AddEvidence for evidence that has
+	// already been committed. It doesn't imply the sender misbehaved, as a peer
+	// that is behind may not know the evidence is committed yet.
+	ErrAlreadyCommitted = errors.New("evidence is already committed")
+
+	// ErrInvalidSignature is the reason duplicate vote evidence is invalid if
+	// either of its votes isn't signed by the accused validator. It is wrapped
+	// by the *types.ErrInvalidEvidence error returned for such evidence.
+	ErrInvalidSignature = types.ErrVoteInvalidSignature
+
+	// ErrPersistFailed is returned when valid evidence couldn't be stored. The
+	// error also wraps the error returned by the store, for example
+	// ErrStoreUnavailable.
+	ErrPersistFailed = errors.New("failed to persist evidence")
+
+	// ErrFutureEvidence is returned when evidence is from a height too far
+	// after the last committed block, from a later height whose block isn't
+	// stored yet, or from a committed height with a time after the last block
+	// time. Such evidence can't be verified yet, although a peer that is ahead
+	// of this node may already consider it valid. Evidence from the next few
+	// heights is quarantined, see RetryQuarantined.
+	ErrFutureEvidence = errors.New("evidence is from the future")
+
+	// ErrTooManyByzantineValidators is the reason light client attack evidence
+	// from a block is invalid if it accuses more validators than allowed by
+	// WithMaxByzantineValidators.
+	ErrTooManyByzantineValidators = errors.New("too many byzantine validators")
+
+	// ErrEvidenceTooLarge is the reason evidence from a block is invalid if its
+	// encoding is larger than allowed by WithMaxEvidenceBytes.
+	ErrEvidenceTooLarge = errors.New("evidence is too large")
+
+	// ErrReadOnly is returned by the methods of a pool opened with
+	// NewPoolReadOnly that would need the state or write to the store.
+	ErrReadOnly = errors.New("evidence pool is read-only")
+
+	// ErrUnsupportedSchemaVersion is returned by NewPool for an evidence store
+	// written by a newer version of the pool, whose layout this version can't
+	// read, and by NewPoolReadOnly for a store that needs migrating to the
+	// layout of this version.
+	ErrUnsupportedSchemaVersion = errors.New("unsupported evidence store schema version")
+)
+
+// expiredError is the reason verification gives for expired evidence, which
+// lets AddEvidence tell stale evidence apart from other invalid evidence.
+type expiredError struct{ error }
+
+// persistError is the error of evidence that couldn't be stored. It matches
+// both ErrPersistFailed and the error it wraps.
+type persistError struct{ error }
+
+func (e persistError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrPersistFailed, e.error)
+}
+
+func (e persistError) Unwrap() error {
+	return e.error
+}
+
+func (e persistError) Is(target error) bool {
+	return target == ErrPersistFailed
+}
+
+// staleOrInvalid returns an error wrapping ErrStaleEvidence if err is the
+// verification error of expired evidence and err unchanged otherwise.
+func staleOrInvalid(err error) error {
+	if invalidErr, ok := err.(*types.ErrInvalidEvidence); ok {
+		if reason, ok := invalidErr.Reason.(expiredError); ok {
+			return fmt.Errorf("%v: %w", reason, ErrStaleEvidence)
+		}
+	}
+	return err
+}
+
+// InconsistencyError is returned by CheckConsistency when the pending evidence
+// in the store, the in-memory list of pending evidence and the size counter of
+// the pool disagree.
+type InconsistencyError struct {
+	// MissingFromList holds the hashes of evidence that is pending in the store
+	// but not in the list.
+	MissingFromList []tmbytes.HexBytes
+	// MissingFromStore holds the hashes of evidence in the list that isn't
+	// pending in the store.
+	MissingFromStore []tmbytes.HexBytes
+	// StoredSize is the number of pending evidence in the store and Size the
+	// number reported by Pool.Size.
+	StoredSize uint32
+	Size       uint32
+}
+
+func (e *InconsistencyError) Error() string {
+	var problems []string
+	if len(e.MissingFromList) > 0 {
+		problems = append(problems, fmt.Sprintf("pending evidence missing from list: %v", e.MissingFromList))
+	}
+	if len(e.MissingFromStore) > 0 {
+		problems = append(problems, fmt.Sprintf("listed evidence missing from store: %v", e.MissingFromStore))
+	}
+	if e.StoredSize != e.Size {
+		problems = append(problems, fmt.Sprintf("size is %d but %d evidence is stored", e.Size, e.StoredSize))
+	}
+	return "evidence pool is inconsistent: " + strings.Join(problems, "; ")
+}
+
+// isTemporary returns true if err, or any error it wraps, reports itself as
+// temporary, following the convention of net.Error.
+func isTemporary(err error) bool {
+	var tempErr interface{ Temporary() bool }
+	return errors.As(err, &tempErr) && tempErr.Temporary()
+}
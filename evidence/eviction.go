@@ -0,0 +1,60 @@
+package evidence
+
+import (
+	dbm "github.com/tendermint/tm-db"
+
+	"github.com/tendermint/tendermint/types"
+)
+
+// isFull returns true if the pool holds the maximum number of pending evidence.
+func (evpool *Pool) isFull() bool {
+	return evpool.maxPendingEvidence > 0 && evpool.Size() >= evpool.maxPendingEvidence
+}
+
+// rejectsNewEvidence returns true if new evidence is rejected because the pool
+// is full and doesn't evict pending evidence to make room.
+func (evpool *Pool) rejectsNewEvidence() bool {
+	return evpool.isFull() && evpool.evictionPolicy == RejectNew
+}
+
+// evictOldest removes up to n of the oldest pending evidence and returns the
+// number of evidence removed. Entries that can't be decoded are skipped unless
+// decoding is strict, see WithStrictDecoding, in which case nothing after them
+// is evicted.
+func (evpool *Pool) evictOldest(n int) int {
+	// not listEvidence, which may order pending evidence by other criteria
+	iter, err := dbm.IteratePrefix(evpool.evidenceStore, prefixToBytes(prefixPending))
+	if err != nil {
+		evpool.logger.Error("failed to find evidence to evict", "err", err)
+		return 0
+	}
+	var oldest []types.Evidence
+	for ; iter.Valid() && len(oldest) < n; iter.Next() {
+		_, ev, err := evpool.decodeListedEvidence(iter.Key(), iter.Value())
+		if err != nil {
+			evpool.logger.Error("failed to find evidence to evict", "err", err)
+			break
+		}
+		if ev != nil {
+			oldest = append(oldest, ev)
+		}
+	}
+	if err := iter.Error(); err != nil {
+		evpool.logger.Error("failed to find evidence to evict", "err", err)
+	}
+	iter.Close()
+
+	evicted := make(map[string]struct{}, len(oldest))
+	for _, ev := range oldest {
+		if !evpool.removePendingEvidence(ev, RemovalEvicted) {
+			continue
+		}
+		evpool.publishMutation(MutationEvicted, ev.Height(), ev.Hash())
+		evicted[evMapKey(ev)] = struct{}{}
+		evpool.logger.Info("evicted evidence from full pool", evLogFields(ev)...)
+	}
+	if len(evicted) != 0 {
+		evpool.removeEvidenceFromList(evicted)
+	}
+	return len(evicted)
+}
@@ -0,0 +1,90 @@
+package evidence
+
+import (
+	"time"
+
+	"github.com/tendermint/tendermint/types"
+)
+
+// isExpiredAt is like isExpired but measures the age of the evidence in time
+// up to now rather than the latest block time.
+func (evpool *Pool) isExpiredAt(ev types.Evidence, now time.Time) bool {
+	evpool.mtx.RLock()
+	var (
+		params       = evpool.expiryParams(ev, evpool.state.ConsensusParams.Evidence)
+		ageDuration  = now.Sub(ev.Time())
+		ageNumBlocks = evpool.state.LastBlockHeight - evpool.expiryHeight(ev)
+	)
+	evpool.mtx.RUnlock()
+	return ageNumBlocks > params.MaxAgeNumBlocks &&
+		ageDuration > params.MaxAgeDuration
+}
+
+// expiryParams returns the maximum age of the evidence: the expiry override of
+// its type if there is one and the given consensus params otherwise.
+func (evpool *Pool) expiryParams(ev types.Evidence, params types.EvidenceParams) ExpiryParams {
+	if override, ok := evpool.expiryOverrides[evidenceTypeOf(ev)]; ok {
+		return override
+	}
+	return ExpiryParams{MaxAgeNumBlocks: params.MaxAgeNumBlocks, MaxAgeDuration: params.MaxAgeDuration}
+}
+
+// hasExpiryOverride returns true if the maximum age of the evidence is
+// overridden, see WithExpiryOverrides.
+func (evpool *Pool) hasExpiryOverride(ev types.Evidence) bool {
+	_, ok := evpool.expiryOverrides[evidenceTypeOf(ev)]
+	return ok
+}
+
+// isUnexpired returns true if the evidence hasn't expired yet. Expired evidence
+// may still be pending if pruning is limited with WithMaxExpiredPerUpdate or
+// light client attack evidence expires from its conflicting height or by an
+// expiry override, but must not be proposed.
+func (evpool *Pool) isUnexpired(ev types.Evidence) bool {
+	return !evpool.isExpired(ev)
+}
+
+// isProposable returns true if the pending evidence is unexpired and eligible
+// for proposal, see WithEligibilityDelay.
+func (evpool *Pool) isProposable(ev types.Evidence) bool {
+	return evpool.isUnexpired(ev) && evpool.isEligible(ev)
+}
+
+// isEligible returns true if the eligibility delay of the pending evidence has
+// passed. Evidence whose info can't be loaded isn't eligible.
+func (evpool *Pool) isEligible(ev types.Evidence) bool {
+	if evpool.eligibilityDelay <= 0 {
+		return true
+	}
+	info, err := evpool.loadInfo(ev)
+	if err != nil {
+		evpool.logger.Error("failed to load evidence info", append(evLogFields(ev), "err", err)...)
+		return false
+	}
+	return info.AddedHeight+evpool.eligibilityDelay <= evpool.State().LastBlockHeight
+}
+
+// expiryHeight returns the height from which the age of the evidence in blocks
+// is measured, see WithLightClientAttackExpiryBasis. The age in time is always
+// measured from the evidence timestamp.
+func (evpool *Pool) expiryHeight(ev types.Evidence) int64 {
+	if evpool.lcaExpiryBasis == ExpireFromConflictingHeight {
+		if lcae, ok := ev.(*types.LightClientAttackEvidence); ok && lcae.ConflictingBlock != nil {
+			return lcae.ConflictingBlock.Height
+		}
+	}
+	return ev.Height()
+}
+
+// evidenceTypeOf returns the type of the evidence, or 0 if it's of an unknown
+// type.
+func evidenceTypeOf(ev types.Evidence) EvidenceType {
+	switch ev.(type) {
+	case *types.DuplicateVoteEvidence:
+		return DuplicateVoteEvidenceType
+	case *types.LightClientAttackEvidence:
+		return LightClientAttackEvidenceType
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,88 @@
+package evidence
+
+import (
+	"sync/atomic"
+	"time"
+
+	dbm "github.com/tendermint/tm-db"
+
+	"github.com/tendermint/tendermint/types"
+)
+
+// SchemaVersion is the schema version of the evidence store written by this
+// version of the pool, exported exclusively and explicitly for testing.
+const SchemaVersion = schemaVersion
+
+// MaxFutureEvidenceHeights is the number of heights after the last block height
+// from which evidence is verified, exported exclusively and explicitly for
+// testing.
+const MaxFutureEvidenceHeights = maxFutureEvidenceHeights
+
+// PushEvidenceToList adds evidence to the pool's concurrent list without
+// storing it, exclusively and explicitly for testing.
+func (evpool *Pool) PushEvidenceToList(ev types.Evidence) {
+	evpool.evidenceList.PushBack(ev)
+}
+
+// RemoveEvidenceFromList is an alias for removeEvidenceFromList exported from
+// pool.go, exclusively and explicitly for testing.
+func (evpool *Pool) RemoveEvidenceFromList(blockEvidenceMap map[string]struct{}) {
+	evpool.removeEvidenceFromList(blockEvidenceMap)
+}
+
+// LoadValidators is an alias for loadValidators exported from verify.go,
+// exclusively and explicitly for testing.
+func (evpool *Pool) LoadValidators(height int64) (*types.ValidatorSet, error) {
+	return evpool.loadValidators(height)
+}
+
+// QuarantineSize returns the number of quarantined evidence, exclusively and
+// explicitly for testing.
+func (evpool *Pool) QuarantineSize() uint32 {
+	return atomic.LoadUint32(&evpool.quarantineSize)
+}
+
+// SetSize overwrites the number of pending evidence, exclusively and explicitly
+// for testing.
+func (evpool *Pool) SetSize(size uint32) {
+	atomic.StoreUint32(&evpool.evidenceSize, size)
+}
+
+// PruningPoint returns the height and time at which the pool prunes expired
+// evidence next, exclusively and explicitly for testing.
+func (evpool *Pool) PruningPoint() (int64, time.Time) {
+	return evpool.pruningHeight, evpool.pruningTime
+}
+
+// PruneExpired is an alias for pruneExpired exported from pruning.go,
+// exclusively and explicitly for testing.
+func (evpool *Pool) PruneExpired() {
+	evpool.pruneExpired()
+}
+
+// BytesToEv is an alias for bytesToEv exported from pool.go, exclusively and
+// explicitly for testing.
+func BytesToEv(evBytes []byte) (types.Evidence, error) {
+	return bytesToEv(evBytes)
+}
+
+// EvLogFields is an alias for evLogFields exported from pool.go, exclusively
+// and explicitly for testing.
+func EvLogFields(ev types.Evidence) []interface{} {
+	return evLogFields(ev)
+}
+
+// EvMapKey is an alias for evMapKey exported from pool.go, exclusively and
+// explicitly for testing.
+func EvMapKey(ev types.Evidence) string {
+	return evMapKey(ev)
+}
+
+// SetSchemaMigration replaces the migration of the evidence store to the given
+// schema version, exclusively and explicitly for testing. The returned function
+// restores the original migration.
+func SetSchemaMigration(version int64, migration func(db dbm.DB) error) (restore func()) {
+	original := schemaMigrations[version]
+	schemaMigrations[version] = migration
+	return func() { schemaMigrations[version] = original }
+}
@@ -0,0 +1,194 @@
+package evidence
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/orderedcode"
+	dbm "github.com/tendermint/tm-db"
+
+	"github.com/tendermint/tendermint/types"
+)
+
+// RecentlyAdded returns the pending evidence that this node first saw after the
+// given time, oldest first. Evidence without a recorded first-seen time is
+// never returned.
+func (evpool *Pool) RecentlyAdded(since time.Time) ([]types.Evidence, error) {
+	iter, err := dbm.IteratePrefix(evpool.evidenceStore, prefixToBytes(prefixPending))
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer iter.Close()
+
+	type seenEvidence struct {
+		ev        types.Evidence
+		firstSeen time.Time
+	}
+
+	var recent []seenEvidence
+	for ; iter.Valid(); iter.Next() {
+		_, ev, err := evpool.decodeListedEvidence(iter.Key(), iter.Value())
+		if err != nil {
+			return nil, err
+		}
+		if ev == nil {
+			continue
+		}
+
+		info, err := evpool.loadInfo(ev)
+		if err != nil {
+			return nil, err
+		}
+
+		if info.FirstSeen.After(since) {
+			recent = append(recent, seenEvidence{ev: ev, firstSeen: info.FirstSeen})
+		}
+	}
+
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(recent, func(i, j int) bool {
+		return recent[i].firstSeen.Before(recent[j].firstSeen)
+	})
+
+	evidence := make([]types.Evidence, len(recent))
+	for i, r := range recent {
+		evidence[i] = r.ev
+	}
+
+	return evidence, nil
+}
+
+// CommittedFromSelf returns the info of all committed evidence with a height
+// between min and max inclusive that this node detected itself in consensus,
+// as opposed to evidence received from peers. The result is ordered by height.
+// Evidence committed before this information was recorded is not included.
+func (evpool *Pool) CommittedFromSelf(min, max int64) ([]EvidenceInfo, error) {
+	start, err := orderedcode.Append(nil, prefixCommitted, min)
+	if err != nil {
+		return nil, err
+	}
+	end, err := orderedcode.Append(nil, prefixCommitted, max+1)
+	if err != nil {
+		return nil, err
+	}
+
+	iter, err := evpool.evidenceStore.Iterator(start, end)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer iter.Close()
+
+	var infos []EvidenceInfo
+	for ; iter.Valid(); iter.Next() {
+		height, hash, err := parseEvidenceKey(iter.Key())
+		if err != nil {
+			return nil, err
+		}
+
+		infoKey, err := orderedcode.Append(nil, prefixInfo, height, string(hash))
+		if err != nil {
+			return nil, err
+		}
+		bz, err := evpool.evidenceStore.Get(infoKey)
+		if err != nil {
+			return nil, err
+		}
+		if len(bz) == 0 {
+			continue
+		}
+
+		info, err := bytesToInfo(height, hash, bz)
+		if err != nil {
+			return nil, err
+		}
+		if info.DetectedBySelf {
+			infos = append(infos, info)
+		}
+	}
+
+	return infos, iter.Error()
+}
+
+// loadInfo returns the metadata recorded for the evidence. If there is none,
+// for example because the evidence was stored by an older version, only the
+// height and hash are set.
+func (evpool *Pool) loadInfo(ev types.Evidence) (EvidenceInfo, error) {
+	bz, err := evpool.evidenceStore.Get(keyInfo(ev))
+	if err != nil {
+		return EvidenceInfo{}, err
+	}
+	if bz == nil {
+		return EvidenceInfo{Height: ev.Height(), Hash: ev.Hash()}, nil
+	}
+	return bytesToInfo(ev.Height(), ev.Hash(), bz)
+}
+
+// EvidenceInfo is the metadata the pool records alongside each piece of
+// evidence. It is kept once the evidence is committed.
+type EvidenceInfo struct {
+	// Height and Hash identify the evidence. They are part of the key and not
+	// encoded with the rest of the info.
+	Height int64
+	Hash   []byte
+
+	// FirstSeen is the time at which this node first stored the evidence.
+	FirstSeen time.Time
+	// DetectedBySelf is true if this node formed the evidence from conflicting
+	// votes seen in consensus rather than receiving it from a peer.
+	DetectedBySelf bool
+	// AddedHeight is the last block height at the time the evidence was added
+	// to the pending pool. It is 0 for evidence stored by older versions.
+	AddedHeight int64
+}
+
+// Bytes encodes the info with orderedcode. New fields must only ever be
+// appended so that older records can still be decoded.
+func (info EvidenceInfo) Bytes() []byte {
+	var detectedBySelf int64
+	if info.DetectedBySelf {
+		detectedBySelf = 1
+	}
+	bz, err := orderedcode.Append(nil, info.FirstSeen.UnixNano(), detectedBySelf, info.AddedHeight)
+	if err != nil {
+		panic(err)
+	}
+	return bz
+}
+
+func bytesToInfo(height int64, hash []byte, bz []byte) (EvidenceInfo, error) {
+	var firstSeen, detectedBySelf, addedHeight int64
+	remaining, err := orderedcode.Parse(string(bz), &firstSeen)
+	if err != nil {
+		return EvidenceInfo{}, fmt.Errorf("failed to decode evidence info: %w", err)
+	}
+	// records written before the flag or the added height were introduced
+	// don't have them
+	for _, field := range []*int64{&detectedBySelf, &addedHeight} {
+		if len(remaining) == 0 {
+			break
+		}
+		if remaining, err = orderedcode.Parse(remaining, field); err != nil {
+			return EvidenceInfo{}, fmt.Errorf("failed to decode evidence info: %w", err)
+		}
+	}
+	return EvidenceInfo{
+		Height:         height,
+		Hash:           hash,
+		FirstSeen:      time.Unix(0, firstSeen).UTC(),
+		DetectedBySelf: detectedBySelf == 1,
+		AddedHeight:    addedHeight,
+	}, nil
+}
+
+func keyInfo(evidence types.Evidence) []byte {
+	var height int64 = evidence.Height()
+	key, err := orderedcode.Append(nil, prefixInfo, height, string(evidence.Hash()))
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
@@ -0,0 +1,412 @@
+package evidence
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/google/orderedcode"
+	dbm "github.com/tendermint/tm-db"
+
+	tmjson "github.com/tendermint/tendermint/libs/json"
+	tmproto "github.com/tendermint/tendermint/proto/tendermint/types"
+	"github.com/tendermint/tendermint/types"
+)
+
+// PendingEvidenceDefault is like PendingEvidence with the byte budget of
+// evidence in a block, as set by the evidence consensus params of the latest
+// state. The budget is capped at the maximum size of a block.
+func (evpool *Pool) PendingEvidenceDefault() ([]types.Evidence, int64) {
+	evpool.mtx.RLock()
+	var (
+		maxBytes      = evpool.state.ConsensusParams.Evidence.MaxBytes
+		maxBlockBytes = evpool.state.ConsensusParams.Block.MaxBytes
+	)
+	evpool.mtx.RUnlock()
+
+	if maxBlockBytes > 0 && maxBytes > maxBlockBytes {
+		maxBytes = maxBlockBytes
+	}
+	if maxBytes > types.MaxBlockSizeBytes {
+		maxBytes = types.MaxBlockSizeBytes
+	}
+	// -1 would mean no cap at all
+	if maxBytes <= 0 {
+		return []types.Evidence{}, 0
+	}
+	return evpool.PendingEvidence(maxBytes)
+}
+
+// PendingEvidenceWithLimit is like PendingEvidence but returns at most maxNum
+// evidence. A maxNum of 0 only applies the cap set with WithMaxListedEvidence.
+func (evpool *Pool) PendingEvidenceWithLimit(maxBytes int64, maxNum int) ([]types.Evidence, int64) {
+	if evpool.Size() == 0 {
+		return []types.Evidence{}, 0
+	}
+
+	limit := evpool.maxListedEvidence
+	if maxNum > 0 && (limit == -1 || maxNum < limit) {
+		limit = maxNum
+	}
+
+	evidence, size, err := evpool.listEvidenceWithFilter(prefixPending, maxBytes, limit, evpool.isProposable)
+	if err != nil {
+		evpool.logger.Error("failed to retrieve pending evidence", "err", err)
+	}
+
+	return evidence, size
+}
+
+// PendingEvidenceProto is like PendingEvidence but returns the protobuf form
+// of the evidence, as decoded from the store, sparing callers that serialize the
+// evidence, such as the reactor, from converting it back.
+func (evpool *Pool) PendingEvidenceProto(maxBytes int64) ([]tmproto.Evidence, int64, error) {
+	if evpool.Size() == 0 {
+		return []tmproto.Evidence{}, 0, nil
+	}
+
+	_, evpbs, size, err := evpool.listEvidenceWithProto(prefixPending, maxBytes, evpool.maxListedEvidence,
+		evpool.isProposable)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to retrieve pending evidence: %w", err)
+	}
+	return evpbs, size, nil
+}
+
+// PendingEvidenceJSON is like PendingEvidence but returns the evidence
+// marshaled with libs/json, as used by the RPC. Unlike PendingEvidence, it
+// returns an error if the pending evidence can't be retrieved.
+func (evpool *Pool) PendingEvidenceJSON(maxBytes int64) ([]byte, error) {
+	evList := []types.Evidence{}
+	if evpool.Size() > 0 {
+		evidence, _, err := evpool.listEvidenceWithFilter(prefixPending, maxBytes, evpool.maxListedEvidence,
+			evpool.isProposable)
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve pending evidence: %w", err)
+		}
+		evList = append(evList, evidence...)
+	}
+
+	bz, err := tmjson.Marshal(evList)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal pending evidence: %w", err)
+	}
+	return bz, nil
+}
+
+// PendingEvidenceExcluding is like PendingEvidence but skips any evidence whose
+// hash is in the known set, for example because a peer has advertised that it
+// already has it. The known set is keyed by the evidence hash as a string.
+// Excluded evidence does not count towards maxBytes.
+func (evpool *Pool) PendingEvidenceExcluding(known map[string]struct{}, maxBytes int64) ([]types.Evidence, int64) {
+	if evpool.Size() == 0 {
+		return []types.Evidence{}, 0
+	}
+
+	evidence, size, err := evpool.listEvidenceWithFilter(prefixPending, maxBytes, evpool.maxListedEvidence,
+		func(ev types.Evidence) bool {
+			_, ok := known[string(ev.Hash())]
+			return !ok && evpool.isProposable(ev)
+		})
+	if err != nil {
+		evpool.logger.Error("failed to retrieve pending evidence", "err", err)
+	}
+
+	return evidence, size
+}
+
+// IteratePending calls fn for each pending evidence, from oldest to newest, until
+// fn returns false, without holding all the evidence in memory. fn must not add
+// evidence to or remove evidence from the pool.
+func (evpool *Pool) IteratePending(fn func(ev types.Evidence) bool) error {
+	iter, err := dbm.IteratePrefix(evpool.evidenceStore, prefixToBytes(prefixPending))
+	if err != nil {
+		return fmt.Errorf("database error: %v", err)
+	}
+	defer iter.Close()
+
+	for ; iter.Valid(); iter.Next() {
+		_, ev, err := evpool.decodeListedEvidence(iter.Key(), iter.Value())
+		if err != nil {
+			return err
+		}
+		if ev == nil {
+			continue
+		}
+		if !fn(ev) {
+			return nil
+		}
+	}
+
+	return iter.Error()
+}
+
+// ListPendingPaged returns up to limit pending evidence after skipping the
+// first offset, ordered by height and hash, along with the total number of
+// pending evidence.
+func (evpool *Pool) ListPendingPaged(offset, limit int) ([]types.Evidence, int, error) {
+	if offset < 0 {
+		return nil, 0, fmt.Errorf("negative offset %d", offset)
+	}
+	if limit < 0 {
+		return nil, 0, fmt.Errorf("negative limit %d", limit)
+	}
+
+	iter, err := dbm.IteratePrefix(evpool.evidenceStore, prefixToBytes(prefixPending))
+	if err != nil {
+		return nil, 0, fmt.Errorf("database error: %v", err)
+	}
+	defer iter.Close()
+
+	var (
+		page  = []types.Evidence{}
+		total int
+	)
+	for ; iter.Valid(); iter.Next() {
+		_, ev, err := evpool.decodeListedEvidence(iter.Key(), iter.Value())
+		if err != nil {
+			return nil, 0, err
+		}
+		if ev == nil {
+			continue
+		}
+		if total >= offset && len(page) < limit {
+			page = append(page, ev)
+		}
+		total++
+	}
+	if err := iter.Error(); err != nil {
+		return nil, 0, fmt.Errorf("database error: %v", err)
+	}
+
+	return page, total, nil
+}
+
+// PendingEvidenceByHeight returns the pending evidence with heights between
+// minHeight and maxHeight, inclusive, ordered by height. Only the evidence in
+// that range is read from the store. Entries that can't be decoded are skipped
+// unless decoding is strict, see WithStrictDecoding.
+func (evpool *Pool) PendingEvidenceByHeight(minHeight, maxHeight int64) ([]types.Evidence, error) {
+	if minHeight > maxHeight {
+		return nil, fmt.Errorf("min height %d is greater than max height %d", minHeight, maxHeight)
+	}
+
+	start, err := orderedcode.Append(nil, prefixPending, minHeight)
+	if err != nil {
+		return nil, err
+	}
+	// the range ends before the next height, or the next prefix if there is no
+	// next height
+	end := prefixToBytes(prefixPending + 1)
+	if maxHeight < math.MaxInt64 {
+		if end, err = orderedcode.Append(nil, prefixPending, maxHeight+1); err != nil {
+			return nil, err
+		}
+	}
+
+	iter, err := evpool.evidenceStore.Iterator(start, end)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %v", err)
+	}
+	defer iter.Close()
+
+	var evList []types.Evidence
+	for ; iter.Valid(); iter.Next() {
+		_, ev, err := evpool.decodeListedEvidence(iter.Key(), iter.Value())
+		if err != nil {
+			return nil, err
+		}
+		if ev == nil {
+			continue
+		}
+		evList = append(evList, ev)
+	}
+
+	return evList, iter.Error()
+}
+
+// listEvidenceWithFilter is like listEvidence but returns at most maxNum
+// evidence, or all if maxNum is -1, and skips the evidence for which include
+// returns false.
+func (evpool *Pool) listEvidenceWithFilter(
+	prefixKey int64,
+	maxBytes int64,
+	maxNum int,
+	include func(types.Evidence) bool,
+) ([]types.Evidence, int64, error) {
+	evidence, _, size, err := evpool.listEvidenceWithProto(prefixKey, maxBytes, maxNum, include)
+	return evidence, size, err
+}
+
+// listEvidenceWithProto is like listEvidenceWithFilter but also returns the
+// protobuf form of each evidence, as decoded from the store.
+func (evpool *Pool) listEvidenceWithProto(
+	prefixKey int64,
+	maxBytes int64,
+	maxNum int,
+	include func(types.Evidence) bool,
+) ([]types.Evidence, []tmproto.Evidence, int64, error) {
+	if prefixKey == prefixPending {
+		priority := evpool.priorityValidatorSet()
+		if evpool.pendingOrder == OrderByImpact || len(priority) > 0 {
+			return evpool.listPendingEvidenceSorted(maxBytes, maxNum, include, priority)
+		}
+	}
+
+	var (
+		evSize    int64
+		totalSize int64
+		evidence  []types.Evidence
+		evList    tmproto.EvidenceList // used for calculating the bytes size
+	)
+
+	iter, err := dbm.IteratePrefix(evpool.evidenceStore, prefixToBytes(prefixKey))
+	if err != nil {
+		return nil, nil, totalSize, fmt.Errorf("database error: %v", err)
+	}
+
+	defer iter.Close()
+
+	for ; iter.Valid(); iter.Next() {
+		evpb, ev, err := evpool.decodeListedEvidence(iter.Key(), iter.Value())
+		if err != nil {
+			return nil, nil, totalSize, err
+		}
+		if ev == nil {
+			continue
+		}
+
+		if include != nil && !include(ev) {
+			continue
+		}
+
+		if maxNum != -1 && len(evidence) >= maxNum {
+			break
+		}
+
+		evList.Evidence = append(evList.Evidence, evpb)
+		evSize = int64(evList.Size()) + int64(len(evList.Evidence))*evpool.evidenceOverhead
+
+		if maxBytes != -1 && evSize > maxBytes {
+			// the last evidence in evList didn't fit
+			if err := iter.Error(); err != nil {
+				return evidence, evList.Evidence[:len(evidence)], totalSize, err
+			}
+			return evidence, evList.Evidence[:len(evidence)], totalSize, nil
+		}
+
+		totalSize = evSize
+		evidence = append(evidence, ev)
+	}
+
+	if err := iter.Error(); err != nil {
+		return evidence, evList.Evidence, totalSize, err
+	}
+
+	return evidence, evList.Evidence, totalSize, nil
+}
+
+// decodeListedEvidence decodes a stored evidence entry while listing evidence.
+// If the entry can't be decoded, the error is returned if decoding is strict
+// and otherwise logged, returning nil evidence so that the entry is skipped.
+func (evpool *Pool) decodeListedEvidence(key, value []byte) (tmproto.Evidence, types.Evidence, error) {
+	var evpb tmproto.Evidence
+	err := evpb.Unmarshal(value)
+	if err == nil {
+		var ev types.Evidence
+		if ev, err = types.EvidenceFromProto(&evpb); err == nil {
+			return evpb, ev, nil
+		}
+	}
+
+	if evpool.strictDecoding {
+		return evpb, nil, err
+	}
+	evpool.logger.Error("skipping evidence that failed to decode", "key", key, "err", err)
+	return evpb, nil, nil
+}
+
+// listPendingEvidenceSorted is like listEvidenceWithProto for pending
+// evidence, but returns the evidence implicating any of the priority
+// validators first. With OrderByImpact, the evidence is then ordered by the
+// voting power it implicates, highest first.
+func (evpool *Pool) listPendingEvidenceSorted(
+	maxBytes int64,
+	maxNum int,
+	include func(types.Evidence) bool,
+	priority map[string]struct{},
+) ([]types.Evidence, []tmproto.Evidence, int64, error) {
+	type candidate struct {
+		ev          types.Evidence
+		evpb        tmproto.Evidence
+		prioritized bool
+		impact      int64
+	}
+
+	iter, err := dbm.IteratePrefix(evpool.evidenceStore, prefixToBytes(prefixPending))
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("database error: %v", err)
+	}
+	defer iter.Close()
+
+	var candidates []candidate
+	for ; iter.Valid(); iter.Next() {
+		evpb, ev, err := evpool.decodeListedEvidence(iter.Key(), iter.Value())
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		if ev == nil {
+			continue
+		}
+		if include != nil && !include(ev) {
+			continue
+		}
+		c := candidate{ev: ev, evpb: evpb, prioritized: implicatesAny(ev, priority)}
+		if evpool.pendingOrder == OrderByImpact {
+			c.impact = evidenceImpact(ev)
+		}
+		candidates = append(candidates, c)
+	}
+	if err := iter.Error(); err != nil {
+		return nil, nil, 0, err
+	}
+
+	// candidates are ordered by age, which a stable sort keeps for equal
+	// priority and impact
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].prioritized != candidates[j].prioritized {
+			return candidates[i].prioritized
+		}
+		return candidates[i].impact > candidates[j].impact
+	})
+
+	var (
+		totalSize int64
+		evidence  []types.Evidence
+		evList    tmproto.EvidenceList // used for calculating the bytes size
+	)
+	for _, c := range candidates {
+		if maxNum != -1 && len(evidence) >= maxNum {
+			break
+		}
+		evList.Evidence = append(evList.Evidence, c.evpb)
+		evSize := int64(evList.Size()) + int64(len(evList.Evidence))*evpool.evidenceOverhead
+		if maxBytes != -1 && evSize > maxBytes {
+			break
+		}
+		totalSize = evSize
+		evidence = append(evidence, c.ev)
+	}
+
+	return evidence, evList.Evidence[:len(evidence)], totalSize, nil
+}
+
+// evidenceImpact returns the total voting power of the validators implicated
+// by the evidence.
+func evidenceImpact(ev types.Evidence) int64 {
+	var power int64
+	for _, abciEv := range ev.ABCI() {
+		power += abciEv.Validator.Power
+	}
+	return power
+}
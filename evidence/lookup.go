@@ -0,0 +1,130 @@
+package evidence
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/google/orderedcode"
+	dbm "github.com/tendermint/tm-db"
+
+	"github.com/tendermint/tendermint/crypto/tmhash"
+	"github.com/tendermint/tendermint/types"
+)
+
+// EvidenceStatus is the state of evidence in the pool.
+type EvidenceStatus int
+
+const (
+	// EvidenceNotFound means the pool knows nothing about the evidence.
+	EvidenceNotFound EvidenceStatus = iota
+	// EvidencePending means the evidence is pending and waiting to be committed.
+	EvidencePending
+	// EvidenceCommitted means the evidence has been committed in a block.
+	EvidenceCommitted
+)
+
+// GetEvidenceByHash looks up evidence by its hash alone and tells whether it's
+// pending or committed. Committed evidence whose copy isn't kept, see
+// WithCommittedEvidenceCopies, is returned as nil.
+func (evpool *Pool) GetEvidenceByHash(hash []byte) (types.Evidence, EvidenceStatus, error) {
+	value, found, err := evpool.lookupByHash(hash)
+	if err != nil {
+		return nil, EvidenceNotFound, err
+	}
+	if found {
+		ev, err := bytesToEv(value)
+		if err != nil {
+			return nil, EvidenceNotFound, err
+		}
+		return ev, EvidencePending, nil
+	}
+	if ev, ok := evpool.getUnpersistedByHash(hash); ok {
+		return ev, EvidencePending, nil
+	}
+
+	_, found, err = evpool.findByHash(prefixCommitted, hash)
+	if err != nil {
+		return nil, EvidenceNotFound, err
+	}
+	if !found {
+		return nil, EvidenceNotFound, nil
+	}
+	value, found, err = evpool.findByHash(prefixCommittedEvidence, hash)
+	if err != nil || !found {
+		return nil, EvidenceCommitted, err
+	}
+	ev, err := bytesToEv(value)
+	if err != nil {
+		return nil, EvidenceCommitted, err
+	}
+	return ev, EvidenceCommitted, nil
+}
+
+// lookupByHash returns the stored pending evidence with the given hash using
+// the hash index.
+func (evpool *Pool) lookupByHash(hash []byte) ([]byte, bool, error) {
+	key, err := evpool.evidenceStore.Get(keyHashIndex(hash))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to load hash index: %w", err)
+	}
+	if key == nil {
+		return nil, false, nil
+	}
+	value, err := evpool.evidenceStore.Get(key)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to load pending evidence: %w", err)
+	}
+	return value, value != nil, nil
+}
+
+// findByHash returns the value of the first key under the prefix with the
+// given hash.
+func (evpool *Pool) findByHash(prefix int64, hash []byte) ([]byte, bool, error) {
+	iter, err := dbm.IteratePrefix(evpool.evidenceStore, prefixToBytes(prefix))
+	if err != nil {
+		return nil, false, fmt.Errorf("database error: %v", err)
+	}
+	defer iter.Close()
+
+	for ; iter.Valid(); iter.Next() {
+		_, keyHash, err := parseEvidenceKey(iter.Key())
+		if err != nil {
+			continue
+		}
+		if bytes.Equal(keyHash, hash) {
+			return append([]byte(nil), iter.Value()...), true, nil
+		}
+	}
+
+	return nil, false, iter.Error()
+}
+
+func keyHashIndex(hash []byte) []byte {
+	key, err := orderedcode.Append(nil, prefixHashIndex, string(hash))
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// parseHashIndexKey decodes a key of the form (prefix, hash) and returns the
+// hash. An error is returned if the key has any other form.
+func parseHashIndexKey(key []byte) ([]byte, error) {
+	var (
+		prefix int64
+		hash   string
+	)
+
+	remaining, err := orderedcode.Parse(string(key), &prefix, &hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse hash index key: %w", err)
+	}
+	if len(remaining) != 0 {
+		return nil, fmt.Errorf("hash index key has %d unexpected trailing bytes", len(remaining))
+	}
+	if len(hash) != tmhash.Size {
+		return nil, fmt.Errorf("hash index key has invalid hash size %d", len(hash))
+	}
+
+	return []byte(hash), nil
+}
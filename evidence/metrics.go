@@ -0,0 +1,110 @@
+package evidence
+
+import (
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+	"github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// MetricsSubsystem is a subsystem shared by all metrics exposed by this
+	// package.
+	MetricsSubsystem = "evidence_pool"
+)
+
+// Metrics contains metrics exposed by this package.
+type Metrics struct {
+	// Number of pending evidence.
+	Size metrics.Gauge
+	// Number of conflicting votes from consensus awaiting the next height.
+	ConsensusBufferSize metrics.Gauge
+	// Number of evidence added to the pending pool.
+	AddedEvidence metrics.Counter
+	// Number of evidence marked as committed.
+	CommittedEvidence metrics.Counter
+	// Age of evidence in blocks when it is committed.
+	CommittedEvidenceAgeBlocks metrics.Histogram
+	// Age of evidence in seconds when it is committed.
+	CommittedEvidenceAgeSeconds metrics.Histogram
+	// Number of pending evidence pruned because it expired.
+	ExpiredEvidence metrics.Counter
+	// Number of evidence that failed verification.
+	FailedVerifications metrics.Counter
+}
+
+// PrometheusMetrics returns Metrics build using Prometheus client library.
+// Optionally, labels can be provided along with their values ("foo",
+// "fooValue").
+func PrometheusMetrics(namespace string, labelsAndValues ...string) *Metrics {
+	labels := []string{}
+	for i := 0; i < len(labelsAndValues); i += 2 {
+		labels = append(labels, labelsAndValues[i])
+	}
+	return &Metrics{
+		Size: prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: MetricsSubsystem,
+			Name:      "size",
+			Help:      "Number of pending evidence.",
+		}, labels).With(labelsAndValues...),
+		ConsensusBufferSize: prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: MetricsSubsystem,
+			Name:      "consensus_buffer_size",
+			Help:      "Number of conflicting votes from consensus awaiting the next height.",
+		}, labels).With(labelsAndValues...),
+		AddedEvidence: prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: MetricsSubsystem,
+			Name:      "added_evidence",
+			Help:      "Number of evidence added to the pending pool.",
+		}, labels).With(labelsAndValues...),
+		CommittedEvidence: prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: MetricsSubsystem,
+			Name:      "committed_evidence",
+			Help:      "Number of evidence marked as committed.",
+		}, labels).With(labelsAndValues...),
+		CommittedEvidenceAgeBlocks: prometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: MetricsSubsystem,
+			Name:      "committed_evidence_age_blocks",
+			Help:      "Age of evidence in blocks when it is committed.",
+			Buckets:   stdprometheus.ExponentialBuckets(1, 2, 16),
+		}, labels).With(labelsAndValues...),
+		CommittedEvidenceAgeSeconds: prometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: MetricsSubsystem,
+			Name:      "committed_evidence_age_seconds",
+			Help:      "Age of evidence in seconds when it is committed.",
+			Buckets:   stdprometheus.ExponentialBuckets(1, 2, 20),
+		}, labels).With(labelsAndValues...),
+		ExpiredEvidence: prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: MetricsSubsystem,
+			Name:      "expired_evidence",
+			Help:      "Number of pending evidence pruned because it expired.",
+		}, labels).With(labelsAndValues...),
+		FailedVerifications: prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: MetricsSubsystem,
+			Name:      "failed_verifications",
+			Help:      "Number of evidence that failed verification.",
+		}, labels).With(labelsAndValues...),
+	}
+}
+
+// NopMetrics returns no-op Metrics.
+func NopMetrics() *Metrics {
+	return &Metrics{
+		Size:                        discard.NewGauge(),
+		ConsensusBufferSize:         discard.NewGauge(),
+		AddedEvidence:               discard.NewCounter(),
+		CommittedEvidence:           discard.NewCounter(),
+		CommittedEvidenceAgeBlocks:  discard.NewHistogram(),
+		CommittedEvidenceAgeSeconds: discard.NewHistogram(),
+		ExpiredEvidence:             discard.NewCounter(),
+		FailedVerifications:         discard.NewCounter(),
+	}
+}
@@ -0,0 +1,327 @@
+package evidence
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/tendermint/tendermint/types"
+)
+
+// defaultMutationBufferSize is the number of events buffered for each
+// subscriber of MutationStream before events are dropped.
+const defaultMutationBufferSize = 1000
+
+// MutationType is the kind of change made to the evidence pool.
+type MutationType uint8
+
+const (
+	// MutationAdded is published when evidence is added to the pending pool.
+	MutationAdded MutationType = iota + 1
+	// MutationCommitted is published when evidence is marked as committed.
+	MutationCommitted
+	// MutationExpired is published when pending evidence is pruned because it
+	// expired.
+	MutationExpired
+	// MutationRemoved is published when a corrupt pending entry is removed,
+	// pending evidence is removed with RemovePending or RemovePendingAtHeight, or
+	// RevalidatePending removes pending evidence that is no longer valid.
+	MutationRemoved
+	// MutationEvicted is published when pending evidence is evicted from the
+	// full pool to make room for new evidence.
+	MutationEvicted
+)
+
+func (t MutationType) String() string {
+	switch t {
+	case MutationAdded:
+		return "added"
+	case MutationCommitted:
+		return "committed"
+	case MutationExpired:
+		return "expired"
+	case MutationRemoved:
+		return "removed"
+	case MutationEvicted:
+		return "evicted"
+	default:
+		return fmt.Sprintf("MutationType(%d)", uint8(t))
+	}
+}
+
+// MutationEvent describes a single change made to the evidence pool.
+type MutationEvent struct {
+	Type MutationType
+	// Height and Hash identify the evidence.
+	Height int64
+	Hash   []byte
+	// Time is when the pool made the change, according to its clock.
+	Time time.Time
+	// Dropped is the number of events dropped for this subscriber since the
+	// previous event it received, because its buffer was full.
+	Dropped uint64
+}
+
+// Bytes encodes the event as a compact binary frame prefixed with its length
+// as a uvarint, so that a sequence of frames can be written to a stream and
+// read back one by one with ReadMutationEvent.
+func (e MutationEvent) Bytes() []byte {
+	body := make([]byte, 1, 1+3*binary.MaxVarintLen64+len(e.Hash))
+	body[0] = byte(e.Type)
+	body = appendVarint(body, e.Height)
+	body = appendVarint(body, e.Time.UnixNano())
+	body = appendUvarint(body, e.Dropped)
+	body = append(body, e.Hash...)
+
+	frame := appendUvarint(make([]byte, 0, binary.MaxVarintLen64+len(body)), uint64(len(body)))
+	return append(frame, body...)
+}
+
+// ReadMutationEvent reads a single frame written by MutationEvent.Bytes. It
+// returns io.EOF if there are no more frames.
+func ReadMutationEvent(r io.ByteReader) (MutationEvent, error) {
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return MutationEvent{}, err
+	}
+
+	body := make([]byte, size)
+	for i := range body {
+		if body[i], err = r.ReadByte(); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return MutationEvent{}, err
+		}
+	}
+	if len(body) == 0 {
+		return MutationEvent{}, errors.New("empty mutation event")
+	}
+
+	e := MutationEvent{Type: MutationType(body[0])}
+	rest := body[1:]
+	var n int
+	if e.Height, n = binary.Varint(rest); n <= 0 {
+		return MutationEvent{}, errors.New("failed to decode mutation event height")
+	}
+	rest = rest[n:]
+	var nanos int64
+	if nanos, n = binary.Varint(rest); n <= 0 {
+		return MutationEvent{}, errors.New("failed to decode mutation event time")
+	}
+	e.Time = time.Unix(0, nanos).UTC()
+	rest = rest[n:]
+	if e.Dropped, n = binary.Uvarint(rest); n <= 0 {
+		return MutationEvent{}, errors.New("failed to decode mutation event dropped count")
+	}
+	e.Hash = rest[n:]
+
+	return e, nil
+}
+
+// mutationSubscriber is a consumer of MutationStream.
+type mutationSubscriber struct {
+	ch      chan MutationEvent
+	dropped uint64
+}
+
+// MutationStream returns a channel receiving an event for every change made to
+// the pool from now on. Events are dropped rather than blocking the pool if the
+// buffer is full, which is reported in the next event. The channel is closed
+// once ctx is done.
+func (evpool *Pool) MutationStream(ctx context.Context) (<-chan MutationEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	sub := &mutationSubscriber{ch: make(chan MutationEvent, evpool.mutationBufferSize)}
+
+	evpool.subscribersMtx.Lock()
+	if evpool.subscribers == nil {
+		evpool.subscribers = make(map[*mutationSubscriber]struct{})
+	}
+	evpool.subscribers[sub] = struct{}{}
+	evpool.subscribersMtx.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		evpool.subscribersMtx.Lock()
+		// the channel is already closed if the pool was closed
+		if _, ok := evpool.subscribers[sub]; ok {
+			delete(evpool.subscribers, sub)
+			close(sub.ch)
+		}
+		evpool.subscribersMtx.Unlock()
+	}()
+
+	return sub.ch, nil
+}
+
+// publishMutation sends an event to all subscribers without blocking.
+func (evpool *Pool) publishMutation(mutation MutationType, height int64, hash []byte) {
+	evpool.subscribersMtx.Lock()
+	defer evpool.subscribersMtx.Unlock()
+
+	if len(evpool.subscribers) == 0 {
+		return
+	}
+
+	now := evpool.now()
+	for sub := range evpool.subscribers {
+		event := MutationEvent{
+			Type:    mutation,
+			Height:  height,
+			Hash:    hash,
+			Time:    now,
+			Dropped: sub.dropped,
+		}
+		select {
+		case sub.ch <- event:
+			sub.dropped = 0
+		default:
+			sub.dropped++
+		}
+	}
+}
+
+// EvidenceTransition is the kind of lifecycle transition reported by
+// Subscribe.
+type EvidenceTransition uint8
+
+const (
+	// TransitionAdded is reported when evidence is added to the pending pool.
+	TransitionAdded EvidenceTransition = iota + 1
+	// TransitionCommitted is reported when evidence is marked as committed.
+	TransitionCommitted
+	// TransitionExpired is reported when pending evidence is pruned because it
+	// expired.
+	TransitionExpired
+	// TransitionRejected is reported when evidence from a peer or a block fails
+	// verification, including expired evidence, and when pending evidence is
+	// removed by RevalidatePending because it is no longer valid.
+	TransitionRejected
+)
+
+func (t EvidenceTransition) String() string {
+	switch t {
+	case TransitionAdded:
+		return "added"
+	case TransitionCommitted:
+		return "committed"
+	case TransitionExpired:
+		return "expired"
+	case TransitionRejected:
+		return "rejected"
+	default:
+		return fmt.Sprintf("EvidenceTransition(%d)", uint8(t))
+	}
+}
+
+// EvidenceEvent describes a lifecycle transition of evidence, see Subscribe.
+type EvidenceEvent struct {
+	Evidence   types.Evidence
+	Transition EvidenceTransition
+	// Height is the latest block height of the pool when the transition
+	// happened, i.e. the height at which the evidence was committed.
+	Height int64
+}
+
+// eventSubscriber is a consumer of Subscribe.
+type eventSubscriber struct {
+	mtx    sync.Mutex
+	ch     chan EvidenceEvent
+	closed bool
+}
+
+// send delivers the event unless the subscriber is closed or its buffer is
+// full.
+func (sub *eventSubscriber) send(event EvidenceEvent) {
+	sub.mtx.Lock()
+	defer sub.mtx.Unlock()
+	if sub.closed {
+		return
+	}
+	select {
+	case sub.ch <- event:
+	default:
+	}
+}
+
+func (sub *eventSubscriber) close() {
+	sub.mtx.Lock()
+	defer sub.mtx.Unlock()
+	if !sub.closed {
+		sub.closed = true
+		close(sub.ch)
+	}
+}
+
+// Subscribe returns a channel receiving the evidence that is added, committed,
+// expires or is rejected from now on. Events are dropped if the buffer is full.
+// The returned function unsubscribes and closes the channel.
+func (evpool *Pool) Subscribe(buffer int) (<-chan EvidenceEvent, func()) {
+	if buffer < 0 {
+		buffer = 0
+	}
+	sub := &eventSubscriber{ch: make(chan EvidenceEvent, buffer)}
+
+	evpool.eventSubscribersMtx.Lock()
+	if evpool.eventSubscribers == nil {
+		evpool.eventSubscribers = make(map[*eventSubscriber]struct{})
+	}
+	evpool.eventSubscribers[sub] = struct{}{}
+	evpool.eventSubscribersMtx.Unlock()
+
+	unsubscribe := func() {
+		evpool.eventSubscribersMtx.Lock()
+		delete(evpool.eventSubscribers, sub)
+		evpool.eventSubscribersMtx.Unlock()
+		sub.close()
+	}
+	return sub.ch, unsubscribe
+}
+
+// publishEvent sends an event to all subscribers of Subscribe without
+// blocking. The list of subscribers isn't locked while sending.
+func (evpool *Pool) publishEvent(transition EvidenceTransition, ev types.Evidence, height int64) {
+	evpool.eventSubscribersMtx.Lock()
+	if len(evpool.eventSubscribers) == 0 {
+		evpool.eventSubscribersMtx.Unlock()
+		return
+	}
+	subs := make([]*eventSubscriber, 0, len(evpool.eventSubscribers))
+	for sub := range evpool.eventSubscribers {
+		subs = append(subs, sub)
+	}
+	evpool.eventSubscribersMtx.Unlock()
+
+	event := EvidenceEvent{Evidence: ev, Transition: transition, Height: height}
+	for _, sub := range subs {
+		sub.send(event)
+	}
+}
+
+// closeEventSubscribers unsubscribes all subscribers of Subscribe.
+func (evpool *Pool) closeEventSubscribers() {
+	evpool.eventSubscribersMtx.Lock()
+	subs := evpool.eventSubscribers
+	evpool.eventSubscribers = nil
+	evpool.eventSubscribersMtx.Unlock()
+	for sub := range subs {
+		sub.close()
+	}
+}
+
+func appendVarint(bz []byte, x int64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(bz, buf[:binary.PutVarint(buf[:], x)]...)
+}
+
+func appendUvarint(bz []byte, x uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(bz, buf[:binary.PutUvarint(buf[:], x)]...)
+}
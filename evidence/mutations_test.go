@@ -0,0 +1,162 @@
+package evidence_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/google/orderedcode"
+	"github.com/stretchr/testify/require"
+
+	dbm "github.com/tendermint/tm-db"
+
+	"github.com/tendermint/tendermint/evidence"
+	"github.com/tendermint/tendermint/types"
+)
+
+func TestMutationStream(t *testing.T) {
+	var height int64 = 10
+	val := types.NewMockPV()
+	evidenceDB := dbm.NewMemDB()
+	now := defaultEvidenceTime
+	pool := newTestPool(t, height, val, evidenceDB, evidence.WithClock(func() time.Time { return now }))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := pool.MutationStream(ctx)
+	require.NoError(t, err)
+
+	committed := newTestDuplicateVoteEvidence(height-1, val)
+	expired := newTestDuplicateVoteEvidence(1, val)
+	require.NoError(t, pool.AddEvidence(committed))
+	require.NoError(t, pool.AddEvidence(expired))
+
+	// commit one and expire the other evidence
+	state := pool.State()
+	state.LastBlockHeight++
+	state.LastBlockTime = defaultEvidenceTime.Add(time.Hour)
+	state.ConsensusParams.Evidence.MaxAgeNumBlocks = 2
+	state.ConsensusParams.Evidence.MaxAgeDuration = time.Minute
+	pool.Update(state, types.EvidenceList{committed})
+
+	corruptHash := bytes.Repeat([]byte{1}, 32)
+	corruptKey, err := orderedcode.Append(nil, int64(9), height, string(corruptHash))
+	require.NoError(t, err)
+	require.NoError(t, evidenceDB.Set(corruptKey, []byte("garbage")))
+	require.NoError(t, pool.RemoveCorruptEvidence([][]byte{corruptKey}))
+
+	expected := []evidence.MutationEvent{
+		{Type: evidence.MutationAdded, Height: committed.Height(), Hash: committed.Hash(), Time: now},
+		{Type: evidence.MutationAdded, Height: expired.Height(), Hash: expired.Hash(), Time: now},
+		{Type: evidence.MutationCommitted, Height: committed.Height(), Hash: committed.Hash(), Time: now},
+		{Type: evidence.MutationExpired, Height: expired.Height(), Hash: expired.Hash(), Time: now},
+		{Type: evidence.MutationRemoved, Height: height, Hash: corruptHash, Time: now},
+	}
+
+	var stream bytes.Buffer
+	for _, exp := range expected {
+		event := <-events
+		require.Equal(t, exp, event)
+		stream.Write(event.Bytes())
+	}
+
+	// the binary stream can be read back
+	r := bufio.NewReader(&stream)
+	for _, exp := range expected {
+		event, err := evidence.ReadMutationEvent(r)
+		require.NoError(t, err)
+		require.Equal(t, exp, event)
+	}
+	_, err = evidence.ReadMutationEvent(r)
+	require.Equal(t, io.EOF, err)
+
+	cancel()
+	_, ok := <-events
+	require.False(t, ok)
+
+	_, err = pool.MutationStream(ctx)
+	require.Error(t, err)
+}
+
+func TestMutationStreamSlowConsumer(t *testing.T) {
+	var height int64 = 10
+	pool, val := defaultTestPool(t, height, evidence.WithMutationBufferSize(1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := pool.MutationStream(ctx)
+	require.NoError(t, err)
+
+	// adding evidence doesn't block on the consumer
+	var evs []types.Evidence
+	for h := int64(1); h <= 3; h++ {
+		ev := newTestDuplicateVoteEvidence(h, val)
+		require.NoError(t, pool.AddEvidence(ev))
+		evs = append(evs, ev)
+	}
+
+	event := <-events
+	require.Equal(t, evs[0].Hash(), event.Hash)
+	require.Zero(t, event.Dropped)
+
+	ev := newTestDuplicateVoteEvidence(4, val)
+	require.NoError(t, pool.AddEvidence(ev))
+	event = <-events
+	require.Equal(t, ev.Hash(), event.Hash)
+	require.EqualValues(t, 2, event.Dropped)
+}
+
+func TestSubscribe(t *testing.T) {
+	var height int64 = 10
+	pool, val := defaultTestPool(t, height)
+
+	events, unsubscribe := pool.Subscribe(10)
+	other, unsubscribeOther := pool.Subscribe(10)
+	defer unsubscribeOther()
+
+	committed := newTestDuplicateVoteEvidence(height-1, val)
+	expired := newTestDuplicateVoteEvidence(1, val)
+	require.NoError(t, pool.AddEvidence(committed))
+	require.NoError(t, pool.AddEvidence(expired))
+
+	// commit one and expire the other evidence
+	state := pool.State()
+	state.LastBlockHeight++
+	state.LastBlockTime = defaultEvidenceTime.Add(time.Hour)
+	state.ConsensusParams.Evidence.MaxAgeNumBlocks = 2
+	state.ConsensusParams.Evidence.MaxAgeDuration = time.Minute
+	pool.Update(state, types.EvidenceList{committed})
+
+	badSignature := newTestDuplicateVoteEvidence(height, val)
+	badSignature.VoteB.Signature = []byte("invalid signature")
+	require.Error(t, pool.AddEvidence(badSignature))
+
+	expected := []evidence.EvidenceEvent{
+		{Evidence: committed, Transition: evidence.TransitionAdded, Height: height},
+		{Evidence: expired, Transition: evidence.TransitionAdded, Height: height},
+		{Evidence: committed, Transition: evidence.TransitionCommitted, Height: height + 1},
+		{Evidence: expired, Transition: evidence.TransitionExpired, Height: height + 1},
+		{Evidence: badSignature, Transition: evidence.TransitionRejected, Height: height + 1},
+	}
+	for _, ch := range []<-chan evidence.EvidenceEvent{events, other} {
+		for _, exp := range expected {
+			require.Equal(t, exp, <-ch)
+		}
+	}
+
+	// unsubscribing closes the channel and stops delivery to it only
+	unsubscribe()
+	unsubscribe()
+	_, ok := <-events
+	require.False(t, ok)
+
+	ev := newTestDuplicateVoteEvidence(height, val)
+	require.NoError(t, pool.AddEvidence(ev))
+	require.Equal(t, evidence.EvidenceEvent{Evidence: ev, Transition: evidence.TransitionAdded, Height: height + 1},
+		<-other)
+	_, ok = <-events
+	require.False(t, ok)
+}
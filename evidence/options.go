@@ -0,0 +1,322 @@
+package evidence
+
+import "time"
+
+// PrunedEvidencePolicy determines how the pool handles evidence for a height
+// below the earliest block retained by the block store. Such evidence can't be
+// verified as the header and commit it refers to have been pruned.
+type PrunedEvidencePolicy int
+
+const (
+	// RejectPrunedEvidence rejects the evidence with ErrBelowRetainedHeight.
+	// This is not an ErrInvalidEvidence, so peers sending it are not punished.
+	// This is the default.
+	RejectPrunedEvidence PrunedEvidencePolicy = iota
+	// TrustPrunedEvidenceFromConsensus accepts the evidence without
+	// verification when it is part of a block proposal, i.e. passed to
+	// CheckEvidence, relying on the rest of the network to have verified it.
+	// Evidence received from peers through AddEvidence is still rejected.
+	TrustPrunedEvidenceFromConsensus
+)
+
+// LightClientAttackExpiryBasis determines the height from which the age of
+// LightClientAttackEvidence is measured when checking whether it has expired.
+type LightClientAttackExpiryBasis int
+
+const (
+	// ExpireFromCommonHeight measures the age of light client attack evidence
+	// from its common height, which is also what Height() returns. This is the
+	// default and treats the evidence like DuplicateVoteEvidence.
+	ExpireFromCommonHeight LightClientAttackExpiryBasis = iota
+	// ExpireFromConflictingHeight measures the age of light client attack
+	// evidence from the height of the conflicting block. For lunatic attacks
+	// this is later than the common height, so the evidence stays valid for
+	// longer.
+	ExpireFromConflictingHeight
+)
+
+// EvidenceType identifies a type of evidence.
+type EvidenceType int
+
+const (
+	// DuplicateVoteEvidenceType is the type of *types.DuplicateVoteEvidence.
+	DuplicateVoteEvidenceType EvidenceType = iota + 1
+	// LightClientAttackEvidenceType is the type of
+	// *types.LightClientAttackEvidence.
+	LightClientAttackEvidenceType
+)
+
+// ExpiryParams is the maximum age of evidence, see WithExpiryOverrides. Like
+// with the evidence consensus params, evidence expires once it's older than
+// both.
+type ExpiryParams struct {
+	MaxAgeNumBlocks int64
+	MaxAgeDuration  time.Duration
+}
+
+// PendingEvidenceOrder determines which pending evidence PendingEvidence and
+// related methods return first, and so which evidence is proposed when the
+// limits on the number or bytes of evidence don't fit all of it.
+type PendingEvidenceOrder int
+
+const (
+	// OrderByAge returns the oldest evidence, i.e. the evidence with the lowest
+	// height, first. This is the default.
+	OrderByAge PendingEvidenceOrder = iota
+	// OrderByImpact returns the evidence implicating the most voting power
+	// first, summed over all validators the evidence implicates, such as the
+	// byzantine validators of light client attack evidence. Evidence with equal
+	// voting power is ordered by age.
+	OrderByImpact
+)
+
+// EvictionPolicy determines what happens to new evidence once the pool holds
+// the maximum number of pending evidence set with WithMaxPendingEvidence.
+type EvictionPolicy int
+
+const (
+	// RejectNew rejects new evidence with ErrEvidencePoolFull. This is the
+	// default.
+	RejectNew EvictionPolicy = iota
+	// EvictOldest removes the oldest pending evidence, i.e. the evidence with
+	// the lowest height, to make room for new evidence once it's verified.
+	EvictOldest
+)
+
+// PoolOption sets an optional parameter on the evidence pool.
+type PoolOption func(*Pool)
+
+// WithVerifier replaces the pool's built-in verification of evidence, which
+// checks the evidence against the state and block stores, with the given
+// verifier. This allows verifying new kinds of evidence or stubbing out
+// verification in tests.
+func WithVerifier(verifier Verifier) PoolOption {
+	return func(evpool *Pool) { evpool.verifier = verifier }
+}
+
+// WithSecondaryValidatorSetProvider enables the multi-verifier mode. Every
+// validator set used during verification is loaded from both the state store
+// and the given provider, and evidence is only accepted if the two agree. This
+// guards against a compromised or corrupted local state store.
+func WithSecondaryValidatorSetProvider(provider ValidatorSetProvider) PoolOption {
+	return func(evpool *Pool) { evpool.secondaryValidators = provider }
+}
+
+// WithClock sets the clock the pool uses to record when evidence was seen or
+// removed and for background pruning. Evidence is otherwise verified and expired
+// against the last block. It defaults to time.Now.
+func WithClock(now func() time.Time) PoolOption {
+	return func(evpool *Pool) { evpool.now = now }
+}
+
+// WithLightClientAttackExpiryBasis sets the height from which the age of light
+// client attack evidence is measured. It defaults to ExpireFromCommonHeight.
+func WithLightClientAttackExpiryBasis(basis LightClientAttackExpiryBasis) PoolOption {
+	return func(evpool *Pool) { evpool.lcaExpiryBasis = basis }
+}
+
+// WithExpiryOverrides sets the maximum age of evidence of the given types,
+// overriding the evidence consensus params.
+func WithExpiryOverrides(overrides map[EvidenceType]ExpiryParams) PoolOption {
+	return func(evpool *Pool) {
+		evpool.expiryOverrides = make(map[EvidenceType]ExpiryParams, len(overrides))
+		for evType, params := range overrides {
+			evpool.expiryOverrides[evType] = params
+		}
+	}
+}
+
+// WithStoreRetryTimeout makes AddEvidence block and retry for up to timeout
+// while the evidence store returns temporary errors (errors with a Temporary()
+// method returning true), instead of failing immediately. Once the timeout is
+// exceeded, ErrStoreUnavailable is returned. The timeout is measured with the
+// pool clock, see WithClock. Retrying is disabled by default.
+func WithStoreRetryTimeout(timeout time.Duration) PoolOption {
+	return func(evpool *Pool) { evpool.storeRetryTimeout = timeout }
+}
+
+// WithMaxListedEvidence caps the number of evidence returned by
+// PendingEvidence and related methods at maxNum, in addition to the byte limit.
+// Unlike WithMaxPendingEvidence, it doesn't limit the evidence the pool holds.
+// By default there's no cap.
+func WithMaxListedEvidence(maxNum int) PoolOption {
+	return func(evpool *Pool) { evpool.maxListedEvidence = maxNum }
+}
+
+// WithPendingEvidenceOrder sets the order in which pending evidence is returned
+// for proposal. It defaults to OrderByAge. Other orders than OrderByAge decode
+// all pending evidence before applying the limits.
+func WithPendingEvidenceOrder(order PendingEvidenceOrder) PoolOption {
+	return func(evpool *Pool) { evpool.pendingOrder = order }
+}
+
+// WithEligibilityDelay sets the number of heights that pending evidence waits
+// after it was added before it is proposed, like evidence from consensus does.
+// It is still gossiped in the meantime. It defaults to 0.
+func WithEligibilityDelay(heights int64) PoolOption {
+	return func(evpool *Pool) { evpool.eligibilityDelay = heights }
+}
+
+// WithStrictDecoding makes methods listing evidence fail on stored entries that
+// can't be decoded, rather than logging and skipping them.
+func WithStrictDecoding(strict bool) PoolOption {
+	return func(evpool *Pool) { evpool.strictDecoding = strict }
+}
+
+// WithMaxByzantineValidators limits the number of byzantine validators of
+// light client attack evidence in blocks passed to CheckEvidence. Evidence
+// accusing more validators is rejected as invalid before it is verified. The
+// default is types.MaxVotesCount and 0 means there's no limit.
+func WithMaxByzantineValidators(max int) PoolOption {
+	return func(evpool *Pool) { evpool.maxByzantineValidators = max }
+}
+
+// WithMaxEvidenceBytes limits the encoded size of evidence in blocks passed to
+// CheckEvidence. Larger evidence is rejected as invalid before it is verified.
+// By default the limit is the MaxBytes evidence consensus param, the most
+// evidence a block may hold.
+func WithMaxEvidenceBytes(bytes int64) PoolOption {
+	return func(evpool *Pool) { evpool.maxEvidenceBytes = bytes }
+}
+
+// WithPrunedEvidencePolicy sets how the pool handles evidence for a height below
+// the earliest block retained by the block store. It defaults to
+// RejectPrunedEvidence.
+func WithPrunedEvidencePolicy(policy PrunedEvidencePolicy) PoolOption {
+	return func(evpool *Pool) { evpool.prunedEvidencePolicy = policy }
+}
+
+// WithMutationBufferSize sets the number of events buffered for each consumer
+// of MutationStream before events are dropped. It defaults to 1000.
+func WithMutationBufferSize(size int) PoolOption {
+	return func(evpool *Pool) { evpool.mutationBufferSize = size }
+}
+
+// WithValidatorSetCacheSize sets the number of validator sets, keyed by height,
+// the pool caches to avoid loading them repeatedly when verifying evidence. It
+// defaults to 100. A size of 0 disables the cache.
+func WithValidatorSetCacheSize(size int) PoolOption {
+	return func(evpool *Pool) { evpool.valSetCache = newValSetCache(size) }
+}
+
+// WithSyncSignal makes CheckEvidence trust evidence in blocks, only checking it
+// for consistency and duplicates, while syncing returns true.
+func WithSyncSignal(syncing func() bool) PoolOption {
+	return func(evpool *Pool) { evpool.syncing = syncing }
+}
+
+// WithTombstoneRetention sets the number of blocks for which the pool keeps a
+// record of why pending evidence was removed, see RemovalInfo. It defaults to
+// 1000.
+func WithTombstoneRetention(blocks int64) PoolOption {
+	return func(evpool *Pool) { evpool.tombstoneRetention = blocks }
+}
+
+// WithCommittedRetention sets the number of blocks after its height for which
+// committed evidence is kept. It should exceed the maximum age of evidence. It
+// defaults to 0, which keeps committed evidence forever.
+func WithCommittedRetention(blocks int64) PoolOption {
+	return func(evpool *Pool) { evpool.committedRetention = blocks }
+}
+
+// WithCommittedEvidenceCopies sets whether the pool keeps a copy of committed
+// evidence for CommittedEvidence rather than only its height. It defaults to
+// false.
+func WithCommittedEvidenceCopies(keep bool) PoolOption {
+	return func(evpool *Pool) { evpool.keepCommittedEvidence = keep }
+}
+
+// WithBlockStoreCommittedLookup sets whether evidence that the pool hasn't
+// marked as committed is looked up in the blocks of the block store before it's
+// accepted, so that a node started from state sync doesn't accept evidence
+// committed before it joined. It defaults to false.
+func WithBlockStoreCommittedLookup(lookup bool) PoolOption {
+	return func(evpool *Pool) { evpool.blockStoreCommittedLookup = lookup }
+}
+
+// WithEvictionPolicy sets what happens to new evidence added through
+// AddEvidence or AddEvidenceBatch once the pool is full. It defaults to
+// RejectNew.
+func WithEvictionPolicy(policy EvictionPolicy) PoolOption {
+	return func(evpool *Pool) { evpool.evictionPolicy = policy }
+}
+
+// WithEvidenceOverhead sets a number of bytes added to the size of each
+// evidence when filling up a byte budget, to account for encoding overhead. It
+// defaults to 0.
+func WithEvidenceOverhead(bytes int64) PoolOption {
+	return func(evpool *Pool) { evpool.evidenceOverhead = bytes }
+}
+
+// WithMaxExpiredPerUpdate limits the number of expired evidence that Update
+// prunes at once. The rest is pruned by later calls. By default there's no
+// limit.
+func WithMaxExpiredPerUpdate(limit int) PoolOption {
+	return func(evpool *Pool) { evpool.maxExpiredPerUpdate = limit }
+}
+
+// WithBackgroundPruning makes the pool prune expired pending evidence every
+// interval once StartPruning is called, rather than only on Update. By
+// default there's no background pruning.
+func WithBackgroundPruning(interval time.Duration) PoolOption {
+	return func(evpool *Pool) { evpool.pruneInterval = interval }
+}
+
+// WithMaxPendingEvidence limits the number of pending evidence to maxNum. A full
+// pool handles new evidence according to WithEvictionPolicy. By default there's
+// no limit.
+func WithMaxPendingEvidence(maxNum uint32) PoolOption {
+	return func(evpool *Pool) { evpool.maxPendingEvidence = maxNum }
+}
+
+// WithPressureThresholds sets the high- and low-water marks of the pending
+// evidence for UnderPressure and PressureChan. By default the pool is never
+// under pressure.
+func WithPressureThresholds(thresholds PressureThresholds) PoolOption {
+	return func(evpool *Pool) {
+		if thresholds.LowSize > thresholds.HighSize {
+			thresholds.LowSize = thresholds.HighSize
+		}
+		if thresholds.LowBytes > thresholds.HighBytes {
+			thresholds.LowBytes = thresholds.HighBytes
+		}
+		evpool.pressureThresholds = thresholds
+	}
+}
+
+// WithMaxConsensusBufferSize limits the number of conflicting vote pairs from
+// consensus that are buffered until the next height. Further pairs are dropped
+// with a logged error. It defaults to 1000. A size of 0 disables the limit.
+func WithMaxConsensusBufferSize(size int) PoolOption {
+	return func(evpool *Pool) { evpool.maxConsensusBufferSize = size }
+}
+
+// WithBufferConsensusEvidence sets whether ReportConflictingVotes buffers the
+// votes of committed heights until the next Update, rather than adding their
+// evidence right away. The votes of the height in progress are buffered either
+// way, as their evidence can't be formed before the time of its block is known.
+// Disabling the buffer isn't safe with more than one validator: evidence is then
+// gossiped and proposed as soon as a node sees it rather than a height later, so
+// nodes may propose different sets of evidence. It defaults to true.
+func WithBufferConsensusEvidence(buffer bool) PoolOption {
+	return func(evpool *Pool) { evpool.bufferConsensusEvidence = buffer }
+}
+
+// WithVerificationConcurrency limits the number of evidence verified at a
+// time. It defaults to the number of CPUs and 0 disables it.
+func WithVerificationConcurrency(limit int) PoolOption {
+	return func(evpool *Pool) { evpool.verificationConcurrency = limit }
+}
+
+// WithChainIDPrefix prefixes all keys the pool writes with the chain ID, so
+// that the pools of several chains can share an evidence store. Unprefixed keys
+// are moved under the prefix when the pool is created, so the store can't be
+// shared with a pool without a prefix.
+func WithChainIDPrefix(chainID string) PoolOption {
+	return func(evpool *Pool) { evpool.chainID = chainID }
+}
+
+// WithMetrics sets the metrics.
+func WithMetrics(metrics *Metrics) PoolOption {
+	return func(evpool *Pool) { evpool.metrics = metrics }
+}
@@ -2,8 +2,10 @@ package evidence
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"runtime"
 	"sort"
 	"sync"
 	"sync/atomic"
@@ -14,6 +16,8 @@ import (
 	"github.com/google/orderedcode"
 	dbm "github.com/tendermint/tm-db"
 
+	"github.com/tendermint/tendermint/crypto/tmhash"
+	tmbytes "github.com/tendermint/tendermint/libs/bytes"
 	clist "github.com/tendermint/tendermint/libs/clist"
 	"github.com/tendermint/tendermint/libs/log"
 	tmproto "github.com/tendermint/tendermint/proto/tendermint/types"
@@ -21,85 +25,350 @@ import (
 	"github.com/tendermint/tendermint/types"
 )
 
+// Key prefixes of the evidence pool. Unless noted otherwise, keys have the form
+// (prefix, height, hash), encoded with orderedcode. With WithChainIDPrefix, all
+// keys are written under (prefixChain, chainID) instead.
 const (
-	// prefixes are unique across all tm db's
-	prefixCommitted = int64(8)
-	prefixPending   = int64(9)
+	// prefixes are unique across all tm db's: 0-4 are used by the block store,
+	// 5-7 by the state store and 10-11 by the light client store
+	prefixCommitted         = int64(8)
+	prefixPending           = int64(9)
+	prefixInfo              = int64(12)
+	prefixTombstone         = int64(13) // height is the removal height
+	prefixPruning           = int64(14) // single key, the prefix alone
+	prefixVotes             = int64(15) // hash is that of the votes
+	prefixCommittedEvidence = int64(16)
+	prefixHashIndex         = int64(17) // (prefix, hash) to the pending key
+	prefixQuarantine        = int64(18)
+	prefixChain             = int64(19)
+	prefixVersion           = int64(20) // single key, see schemaVersion
 )
 
+// poolPrefixes are all the key prefixes written by the pool. prefixChain isn't
+// one of them, as the keys under it belong to the pools of other chains, and
+// neither is prefixVersion, as the version belongs to the store rather than to
+// the evidence in it.
+var poolPrefixes = []int64{
+	prefixCommitted, prefixPending, prefixInfo, prefixTombstone, prefixPruning, prefixVotes,
+	prefixCommittedEvidence, prefixHashIndex, prefixQuarantine,
+}
+
 // Pool maintains a pool of valid evidence to be broadcasted and committed
+//
+// Its locks are acquired in the order pruneMtx, unpersistedMtx, mtx. No lock
+// is acquired while holding any of its other mutexes or those of its caches
+// and subscribers.
 type Pool struct {
+	// total size of the pending evidence in bytes. Accessed atomically and
+	// kept first for 64-bit alignment.
+	pendingBytes int64
+
 	logger log.Logger
 
 	evidenceStore dbm.DB
 	evidenceList  *clist.CList // concurrent linked-list of evidence
 	evidenceSize  uint32       // amount of pending evidence
+	committedCh   chan types.Evidence
+
+	// the store passed to NewPool, which evidenceStore prefixes with the chain
+	// ID if it's set
+	rawStore dbm.DB
+	chainID  string
+
+	// set by NewPoolReadOnly; the pool then has no state and never writes to
+	// the store
+	readOnly bool
 
 	// needed to load validators to verify evidence
 	stateDB sm.Store
 	// needed to load headers and commits to verify evidence
 	blockStore BlockStore
 
-	mtx sync.Mutex
+	// guards state, consensusBuffer, expiryTime and onInvalidEvidence. Pure
+	// reads only take the read lock.
+	mtx sync.RWMutex
 	// latest state
 	state sm.State
 	// evidence from consensus is buffered to this slice, awaiting until the next height
 	// before being flushed to the pool. This prevents broadcasting and proposing of
 	// evidence before the height with which the evidence happened is finished.
 	consensusBuffer []duplicateVoteSet
-
+	// maximum length of consensusBuffer. 0 means there's no limit.
+	maxConsensusBufferSize int
+	// whether votes of committed heights are buffered as well
+	bufferConsensusEvidence bool
+
+	// height and time after which pending evidence expires next, see
+	// NextPrune
+	pruningMtx    sync.Mutex
 	pruningHeight int64
 	pruningTime   time.Time
+	// maximum number of expired evidence pruned at a time. 0 means there's no
+	// limit.
+	maxExpiredPerUpdate int
+
+	// serializes Update, the background pruner and the removal of pending
+	// evidence
+	pruneMtx sync.Mutex
+	// how often the background pruner runs, see StartPruning. 0 disables it.
+	pruneInterval time.Duration
+	// closed to stop the background pruner and once it has stopped. Nil while
+	// it isn't running. Guarded by pruneMtx.
+	pruneQuit chan struct{}
+	pruneDone chan struct{}
+
+	// amount of quarantined evidence, see RetryQuarantined
+	quarantineSize uint32
+
+	// amount of committed evidence, see CommittedCount. It's only maintained
+	// once it has been counted.
+	committedCountMtx sync.Mutex
+	committedCount    uint32
+	committedCounted  bool
+
+	// verified evidence from blocks that couldn't be stored as pending, by
+	// evMapKey, so that it needn't be verified again until it's committed
+	unpersistedMtx sync.Mutex
+	unpersisted    map[string]types.Evidence
+
+	// latest block time seen, against which evidence expires. Unlike the block
+	// time of the state it never goes backwards.
+	expiryTime time.Time
+
+	// verifies evidence instead of the built-in verification if set
+	verifier Verifier
+
+	// called with evidence that fails verification, guarded by mtx
+	onInvalidEvidence func(ev types.Evidence, reason error, source string)
+
+	// maximum number of evidence verified at a time and the semaphore enforcing
+	// it. 0 means there's no limit and a nil semaphore.
+	verificationConcurrency int
+	verificationSem         chan struct{}
+
+	// optional second source of validator sets which must agree with stateDB
+	// for evidence to be accepted
+	secondaryValidators ValidatorSetProvider
+
+	// clock used to record when evidence was first seen
+	now func() time.Time
+
+	// height from which light client attack evidence ages
+	lcaExpiryBasis LightClientAttackExpiryBasis
+
+	// maximum age of evidence by type, overriding the consensus params
+	expiryOverrides map[EvidenceType]ExpiryParams
+
+	// order in which pending evidence is proposed
+	pendingOrder PendingEvidenceOrder
+
+	// validators whose evidence is proposed first, as set by
+	// SetPriorityValidators
+	priorityMtx        sync.Mutex
+	priorityValidators map[string]struct{}
+
+	// number of heights after it was added before pending evidence is proposed
+	eligibilityDelay int64
+
+	// whether listing evidence fails on entries that can't be decoded rather
+	// than skipping them
+	strictDecoding bool
+
+	// how long to keep retrying writes while the store is temporarily
+	// unavailable. Zero disables retrying.
+	storeRetryTimeout time.Duration
+
+	// maximum number of evidence returned when listing pending evidence. -1
+	// means there's no cap.
+	maxListedEvidence int
+
+	// how to handle evidence below the earliest retained block
+	prunedEvidencePolicy PrunedEvidencePolicy
+
+	// bounds on evidence from blocks checked before verifying it. A zero
+	// maxByzantineValidators means there's no limit, while a zero
+	// maxEvidenceBytes means the MaxBytes evidence consensus param.
+	maxByzantineValidators int
+	maxEvidenceBytes       int64
+
+	// validator sets loaded for verification
+	valSetCache *valSetCache
+
+	// validators implicated by pending evidence
+	accused accusedSet
+
+	// reports whether the node is syncing blocks. Nil means never.
+	syncing func() bool
+
+	// number of blocks for which removal records are kept
+	tombstoneRetention int64
+
+	// number of blocks for which committed evidence is kept. 0 means forever.
+	committedRetention int64
+
+	// whether a copy of committed evidence is kept besides its height
+	keepCommittedEvidence bool
+
+	// whether evidence that isn't marked as committed is looked up in the
+	// blocks of the block store, and how far it has been looked up
+	blockStoreCommittedLookup bool
+	committedLookups          *lookupCache
+
+	// maximum number of pending evidence. 0 means there's no limit.
+	maxPendingEvidence uint32
+
+	// what happens to new evidence once the pool is full
+	evictionPolicy EvictionPolicy
+
+	// marks at which the pool comes under and is relieved of pressure, whether
+	// it is under pressure and the channel that is closed while it is
+	pressureThresholds PressureThresholds
+	pressureMtx        sync.Mutex
+	underPressure      bool
+	pressureCh         chan struct{}
+
+	// bytes added to the size of each evidence when listing evidence up to a
+	// byte budget
+	evidenceOverhead int64
+
+	metrics *Metrics
+
+	closeOnce sync.Once
+	closeErr  error
+
+	// consumers of MutationStream
+	subscribersMtx     sync.Mutex
+	subscribers        map[*mutationSubscriber]struct{}
+	mutationBufferSize int
+
+	// consumers of Subscribe
+	eventSubscribersMtx sync.Mutex
+	eventSubscribers    map[*eventSubscriber]struct{}
 }
 
 // NewPool creates an evidence pool. If using an existing evidence store,
-// it will add all pending evidence to the concurrent list.
-func NewPool(logger log.Logger, evidenceDB dbm.DB, stateDB sm.Store, blockStore BlockStore) (*Pool, error) {
+// it will add all pending evidence to the concurrent list. Stores written by an
+// older version are migrated first. Only one pool may be open on a store and
+// chain ID prefix at a time, see ErrPoolAlreadyOpen, so Close must be called
+// once the pool is no longer needed, even if its node fails to start.
+func NewPool(
+	logger log.Logger,
+	evidenceDB dbm.DB,
+	stateDB sm.Store,
+	blockStore BlockStore,
+	options ...PoolOption,
+) (*Pool, error) {
 	state, err := stateDB.Load()
 	if err != nil {
 		return nil, fmt.Errorf("failed to load state: %w", err)
 	}
+	return newPool(logger, evidenceDB, stateDB, blockStore, state, false, options)
+}
+
+// NewPoolReadOnly opens an evidence pool on evidenceDB without a state store
+// or block store, for example to inspect the evidence of a node. Evidence can be
+// listed, looked up and exported, but methods that add, check, verify or remove
+// evidence return ErrReadOnly, and the store is never written to.
+func NewPoolReadOnly(logger log.Logger, evidenceDB dbm.DB, options ...PoolOption) (*Pool, error) {
+	return newPool(logger, evidenceDB, nil, nil, sm.State{}, true, options)
+}
 
+func newPool(
+	logger log.Logger,
+	evidenceDB dbm.DB,
+	stateDB sm.Store,
+	blockStore BlockStore,
+	state sm.State,
+	readOnly bool,
+	options []PoolOption,
+) (_ *Pool, err error) {
 	pool := &Pool{
-		stateDB:         stateDB,
-		blockStore:      blockStore,
-		state:           state,
-		logger:          logger,
-		evidenceStore:   evidenceDB,
-		evidenceList:    clist.New(),
-		consensusBuffer: make([]duplicateVoteSet, 0),
+		stateDB:                 stateDB,
+		blockStore:              blockStore,
+		state:                   state,
+		expiryTime:              state.LastBlockTime,
+		logger:                  logger,
+		evidenceStore:           evidenceDB,
+		rawStore:                evidenceDB,
+		readOnly:                readOnly,
+		evidenceList:            clist.New(),
+		committedCh:             make(chan types.Evidence, committedEvidenceBufferSize),
+		pressureCh:              make(chan struct{}),
+		consensusBuffer:         make([]duplicateVoteSet, 0),
+		maxConsensusBufferSize:  defaultMaxConsensusBufferSize,
+		bufferConsensusEvidence: true,
+		now:                     time.Now,
+		maxListedEvidence:       -1,
+		maxByzantineValidators:  types.MaxVotesCount,
+		mutationBufferSize:      defaultMutationBufferSize,
+		valSetCache:             newValSetCache(defaultValidatorSetCacheSize),
+		committedLookups:        newLookupCache(committedLookupCacheSize),
+		tombstoneRetention:      defaultTombstoneRetention,
+		verificationConcurrency: runtime.NumCPU(),
+		metrics:                 NopMetrics(),
+	}
+
+	for _, option := range options {
+		option(pool)
+	}
+
+	if err := acquireStore(evidenceDB, pool.chainID); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			releaseStore(evidenceDB, pool.chainID)
+		}
+	}()
+
+	if pool.chainID != "" {
+		namespace := keyChain(pool.chainID)
+		if !pool.readOnly {
+			if err := moveUnprefixedKeys(evidenceDB, namespace); err != nil {
+				return nil, err
+			}
+		}
+		pool.evidenceStore = dbm.NewPrefixDB(evidenceDB, namespace)
+	}
+
+	if err := pool.migrateStore(); err != nil {
+		return nil, err
+	}
+
+	if pool.verificationConcurrency > 0 {
+		pool.verificationSem = make(chan struct{}, pool.verificationConcurrency)
 	}
 
+	pool.probeForeignKeys()
+
 	// If pending evidence already in db, in event of prior failure, then check
 	// for expiration, update the size and load it back to the evidenceList.
-	pool.pruningHeight, pool.pruningTime = pool.removeExpiredPendingEvidence()
-	evList, _, err := pool.listEvidence(prefixPending, -1)
-	if err != nil {
+	if err := pool.loadPendingEvidence(); err != nil {
 		return nil, err
 	}
 
-	atomic.StoreUint32(&pool.evidenceSize, uint32(len(evList)))
+	// restore the conflicting votes that were buffered when the pool was
+	// closed, which a read-only pool can't turn into evidence
+	if !pool.readOnly {
+		if err := pool.loadConsensusBuffer(); err != nil {
+			return nil, err
+		}
+	}
 
-	for _, ev := range evList {
-		pool.evidenceList.PushBack(ev)
+	if err := pool.countQuarantined(); err != nil {
+		return nil, err
 	}
 
 	return pool, nil
 }
 
-// PendingEvidence is used primarily as part of block proposal and returns up to
-// maxNum of uncommitted evidence.
+// PendingEvidence is used primarily as part of block proposal and returns
+// uncommitted evidence within maxBytes. With the default OrderByAge the
+// evidence is ordered by height and then by hash, so that every node with the
+// same pending evidence proposes the same evidence in the same order, unless
+// priority validators are set with SetPriorityValidators.
 func (evpool *Pool) PendingEvidence(maxBytes int64) ([]types.Evidence, int64) {
-	if evpool.Size() == 0 {
-		return []types.Evidence{}, 0
-	}
-
-	evidence, size, err := evpool.listEvidence(prefixPending, maxBytes)
-	if err != nil {
-		evpool.logger.Error("failed to retrieve pending evidence", "err", err)
-	}
-
-	return evidence, size
+	return evpool.PendingEvidenceWithLimit(maxBytes, 0)
 }
 
 // Update takes both the new state and the evidence committed at that height and performs
@@ -110,6 +379,14 @@ func (evpool *Pool) PendingEvidence(maxBytes int64) ([]types.Evidence, int64) {
 // 3. Moves pending evidence that has now been committed into the committed pool.
 // 4. Removes any expired evidence based on both height and time.
 func (evpool *Pool) Update(state sm.State, ev types.EvidenceList) {
+	if evpool.readOnly {
+		evpool.logger.Error("ignoring update of read-only evidence pool", "height", state.LastBlockHeight)
+		return
+	}
+
+	evpool.pruneMtx.Lock()
+	defer evpool.pruneMtx.Unlock()
+
 	// sanity check
 	if state.LastBlockHeight <= evpool.state.LastBlockHeight {
 		panic(fmt.Sprintf(
@@ -125,6 +402,11 @@ func (evpool *Pool) Update(state sm.State, ev types.EvidenceList) {
 		"last_block_time", state.LastBlockTime,
 	)
 
+	// evidence expires at a different point if its maximum age changed
+	if evpool.EvidenceParams() != state.ConsensusParams.Evidence {
+		evpool.setPruningPoint(0, time.Time{})
+	}
+
 	// flush conflicting vote pairs from the buffer, producing DuplicateVoteEvidence and
 	// adding it to the pool
 	evpool.processConsensusBuffer(state)
@@ -133,47 +415,133 @@ func (evpool *Pool) Update(state sm.State, ev types.EvidenceList) {
 
 	// move committed evidence out from the pending pool and into the committed pool
 	evpool.markEvidenceAsCommitted(ev)
+	evpool.retryUnpersisted(ev)
 
 	// Prune pending evidence when it has expired. This also updates when the next
 	// evidence will expire.
-	if evpool.Size() > 0 && state.LastBlockHeight > evpool.pruningHeight &&
-		state.LastBlockTime.After(evpool.pruningTime) {
-		evpool.pruningHeight, evpool.pruningTime = evpool.removeExpiredPendingEvidence()
+	pruningHeight, pruningTime := evpool.NextPrune()
+	if evpool.Size() > 0 && state.LastBlockHeight > pruningHeight && evpool.expiryTime.After(pruningTime) {
+		evpool.setPruningPoint(evpool.removeExpiredPendingEvidence(evpool.expiryTime))
+		evpool.savePruningPoint()
+	}
+
+	// forget committed evidence and why evidence was removed once old enough
+	evpool.pruneCommittedEvidence(state.LastBlockHeight)
+	evpool.pruneTombstones(state.LastBlockHeight)
+
+	// the validator sets of quarantined evidence may be available by now
+	if atomic.LoadUint32(&evpool.quarantineSize) > 0 {
+		if err := evpool.RetryQuarantined(); err != nil {
+			evpool.logger.Error("failed to retry quarantined evidence", "err", err)
+		}
 	}
 }
 
-// AddEvidence checks the evidence is valid and adds it to the pool.
+// AddEvidence checks the evidence is valid and adds it to the pool. Evidence
+// that is already pending is ignored. Invalid evidence is reported with a
+// *types.ErrInvalidEvidence error, for which the sender may be punished, and
+// expired evidence with ErrStaleEvidence. Evidence that can't be verified yet is
+// quarantined, see RetryQuarantined.
 func (evpool *Pool) AddEvidence(ev types.Evidence) error {
-	evpool.logger.Debug("attempting to add evidence", "evidence", ev)
+	return evpool.AddEvidenceCtx(context.Background(), ev)
+}
+
+// AddEvidenceCtx is like AddEvidence but gives up once ctx is done, returning
+// ctx.Err(). The context is checked before and after verifying the evidence and
+// while waiting for a temporarily unavailable store, so evidence is never
+// persisted once ctx is done.
+func (evpool *Pool) AddEvidenceCtx(ctx context.Context, ev types.Evidence) error {
+	return evpool.addEvidence(ctx, ev, true)
+}
+
+// AddVerifiedEvidence adds evidence that the caller has already verified to
+// the pool without verifying it, and is otherwise like AddEvidence. Proposing
+// invalid evidence gets the node disconnected by its peers, so it must only be
+// used with evidence known to be valid under the current state.
+func (evpool *Pool) AddVerifiedEvidence(ev types.Evidence) error {
+	return evpool.addEvidence(context.Background(), ev, false)
+}
+
+// addEvidence adds the evidence to the pool, verifying it first if verify is
+// true.
+func (evpool *Pool) addEvidence(ctx context.Context, ev types.Evidence, verify bool) error {
+	evpool.logger.Debug("attempting to add evidence", evLogFields(ev)...)
+
+	if evpool.readOnly {
+		return ErrReadOnly
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := checkKeyable(ev); err != nil {
+		return err
+	}
 
 	// We have already verified this piece of evidence - no need to do it again
-	if evpool.isPending(ev) {
-		evpool.logger.Debug("evidence already pending; ignoring", "evidence", ev)
+	pending, err := evpool.checkPending(ev)
+	if err != nil {
+		return err
+	}
+	if pending {
+		evpool.logger.Debug("evidence already pending; ignoring", evLogFields(ev)...)
 		return nil
 	}
 
 	// check that the evidence isn't already committed
-	if evpool.isCommitted(ev) {
+	committed, err := evpool.checkCommitted(ev)
+	if err != nil {
+		return err
+	}
+	if committed {
 		// This can happen if the peer that sent us the evidence is behind so we
 		// shouldn't punish the peer.
-		evpool.logger.Debug("evidence was already committed; ignoring", "evidence", ev)
-		return nil
+		evpool.logger.Debug("evidence was already committed; ignoring", evLogFields(ev)...)
+		return ErrAlreadyCommitted
 	}
 
-	// 1) Verify against state.
-	if err := evpool.verify(ev); err != nil {
-		return err
+	// don't bother verifying evidence that can't be stored
+	if evpool.rejectsNewEvidence() {
+		return ErrEvidencePoolFull
 	}
 
-	// 2) Save to store.
-	if err := evpool.addPendingEvidence(ev); err != nil {
-		return fmt.Errorf("failed to add evidence to pending list: %w", err)
+	// 1) Verify against state. Expired evidence is reported as stale rather than
+	// invalid, so that the sender isn't punished for it.
+	if verify {
+		if err := evpool.verify(ev); err != nil {
+			quarantined, err := evpool.quarantine(ev, staleOrInvalid(err))
+			if !quarantined {
+				evpool.verificationFailed(ev, err, EvidenceSourceGossip)
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+
+	// 2) Make room if need be and save to store.
+	if evpool.isFull() && evpool.evictionPolicy == EvictOldest {
+		evpool.evictOldest(1)
+	}
+	addedHeight := evpool.State().LastBlockHeight
+	err = evpool.withStoreRetry(ctx, func() error { return evpool.addPendingEvidence(ev, false, addedHeight) })
+	switch {
+	case errors.Is(err, ErrEvidencePoolFull):
+		return err
+	case err != nil:
+		return persistError{err}
+	default:
+		evpool.schedulePruning(ev, evpool.EvidenceParams())
 	}
 
 	// 3) Add evidence to clist.
 	evpool.evidenceList.PushBack(ev)
 
-	evpool.logger.Info("verified new evidence of byzantine behavior", "evidence", ev)
+	if verify {
+		evpool.logger.Info("verified new evidence of byzantine behavior", evLogFields(ev)...)
+	} else {
+		evpool.logger.Info("added pre-verified evidence of byzantine behavior", evLogFields(ev)...)
+	}
 	return nil
 }
 
@@ -183,55 +551,90 @@ func (evpool *Pool) AddEvidence(ev types.Evidence) error {
 // Duplicate vote attacks happen before the block is committed and the timestamp is
 // finalized, thus the evidence pool holds these votes in a buffer, forming the
 // evidence from them once consensus at that height has been reached and `Update()` with
-// the new state called.
-//
-// Votes are not verified.
+// the new state called. Votes are not verified.
 func (evpool *Pool) ReportConflictingVotes(voteA, voteB *types.Vote) {
+	if evpool.readOnly {
+		evpool.logger.Error("ignoring conflicting votes reported to read-only evidence pool",
+			"vote_a", voteA, "vote_b", voteB)
+		return
+	}
+
 	evpool.mtx.Lock()
 	defer evpool.mtx.Unlock()
-	evpool.consensusBuffer = append(evpool.consensusBuffer, duplicateVoteSet{
-		VoteA: voteA,
-		VoteB: voteB,
-	})
+
+	voteSet := duplicateVoteSet{VoteA: voteA, VoteB: voteB}
+	if !evpool.bufferConsensusEvidence && voteA.Height <= evpool.state.LastBlockHeight {
+		evpool.addEvidenceFromVotes(voteSet, evpool.state)
+		return
+	}
+	for _, buffered := range evpool.consensusBuffer {
+		if buffered.sameVotes(voteSet) {
+			evpool.logger.Debug("conflicting votes already buffered; ignoring", "vote_a", voteA, "vote_b", voteB)
+			return
+		}
+	}
+	if evpool.maxConsensusBufferSize > 0 && len(evpool.consensusBuffer) >= evpool.maxConsensusBufferSize {
+		evpool.logger.Error("consensus buffer is full; dropping conflicting votes",
+			"max_size", evpool.maxConsensusBufferSize, "vote_a", voteA, "vote_b", voteB)
+		return
+	}
+
+	evpool.consensusBuffer = append(evpool.consensusBuffer, voteSet)
+	evpool.metrics.ConsensusBufferSize.Set(float64(len(evpool.consensusBuffer)))
 }
 
 // CheckEvidence takes an array of evidence from a block and verifies all the evidence there.
 // If it has already verified the evidence then it jumps to the next one. It ensures that no
 // evidence has already been committed or is being proposed twice. It also adds any
 // evidence that it doesn't currently have so that it can quickly form ABCI Evidence later.
+// Evidence that can't be stored is kept in memory instead until it is committed or expires.
 func (evpool *Pool) CheckEvidence(evList types.EvidenceList) error {
-	hashes := make([][]byte, len(evList))
-	for idx, ev := range evList {
-
-		ok := evpool.fastCheck(ev)
+	if evpool.readOnly {
+		return ErrReadOnly
+	}
+	seen := make(map[string]struct{}, len(evList))
+	for _, ev := range evList {
+		if err := evpool.checkBlockEvidence(ev); err != nil {
+			return err
+		}
 
-		if !ok {
-			// check that the evidence isn't already committed
-			if evpool.isCommitted(ev) {
-				return &types.ErrInvalidEvidence{Evidence: ev, Reason: errors.New("evidence was already committed")}
-			}
+		// check for duplicate evidence
+		if isDuplicate(seen, ev) {
+			return &types.ErrInvalidEvidence{Evidence: ev, Reason: errors.New("duplicate evidence")}
+		}
+	}
 
-			err := evpool.verify(ev)
-			if err != nil {
-				return err
-			}
+	return nil
+}
 
-			if err := evpool.addPendingEvidence(ev); err != nil {
-				// Something went wrong with adding the evidence but we already know it is valid
-				// hence we log an error and continue
-				evpool.logger.Error("failed to add evidence to pending list", "err", err, "evidence", ev)
-			}
+// checkNewEvidence fully verifies evidence from a block that the pool doesn't
+// have yet and adds it to the pending pool.
+func (evpool *Pool) checkNewEvidence(ev types.Evidence) error {
+	err := evpool.verify(ev)
+	switch {
+	case errors.Is(err, ErrBelowRetainedHeight) &&
+		evpool.prunedEvidencePolicy == TrustPrunedEvidenceFromConsensus:
+		// The evidence can't be verified, so it is not added to the pending
+		// pool to avoid gossiping it.
+		evpool.metrics.FailedVerifications.Add(1)
+		evpool.logger.Info("accepting evidence below the earliest retained block without verification",
+			evLogFields(ev)...)
+
+	case err != nil:
+		evpool.verificationFailed(ev, err, EvidenceSourceBlock)
+		return err
 
-			evpool.logger.Info("verified new evidence of byzantine behavior", "evidence", ev)
+	default:
+		if err := evpool.addPendingEvidence(ev, false, evpool.State().LastBlockHeight); err != nil {
+			// Something went wrong with adding the evidence but we already know it is valid
+			// hence we log an error and continue
+			evpool.logger.Error("failed to add evidence to pending list", append(evLogFields(ev), "err", err)...)
+			evpool.addUnpersisted(ev)
+		} else {
+			evpool.schedulePruning(ev, evpool.EvidenceParams())
 		}
 
-		// check for duplicate evidence. We cache hashes so we don't have to work them out again.
-		hashes[idx] = ev.Hash()
-		for i := idx - 1; i >= 0; i-- {
-			if bytes.Equal(hashes[i], hashes[idx]) {
-				return &types.ErrInvalidEvidence{Evidence: ev, Reason: errors.New("duplicate evidence")}
-			}
-		}
+		evpool.logger.Info("verified new evidence of byzantine behavior", evLogFields(ev)...)
 	}
 
 	return nil
@@ -248,52 +651,97 @@ func (evpool *Pool) EvidenceWaitChan() <-chan struct{} {
 	return evpool.evidenceList.WaitChan()
 }
 
+// WaitForEvidence blocks until the pool lists evidence and returns the first
+// evidence in the list, like EvidenceFront, without removing it. If ctx is done
+// first, its error is returned.
+func (evpool *Pool) WaitForEvidence(ctx context.Context) (types.Evidence, error) {
+	for {
+		if e := evpool.EvidenceFront(); e != nil {
+			return e.Value.(types.Evidence), nil
+		}
+		// the evidence may have been removed again before we got to it, in
+		// which case we wait for the next
+		select {
+		case <-evpool.EvidenceWaitChan():
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// CommittedEvidenceChan returns a channel receiving each evidence as it is
+// marked as committed by Update. It buffers up to 100 evidence and drops further
+// evidence rather than blocking Update. The same channel is returned on every
+// call and is never closed.
+func (evpool *Pool) CommittedEvidenceChan() <-chan types.Evidence {
+	return evpool.committedCh
+}
+
 // Size returns the number of evidence in the pool.
 func (evpool *Pool) Size() uint32 {
 	return atomic.LoadUint32(&evpool.evidenceSize)
 }
 
+// PendingBytes returns the total size of the pending evidence in bytes, as
+// stored by the pool. It moves in step with Size.
+func (evpool *Pool) PendingBytes() int64 {
+	return atomic.LoadInt64(&evpool.pendingBytes)
+}
+
+// decrementSize subtracts n evidence with a total size of size bytes from the
+// pending evidence. Callers must only count evidence they actually deleted
+// from the pending pool. As a guard against the counts drifting, they never
+// drop below zero.
+func (evpool *Pool) decrementSize(n uint32, size int64) {
+	for {
+		pendingBytes := atomic.LoadInt64(&evpool.pendingBytes)
+		newBytes := pendingBytes - size
+		if newBytes < 0 {
+			newBytes = 0
+		}
+		if atomic.CompareAndSwapInt64(&evpool.pendingBytes, pendingBytes, newBytes) {
+			break
+		}
+	}
+	for {
+		size := atomic.LoadUint32(&evpool.evidenceSize)
+		newSize := uint32(0)
+		if size > n {
+			newSize = size - n
+		} else if size < n {
+			evpool.logger.Error("pending evidence count would drop below zero; clamping it",
+				"size", size, "removed", n)
+		}
+		if atomic.CompareAndSwapUint32(&evpool.evidenceSize, size, newSize) {
+			evpool.metrics.Size.Set(float64(newSize))
+			break
+		}
+	}
+	evpool.updatePressure()
+}
+
 // State returns the current state of the evpool.
 func (evpool *Pool) State() sm.State {
-	evpool.mtx.Lock()
-	defer evpool.mtx.Unlock()
+	evpool.mtx.RLock()
+	defer evpool.mtx.RUnlock()
 	return evpool.state
 }
 
+// EvidenceParams returns a copy of the evidence consensus parameters the pool
+// currently enforces, i.e. those of the state passed to the latest Update.
+func (evpool *Pool) EvidenceParams() types.EvidenceParams {
+	evpool.mtx.RLock()
+	defer evpool.mtx.RUnlock()
+	return evpool.state.ConsensusParams.Evidence
+}
+
 // fastCheck leverages the fact that the evidence pool may have already verified
 // the evidence to see if it can quickly conclude that the evidence is already
 // valid.
 func (evpool *Pool) fastCheck(ev types.Evidence) bool {
 	if lcae, ok := ev.(*types.LightClientAttackEvidence); ok {
-		key := keyPending(ev)
-		evBytes, err := evpool.evidenceStore.Get(key)
-		if evBytes == nil { // the evidence is not in the nodes pending list
-			return false
-		}
-
-		if err != nil {
-			evpool.logger.Error("failed to load light client attack evidence", "err", err, "key(height/hash)", key)
-			return false
-		}
-
-		var trustedPb tmproto.LightClientAttackEvidence
-
-		if err = trustedPb.Unmarshal(evBytes); err != nil {
-			evpool.logger.Error(
-				"failed to convert light client attack evidence from bytes",
-				"key(height/hash)", key,
-				"err", err,
-			)
-			return false
-		}
-
-		trustedEv, err := types.LightClientAttackEvidenceFromProto(&trustedPb)
-		if err != nil {
-			evpool.logger.Error(
-				"failed to convert light client attack evidence from protobuf",
-				"key(height/hash)", key,
-				"err", err,
-			)
+		trustedEv, ok := evpool.loadVerifiedLightClientAttack(ev)
+		if !ok {
 			return false
 		}
 
@@ -328,26 +776,88 @@ func (evpool *Pool) fastCheck(ev types.Evidence) bool {
 	}
 
 	// For all other evidence the evidence pool just checks if it is already in
-	// the pending db.
-	return evpool.isPending(ev)
+	// the pending db or kept in memory.
+	if evpool.isPending(ev) {
+		return true
+	}
+	_, ok := evpool.getUnpersisted(ev)
+	return ok
 }
 
-// IsExpired checks whether evidence or a polc is expired by checking whether a height and time is older
-// than set by the evidence consensus parameters
-func (evpool *Pool) isExpired(height int64, time time.Time) bool {
-	var (
-		params       = evpool.State().ConsensusParams.Evidence
-		ageDuration  = evpool.State().LastBlockTime.Sub(time)
-		ageNumBlocks = evpool.State().LastBlockHeight - height
-	)
-	return ageNumBlocks > params.MaxAgeNumBlocks &&
-		ageDuration > params.MaxAgeDuration
+// loadVerifiedLightClientAttack returns the light client attack evidence with
+// the same key as ev that the pool has already verified, from the pending db
+// or kept in memory.
+func (evpool *Pool) loadVerifiedLightClientAttack(ev types.Evidence) (*types.LightClientAttackEvidence, bool) {
+	if unpersisted, ok := evpool.getUnpersisted(ev); ok {
+		lcae, ok := unpersisted.(*types.LightClientAttackEvidence)
+		return lcae, ok
+	}
+
+	key := keyPending(ev)
+	evBytes, err := evpool.evidenceStore.Get(key)
+	if evBytes == nil { // the evidence is not in the nodes pending list
+		return nil, false
+	}
+
+	if err != nil {
+		evpool.logger.Error("failed to load light client attack evidence", append(evLogFields(ev), "err", err)...)
+		return nil, false
+	}
+
+	var trustedPb tmproto.LightClientAttackEvidence
+
+	if err = trustedPb.Unmarshal(evBytes); err != nil {
+		evpool.logger.Error(
+			"failed to convert light client attack evidence from bytes",
+			append(evLogFields(ev), "err", err)...,
+		)
+		return nil, false
+	}
+
+	trustedEv, err := types.LightClientAttackEvidenceFromProto(&trustedPb)
+	if err != nil {
+		evpool.logger.Error(
+			"failed to convert light client attack evidence from protobuf",
+			append(evLogFields(ev), "err", err)...,
+		)
+		return nil, false
+	}
+	return trustedEv, true
+}
+
+// IsExpired checks whether evidence is expired by checking whether its height and time is older
+// than set by the evidence consensus parameters or the expiry override of its type
+func (evpool *Pool) isExpired(ev types.Evidence) bool {
+	evpool.mtx.RLock()
+	now := evpool.expiryTime
+	evpool.mtx.RUnlock()
+	return evpool.isExpiredAt(ev, now)
+}
+
+// IsKnown returns true if the evidence is either pending or committed. DB
+// errors are logged and the evidence is reported as unknown.
+func (evpool *Pool) IsKnown(ev types.Evidence) bool {
+	known, err := evpool.isKnown(ev)
+	if err != nil {
+		evpool.logger.Error("failed to find evidence", append(evLogFields(ev), "err", err)...)
+	}
+	return known
+}
+
+// isKnown is like IsKnown but returns DB errors.
+func (evpool *Pool) isKnown(ev types.Evidence) (bool, error) {
+	pending, err := evpool.checkPending(ev)
+	if err != nil || pending {
+		return pending, err
+	}
+	return evpool.checkCommitted(ev)
 }
 
 // IsCommitted returns true if we have already seen this exact evidence and it is already marked as committed.
+// DB errors are passed to the logger. The block store is never consulted, so
+// it may be called while holding mtx.
 func (evpool *Pool) isCommitted(evidence types.Evidence) bool {
-	key := keyCommitted(evidence)
-	ok, err := evpool.evidenceStore.Has(key)
+	ok, err := evpool.hasCommitted(evidence)
 	if err != nil {
 		evpool.logger.Error("failed to find committed evidence", "err", err)
 	}
@@ -356,15 +866,55 @@ func (evpool *Pool) isCommitted(evidence types.Evidence) bool {
 
 // IsPending checks whether the evidence is already pending. DB errors are passed to the logger.
 func (evpool *Pool) isPending(evidence types.Evidence) bool {
-	key := keyPending(evidence)
-	ok, err := evpool.evidenceStore.Has(key)
+	ok, err := evpool.checkPending(evidence)
 	if err != nil {
 		evpool.logger.Error("failed to find pending evidence", "err", err)
 	}
 	return ok
 }
 
-func (evpool *Pool) addPendingEvidence(ev types.Evidence) error {
+// checkPending is like isPending but returns DB errors.
+func (evpool *Pool) checkPending(evidence types.Evidence) (bool, error) {
+	ok, err := evpool.evidenceStore.Has(keyPending(evidence))
+	if err != nil {
+		return false, fmt.Errorf("failed to find pending evidence: %w", err)
+	}
+	return ok, nil
+}
+
+// addPendingEvidence stores the evidence and its metadata. detectedBySelf is
+// true if the evidence was formed by this node from votes seen in consensus and
+// addedHeight is the last block height at the time the evidence is added.
+func (evpool *Pool) addPendingEvidence(ev types.Evidence, detectedBySelf bool, addedHeight int64) error {
+	if evpool.isFull() {
+		return ErrEvidencePoolFull
+	}
+
+	batch := evpool.evidenceStore.NewBatch()
+	defer batch.Close()
+
+	if err := evpool.setPendingEvidence(batch, ev, detectedBySelf, addedHeight); err != nil {
+		return err
+	}
+	if err := batch.WriteSync(); err != nil {
+		return fmt.Errorf("failed to persist evidence: %w", err)
+	}
+
+	evpool.pendingEvidenceAdded(ev, addedHeight)
+	return nil
+}
+
+// setPendingEvidence adds the evidence and its metadata to the batch.
+func (evpool *Pool) setPendingEvidence(
+	batch dbm.Batch,
+	ev types.Evidence,
+	detectedBySelf bool,
+	addedHeight int64,
+) error {
+	if err := checkKeyable(ev); err != nil {
+		return err
+	}
+
 	evpb, err := types.EvidenceToProto(ev)
 	if err != nil {
 		return fmt.Errorf("failed to convert to proto: %w", err)
@@ -375,53 +925,156 @@ func (evpool *Pool) addPendingEvidence(ev types.Evidence) error {
 		return fmt.Errorf("failed to marshal evidence: %w", err)
 	}
 
-	key := keyPending(ev)
+	info := EvidenceInfo{FirstSeen: evpool.now(), DetectedBySelf: detectedBySelf, AddedHeight: addedHeight}
 
-	err = evpool.evidenceStore.Set(key, evBytes)
-	if err != nil {
+	if err = batch.Set(keyPending(ev), evBytes); err != nil {
 		return fmt.Errorf("failed to persist evidence: %w", err)
 	}
-
-	atomic.AddUint32(&evpool.evidenceSize, 1)
+	if err = batch.Set(keyInfo(ev), info.Bytes()); err != nil {
+		return fmt.Errorf("failed to persist evidence info: %w", err)
+	}
+	if err = batch.Set(keyHashIndex(ev.Hash()), keyPending(ev)); err != nil {
+		return fmt.Errorf("failed to persist hash index: %w", err)
+	}
 	return nil
 }
 
-func (evpool *Pool) removePendingEvidence(evidence types.Evidence) {
-	key := keyPending(evidence)
-	if err := evpool.evidenceStore.Delete(key); err != nil {
+// pendingEvidenceAdded accounts for evidence that was stored as pending at the
+// given height.
+func (evpool *Pool) pendingEvidenceAdded(ev types.Evidence, height int64) {
+	atomic.AddInt64(&evpool.pendingBytes, evidenceBytes(ev))
+	evpool.metrics.Size.Set(float64(atomic.AddUint32(&evpool.evidenceSize, 1)))
+	evpool.updatePressure()
+	evpool.metrics.AddedEvidence.Add(1)
+	evpool.accused.Add(ev)
+	evpool.publishMutation(MutationAdded, ev.Height(), ev.Hash())
+	evpool.publishEvent(TransitionAdded, ev, height)
+}
+
+// removePendingEvidence deletes the evidence and its metadata from the pending
+// pool and records the reason for its removal. It returns false if the
+// evidence couldn't be deleted.
+func (evpool *Pool) removePendingEvidence(evidence types.Evidence, reason RemovalReason) bool {
+	batch := evpool.evidenceStore.NewBatch()
+	defer batch.Close()
+
+	err := batch.Delete(keyPending(evidence))
+	if err == nil {
+		err = batch.Delete(keyInfo(evidence))
+	}
+	if err == nil {
+		err = batch.Delete(keyHashIndex(evidence.Hash()))
+	}
+	if err == nil {
+		err = evpool.setTombstone(batch, evidence.Height(), evidence.Hash(), reason, evpool.State().LastBlockHeight)
+	}
+	if err == nil {
+		err = batch.WriteSync()
+	}
+
+	if err != nil {
 		evpool.logger.Error("failed to delete pending evidence", "err", err)
-	} else {
-		atomic.AddUint32(&evpool.evidenceSize, ^uint32(0))
-		evpool.logger.Debug("deleted pending evidence", "evidence", evidence)
+		return false
 	}
+	evpool.decrementSize(1, evidenceBytes(evidence))
+	evpool.accused.Remove(evidence)
+	evpool.logger.Debug("deleted pending evidence", evLogFields(evidence)...)
+	return true
 }
 
 // markEvidenceAsCommitted processes all the evidence in the block, marking it as
-// committed and removing it from the pending database.
+// committed and removing it from the pending database. All evidence is marked
+// in a single batch, so that either all or none of it is.
 func (evpool *Pool) markEvidenceAsCommitted(evidence types.EvidenceList) {
-	blockEvidenceMap := make(map[string]struct{}, len(evidence))
+	if len(evidence) == 0 {
+		return
+	}
+
+	// As the evidence is stored in the block store we only need to record the
+	// height that it was saved at.
+	state := evpool.State()
+	h := gogotypes.Int64Value{Value: state.LastBlockHeight}
+	heightBytes, err := proto.Marshal(&h)
+	if err != nil {
+		evpool.logger.Error("failed to marshal committed evidence height", "err", err)
+		return
+	}
+
+	var (
+		batch            = evpool.evidenceStore.NewBatch()
+		committed        = make([]types.Evidence, 0, len(evidence)) // newly committed evidence
+		wasPending       = make([]types.Evidence, 0, len(evidence))
+		blockEvidenceMap = make(map[string]struct{}, len(evidence))
+		seen             = make(map[string]struct{}, len(evidence))
+		removed          uint32
+		removedBytes     int64
+		added            uint32
+	)
+	defer batch.Close()
+
 	for _, ev := range evidence {
-		if evpool.isPending(ev) {
-			evpool.removePendingEvidence(ev)
-			blockEvidenceMap[evMapKey(ev)] = struct{}{}
+		// the same evidence must not be removed from the pending pool twice
+		if _, ok := seen[evMapKey(ev)]; ok {
+			continue
 		}
+		seen[evMapKey(ev)] = struct{}{}
 
-		// Add evidence to the committed list. As the evidence is stored in the block store
-		// we only need to record the height that it was saved at.
-		key := keyCommitted(ev)
+		var evBytes []byte
+		if evpool.keepCommittedEvidence {
+			evpb, err := types.EvidenceToProto(ev)
+			if err != nil {
+				evpool.logger.Error("failed to convert committed evidence to proto", append(evLogFields(ev), "err", err)...)
+				continue
+			}
+			if evBytes, err = evpb.Marshal(); err != nil {
+				evpool.logger.Error("failed to marshal committed evidence", append(evLogFields(ev), "err", err)...)
+				continue
+			}
+		}
 
-		h := gogotypes.Int64Value{Value: ev.Height()}
-		evBytes, err := proto.Marshal(&h)
-		if err != nil {
-			evpool.logger.Error("failed to marshal committed evidence", "key(height/hash)", key, "err", err)
-			continue
+		// Remove the evidence from the pending pool in the same batch, so that
+		// it is never both pending and committed. Its metadata is kept.
+		pending := evpool.isPending(ev)
+		if err := evpool.commitEvidence(batch, ev, heightBytes, evBytes, pending); err != nil {
+			evpool.logger.Error("failed to save committed evidence", append(evLogFields(ev), "err", err)...)
+			return
+		}
+		if !evpool.isCommitted(ev) {
+			added++
+			committed = append(committed, ev)
+		}
+		if pending {
+			removed++
+			removedBytes += evidenceBytes(ev)
+			wasPending = append(wasPending, ev)
+			blockEvidenceMap[evMapKey(ev)] = struct{}{}
 		}
+	}
+
+	if err := evpool.writeCommitted(batch, int64(added)); err != nil {
+		evpool.logger.Error("failed to save committed evidence", "count", len(committed), "err", err)
+		return
+	}
 
-		if err := evpool.evidenceStore.Set(key, evBytes); err != nil {
-			evpool.logger.Error("failed to save committed evidence", "key(height/hash)", key, "err", err)
+	evpool.decrementSize(removed, removedBytes)
+	for _, ev := range wasPending {
+		evpool.accused.Remove(ev)
+	}
+	// evidence that was already committed, for example when a block is
+	// replayed, is only counted and published once
+	for _, ev := range committed {
+		evpool.metrics.CommittedEvidence.Add(1)
+		evpool.metrics.CommittedEvidenceAgeBlocks.Observe(float64(state.LastBlockHeight - ev.Height()))
+		evpool.metrics.CommittedEvidenceAgeSeconds.Observe(state.LastBlockTime.Sub(ev.Time()).Seconds())
+		evpool.publishMutation(MutationCommitted, ev.Height(), ev.Hash())
+		evpool.publishEvent(TransitionCommitted, ev, state.LastBlockHeight)
+		select {
+		case evpool.committedCh <- ev:
+		default:
+			evpool.logger.Debug("committed evidence channel is full; dropping evidence", evLogFields(ev)...)
 		}
 
-		evpool.logger.Debug("marked evidence as committed", "evidence", ev)
+		evpool.logger.Debug("marked evidence as committed", evLogFields(ev)...)
 	}
 
 	// remove committed evidence from the clist
@@ -430,61 +1083,37 @@ func (evpool *Pool) markEvidenceAsCommitted(evidence types.EvidenceList) {
 	}
 }
 
-// listEvidence retrieves lists evidence from oldest to newest within maxBytes.
-// If maxBytes is -1, there's no cap on the size of returned evidence.
-func (evpool *Pool) listEvidence(prefixKey int64, maxBytes int64) ([]types.Evidence, int64, error) {
-	var (
-		evSize    int64
-		totalSize int64
-		evidence  []types.Evidence
-		evList    tmproto.EvidenceList // used for calculating the bytes size
-	)
-
-	iter, err := dbm.IteratePrefix(evpool.evidenceStore, prefixToBytes(prefixKey))
+// countKeys returns the number of keys under the prefix.
+func countKeys(db dbm.DB, prefix int64) (uint32, error) {
+	iter, err := dbm.IteratePrefix(db, prefixToBytes(prefix))
 	if err != nil {
-		return nil, totalSize, fmt.Errorf("database error: %v", err)
+		return 0, fmt.Errorf("database error: %v", err)
 	}
-
 	defer iter.Close()
 
+	var n uint32
 	for ; iter.Valid(); iter.Next() {
-		var evpb tmproto.Evidence
-
-		if err := evpb.Unmarshal(iter.Value()); err != nil {
-			return evidence, totalSize, err
-		}
-
-		evList.Evidence = append(evList.Evidence, evpb)
-		evSize = int64(evList.Size())
-
-		if maxBytes != -1 && evSize > maxBytes {
-			if err := iter.Error(); err != nil {
-				return evidence, totalSize, err
-			}
-			return evidence, totalSize, nil
-		}
-
-		ev, err := types.EvidenceFromProto(&evpb)
-		if err != nil {
-			return nil, totalSize, err
-		}
-
-		totalSize = evSize
-		evidence = append(evidence, ev)
-	}
-
-	if err := iter.Error(); err != nil {
-		return evidence, totalSize, err
+		n++
 	}
+	return n, iter.Error()
+}
 
-	return evidence, totalSize, nil
+// listEvidence retrieves lists evidence from oldest to newest within maxBytes.
+// If maxBytes is -1, there's no cap on the size of returned evidence. The order
+// is that of the keys, which block proposal relies on being the same on all
+// nodes.
+func (evpool *Pool) listEvidence(prefixKey int64, maxBytes int64) ([]types.Evidence, int64, error) {
+	return evpool.listEvidenceWithFilter(prefixKey, maxBytes, -1, nil)
 }
 
-func (evpool *Pool) removeExpiredPendingEvidence() (int64, time.Time) {
+// removeExpiredPendingEvidence prunes pending evidence that has expired by
+// now, up to the limit set with WithMaxExpiredPerUpdate, and returns the height
+// and time at which to prune next.
+func (evpool *Pool) removeExpiredPendingEvidence(now time.Time) (int64, time.Time) {
 	iter, err := dbm.IteratePrefix(evpool.evidenceStore, prefixToBytes(prefixPending))
 	if err != nil {
 		evpool.logger.Error("failed to iterate over pending evidence", "err", err)
-		return evpool.State().LastBlockHeight, evpool.State().LastBlockTime
+		return evpool.State().LastBlockHeight, evpool.expiryTime
 	}
 
 	defer iter.Close()
@@ -492,24 +1121,45 @@ func (evpool *Pool) removeExpiredPendingEvidence() (int64, time.Time) {
 	blockEvidenceMap := make(map[string]struct{})
 
 	for ; iter.Valid(); iter.Next() {
+		if evpool.maxExpiredPerUpdate > 0 && len(blockEvidenceMap) >= evpool.maxExpiredPerUpdate {
+			// Leave the rest of the expired evidence for the next update, which
+			// the zero pruning time ensures.
+			evpool.removeEvidenceFromList(blockEvidenceMap)
+			return evpool.State().LastBlockHeight, time.Time{}
+		}
+
 		ev, err := bytesToEv(iter.Value())
 		if err != nil {
-			evpool.logger.Error("failed to transition evidence from protobuf", "err", err)
+			evpool.logger.Error("failed to transition evidence from protobuf", "key", iter.Key(), "err", err)
 			continue
 		}
 
-		if !evpool.isExpired(ev.Height(), ev.Time()) {
+		// NOTE: pending evidence is ordered by ev.Height(). If light client attack
+		// evidence expires from its conflicting height, a later piece of evidence
+		// may already have expired when we stop here. It is then pruned once this
+		// evidence expires, i.e. late but never early.
+		if !evpool.isExpiredAt(ev, now) {
+			if evpool.hasExpiryOverride(ev) {
+				// Evidence with its own maximum age doesn't tell when the evidence
+				// after it expires. Evidence of its type that expires before the
+				// returned pruning point is pruned late.
+				continue
+			}
 			if len(blockEvidenceMap) != 0 {
 				evpool.removeEvidenceFromList(blockEvidenceMap)
 			}
 
-			// Return the height and time with which this evidence will have expired
-			// so we know when to prune next.
-			return ev.Height() + evpool.State().ConsensusParams.Evidence.MaxAgeNumBlocks + 1,
-				ev.Time().Add(evpool.State().ConsensusParams.Evidence.MaxAgeDuration).Add(time.Second)
+			// Return the height and time after which this evidence will have expired
+			// so we know when to prune next. These are the exact bounds checked by
+			// isExpired, so the evidence is pruned with the first block past both.
+			params := evpool.expiryParams(ev, evpool.EvidenceParams())
+			return evpool.expiryHeight(ev) + params.MaxAgeNumBlocks, ev.Time().Add(params.MaxAgeDuration)
 		}
 
-		evpool.removePendingEvidence(ev)
+		evpool.removePendingEvidence(ev, RemovalExpired)
+		evpool.metrics.ExpiredEvidence.Add(1)
+		evpool.publishMutation(MutationExpired, ev.Height(), ev.Hash())
+		evpool.publishEvent(TransitionExpired, ev, evpool.State().LastBlockHeight)
 		blockEvidenceMap[evMapKey(ev)] = struct{}{}
 	}
 
@@ -518,7 +1168,7 @@ func (evpool *Pool) removeExpiredPendingEvidence() (int64, time.Time) {
 		evpool.removeEvidenceFromList(blockEvidenceMap)
 	}
 
-	return evpool.State().LastBlockHeight, evpool.State().LastBlockTime
+	return evpool.State().LastBlockHeight, evpool.expiryTime
 }
 
 func (evpool *Pool) removeEvidenceFromList(
@@ -527,6 +1177,13 @@ func (evpool *Pool) removeEvidenceFromList(
 	for e := evpool.evidenceList.Front(); e != nil; e = e.Next() {
 		// Remove from clist
 		ev := e.Value.(types.Evidence)
+		if len(ev.Hash()) == 0 {
+			// All evidence with an empty hash at a height would share the same
+			// key, so we can't tell which of them is meant to be removed.
+			evpool.logger.Error("found evidence with an empty hash in the evidence list; not removing it",
+				evLogFields(ev)...)
+			continue
+		}
 		if _, ok := blockEvidenceMap[evMapKey(ev)]; ok {
 			evpool.evidenceList.Remove(e)
 			e.DetachPrev()
@@ -534,10 +1191,113 @@ func (evpool *Pool) removeEvidenceFromList(
 	}
 }
 
+// loadPendingEvidence loads the pending evidence into the evidence list and
+// restores the persisted pruning point, pruning expired evidence if it has been
+// reached or wasn't persisted.
+func (evpool *Pool) loadPendingEvidence() error {
+	if evpool.readOnly {
+		return evpool.reloadPendingEvidence()
+	}
+	state := evpool.State()
+	height, t, ok := evpool.loadPruningPoint()
+	if ok && (state.LastBlockHeight <= height || !state.LastBlockTime.After(t)) {
+		evpool.setPruningPoint(height, t)
+	} else {
+		evpool.setPruningPoint(evpool.removeExpiredPendingEvidence(evpool.expiryTime))
+		evpool.savePruningPoint()
+	}
+	return evpool.reloadPendingEvidence()
+}
+
+// reloadPendingEvidence loads the pending evidence in the store into the
+// evidence list, replacing its contents, and resets the number of pending
+// evidence accordingly.
+func (evpool *Pool) reloadPendingEvidence() error {
+	evList, _, err := evpool.listEvidence(prefixPending, -1)
+	if err != nil {
+		return err
+	}
+
+	// Evidence is both pending and committed if an older version crashed while
+	// marking it as committed, as this wasn't done atomically. The evidence is
+	// committed, so its pending entry is dropped. Evidence stored by a version
+	// without the hash index is added to it.
+	batch := evpool.evidenceStore.NewBatch()
+	defer batch.Close()
+	var changed bool
+	pending := evList[:0]
+	for _, ev := range evList {
+		if !evpool.isCommitted(ev) {
+			pending = append(pending, ev)
+			indexed, err := evpool.evidenceStore.Get(keyHashIndex(ev.Hash()))
+			if err != nil {
+				return fmt.Errorf("failed to load hash index: %w", err)
+			}
+			if indexed == nil {
+				if err := batch.Set(keyHashIndex(ev.Hash()), keyPending(ev)); err != nil {
+					return err
+				}
+				changed = true
+			}
+			continue
+		}
+		if err := batch.Delete(keyPending(ev)); err != nil {
+			return err
+		}
+		if err := batch.Delete(keyHashIndex(ev.Hash())); err != nil {
+			return err
+		}
+		changed = true
+		evpool.logger.Info("removing committed evidence from pending list", evLogFields(ev)...)
+	}
+	if changed && !evpool.readOnly {
+		if err := batch.WriteSync(); err != nil {
+			return fmt.Errorf("failed to update pending evidence: %w", err)
+		}
+	}
+	evList = pending
+
+	var size int64
+	for _, ev := range evList {
+		size += evidenceBytes(ev)
+	}
+	atomic.StoreUint32(&evpool.evidenceSize, uint32(len(evList)))
+	atomic.StoreInt64(&evpool.pendingBytes, size)
+	evpool.metrics.Size.Set(float64(len(evList)))
+	evpool.updatePressure()
+	evpool.accused.Reset(evList)
+
+	evpool.clearEvidenceList()
+	for _, ev := range evList {
+		evpool.evidenceList.PushBack(ev)
+	}
+
+	return nil
+}
+
+// clearEvidenceList removes all evidence from the clist.
+func (evpool *Pool) clearEvidenceList() {
+	for e := evpool.evidenceList.Front(); e != nil; e = e.Next() {
+		evpool.evidenceList.Remove(e)
+		e.DetachPrev()
+	}
+}
+
 func (evpool *Pool) updateState(state sm.State) {
 	evpool.mtx.Lock()
 	defer evpool.mtx.Unlock()
 	evpool.state = state
+	// A block time before that of an earlier block would make evidence that has
+	// expired valid again, so evidence keeps expiring by the latest block time.
+	if state.LastBlockTime.Before(evpool.expiryTime) {
+		evpool.logger.Error("block time went backwards; expiring evidence by the latest block time instead",
+			"last_block_time", state.LastBlockTime, "latest_block_time", evpool.expiryTime)
+	} else {
+		evpool.expiryTime = state.LastBlockTime
+	}
+	// The validator sets of committed heights never change but those of later
+	// heights may still be saved again.
+	evpool.valSetCache.InvalidateFrom(state.LastBlockHeight + 1)
 }
 
 // processConsensusBuffer converts all the duplicate votes witnessed from consensus
@@ -548,71 +1308,102 @@ func (evpool *Pool) processConsensusBuffer(state sm.State) {
 	evpool.mtx.Lock()
 	defer evpool.mtx.Unlock()
 	for _, voteSet := range evpool.consensusBuffer {
+		evpool.addEvidenceFromVotes(voteSet, state)
+	}
+	// reset consensus buffer
+	evpool.consensusBuffer = make([]duplicateVoteSet, 0)
+	evpool.metrics.ConsensusBufferSize.Set(0)
+}
 
-		// Check the height of the conflicting votes and fetch the corresponding time and validator set
-		// to produce the valid evidence
-		var dve *types.DuplicateVoteEvidence
-		switch {
-		case voteSet.VoteA.Height == state.LastBlockHeight:
-			dve = types.NewDuplicateVoteEvidence(
-				voteSet.VoteA,
-				voteSet.VoteB,
-				state.LastBlockTime,
-				state.LastValidators,
-			)
-
-		case voteSet.VoteA.Height < state.LastBlockHeight:
-			valSet, err := evpool.stateDB.LoadValidators(voteSet.VoteA.Height)
-			if err != nil {
-				evpool.logger.Error("failed to load validator set for conflicting votes",
-					"height", voteSet.VoteA.Height, "err", err)
-				continue
-			}
-			blockMeta := evpool.blockStore.LoadBlockMeta(voteSet.VoteA.Height)
-			if blockMeta == nil {
-				evpool.logger.Error("failed to load block time for conflicting votes", "height", voteSet.VoteA.Height)
-				continue
-			}
-			dve = types.NewDuplicateVoteEvidence(
-				voteSet.VoteA,
-				voteSet.VoteB,
-				blockMeta.Header.Time,
-				valSet,
-			)
-
-		default:
-			// evidence pool shouldn't expect to get votes from consensus of a height that is above the current
-			// state. If this error is seen then perhaps consider keeping the votes in the buffer and retry
-			// in following heights
-			evpool.logger.Error("inbound duplicate votes from consensus are of a greater height than current state",
-				"duplicate vote height", voteSet.VoteA.Height,
-				"state.LastBlockHeight", state.LastBlockHeight)
-			continue
-		}
-
-		// check if we already have this evidence
-		if evpool.isPending(dve) {
-			evpool.logger.Debug("evidence already pending; ignoring", "evidence", dve)
-			continue
+// addEvidenceFromVotes forms evidence from conflicting votes of a committed
+// height and adds it to the pending pool unless the pool already has it. The
+// caller must hold mtx.
+func (evpool *Pool) addEvidenceFromVotes(voteSet duplicateVoteSet, state sm.State) {
+	// Check the height of the conflicting votes and fetch the corresponding time and validator set
+	// to produce the valid evidence
+	var dve *types.DuplicateVoteEvidence
+	switch {
+	case voteSet.VoteA.Height == state.LastBlockHeight:
+		dve = types.NewDuplicateVoteEvidence(
+			voteSet.VoteA,
+			voteSet.VoteB,
+			state.LastBlockTime,
+			state.LastValidators,
+		)
+
+	case voteSet.VoteA.Height < state.LastBlockHeight:
+		valSet, err := evpool.stateDB.LoadValidators(voteSet.VoteA.Height)
+		if err != nil {
+			evpool.logger.Error("failed to load validator set for conflicting votes",
+				"height", voteSet.VoteA.Height, "err", err)
+			return
 		}
-
-		// check that the evidence is not already committed on chain
-		if evpool.isCommitted(dve) {
-			evpool.logger.Debug("evidence already committed; ignoring", "evidence", dve)
-			continue
+		blockMeta := evpool.blockStore.LoadBlockMeta(voteSet.VoteA.Height)
+		if blockMeta == nil {
+			evpool.logger.Error("failed to load block time for conflicting votes", "height", voteSet.VoteA.Height)
+			return
 		}
+		dve = types.NewDuplicateVoteEvidence(
+			voteSet.VoteA,
+			voteSet.VoteB,
+			blockMeta.Header.Time,
+			valSet,
+		)
+
+	default:
+		// evidence pool shouldn't expect to get votes from consensus of a height that is above the current
+		// state. If this error is seen then perhaps consider keeping the votes in the buffer and retry
+		// in following heights
+		evpool.logger.Error("inbound duplicate votes from consensus are of a greater height than current state",
+			"duplicate vote height", voteSet.VoteA.Height,
+			"state.LastBlockHeight", state.LastBlockHeight)
+		return
+	}
 
-		if err := evpool.addPendingEvidence(dve); err != nil {
-			evpool.logger.Error("failed to flush evidence from consensus buffer to pending list: %w", err)
-			continue
-		}
+	// check if we already have this evidence
+	if evpool.isPending(dve) {
+		evpool.logger.Debug("evidence already pending; ignoring", evLogFields(dve)...)
+		return
+	}
 
-		evpool.evidenceList.PushBack(dve)
+	// check that the evidence is not already committed on chain
+	if evpool.isCommitted(dve) {
+		evpool.logger.Debug("evidence already committed; ignoring", evLogFields(dve)...)
+		return
+	}
 
-		evpool.logger.Info("verified new evidence of byzantine behavior", "evidence", dve)
+	if err := evpool.addPendingEvidence(dve, true, state.LastBlockHeight); err != nil {
+		evpool.logger.Error("failed to flush evidence from consensus buffer to pending list: %w", err)
+		return
 	}
-	// reset consensus buffer
-	evpool.consensusBuffer = make([]duplicateVoteSet, 0)
+	evpool.schedulePruning(dve, state.ConsensusParams.Evidence)
+
+	evpool.evidenceList.PushBack(dve)
+
+	evpool.logger.Info("verified new evidence of byzantine behavior", evLogFields(dve)...)
+}
+
+// Close stops background pruning, closes the channels of MutationStream and
+// Subscribe and flushes the conflicting votes buffered from consensus: evidence
+// is formed from those of committed heights and the rest are persisted for the
+// next pool on the store. The store itself isn't closed. Close is idempotent.
+func (evpool *Pool) Close() error {
+	evpool.closeOnce.Do(func() {
+		evpool.StopPruning()
+		if !evpool.readOnly {
+			evpool.closeErr = evpool.flushConsensusBuffer()
+		}
+		releaseStore(evpool.rawStore, evpool.chainID)
+
+		evpool.subscribersMtx.Lock()
+		for sub := range evpool.subscribers {
+			delete(evpool.subscribers, sub)
+			close(sub.ch)
+		}
+		evpool.subscribersMtx.Unlock()
+		evpool.closeEventSubscribers()
+	})
+	return evpool.closeErr
 }
 
 type duplicateVoteSet struct {
@@ -620,18 +1411,69 @@ type duplicateVoteSet struct {
 	VoteB *types.Vote
 }
 
+// bytesToEv decodes evidence stored in the pending pool. The returned evidence
+// is nil if an error is returned.
 func bytesToEv(evBytes []byte) (types.Evidence, error) {
 	var evpb tmproto.Evidence
 	err := evpb.Unmarshal(evBytes)
 	if err != nil {
-		return &types.DuplicateVoteEvidence{}, err
+		return nil, err
 	}
 
-	return types.EvidenceFromProto(&evpb)
+	ev, err := types.EvidenceFromProto(&evpb)
+	if err != nil {
+		return nil, err
+	}
+	return ev, nil
 }
 
+// evLogFields returns the key/value pairs identifying the evidence in logs: its
+// type, height and the fingerprint of its hash.
+func evLogFields(ev types.Evidence) []interface{} {
+	var evType string
+	switch ev.(type) {
+	case *types.DuplicateVoteEvidence:
+		evType = "duplicate_vote"
+	case *types.LightClientAttackEvidence:
+		evType = "light_client_attack"
+	default:
+		evType = fmt.Sprintf("%T", ev)
+	}
+	return []interface{}{
+		"evidence_hash", fmt.Sprintf("%X", tmbytes.Fingerprint(ev.Hash())),
+		"height", ev.Height(),
+		"type", evType,
+	}
+}
+
+// evidenceBytes returns the size of the evidence in bytes as stored in the
+// pending pool.
+func evidenceBytes(ev types.Evidence) int64 {
+	evpb, err := types.EvidenceToProto(ev)
+	if err != nil {
+		return 0
+	}
+	return int64(evpb.Size())
+}
+
+// checkKeyable returns an error if the evidence has an empty hash or a height
+// that isn't positive. The keys of such evidence would be shared with other
+// evidence or not parse, which makes it hard to ever delete it again.
+func checkKeyable(ev types.Evidence) error {
+	if len(ev.Hash()) == 0 {
+		return types.NewErrInvalidEvidence(ev, errors.New("evidence has an empty hash"))
+	}
+	if ev.Height() <= 0 {
+		return types.NewErrInvalidEvidence(ev, fmt.Errorf("evidence has non-positive height %d", ev.Height()))
+	}
+	return nil
+}
+
+// evMapKey returns a key identifying the evidence in maps. Like the key of
+// pending evidence in the store, it combines the height and hash of the
+// evidence, so that evidence at different heights never shares a key.
 func evMapKey(ev types.Evidence) string {
-	return string(ev.Hash())
+	return string(keyPending(ev))
 }
 
 func prefixToBytes(prefix int64) []byte {
@@ -659,3 +1501,28 @@ func keyPending(evidence types.Evidence) []byte {
 	}
 	return key
 }
+
+// parseEvidenceKey decodes a key of the form (prefix, height, hash) and returns
+// the height and hash. An error is returned if the key has any other form.
+func parseEvidenceKey(key []byte) (int64, []byte, error) {
+	var (
+		prefix, height int64
+		hash           string
+	)
+
+	remaining, err := orderedcode.Parse(string(key), &prefix, &height, &hash)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to parse evidence key: %w", err)
+	}
+	if len(remaining) != 0 {
+		return 0, nil, fmt.Errorf("evidence key has %d unexpected trailing bytes", len(remaining))
+	}
+	if height <= 0 {
+		return 0, nil, fmt.Errorf("evidence key has invalid height %d", height)
+	}
+	if len(hash) != tmhash.Size {
+		return 0, nil, fmt.Errorf("evidence key has invalid hash size %d", len(hash))
+	}
+
+	return height, []byte(hash), nil
+}
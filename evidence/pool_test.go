@@ -1,9 +1,20 @@
 package evidence_test
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/go-kit/kit/metrics/generic"
+	"github.com/google/orderedcode"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -12,6 +23,8 @@ import (
 
 	"github.com/tendermint/tendermint/evidence"
 	"github.com/tendermint/tendermint/evidence/mocks"
+	tmbytes "github.com/tendermint/tendermint/libs/bytes"
+	tmjson "github.com/tendermint/tendermint/libs/json"
 	"github.com/tendermint/tendermint/libs/log"
 	tmproto "github.com/tendermint/tendermint/proto/tendermint/types"
 	sm "github.com/tendermint/tendermint/state"
@@ -94,11 +107,12 @@ func TestAddExpiredEvidence(t *testing.T) {
 		blockStore          = &mocks.BlockStore{}
 		expiredEvidenceTime = time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
 		expiredHeight       = int64(2)
+		lastBlockTime       = defaultEvidenceTime.Add(time.Duration(height) * time.Minute)
 	)
 
 	blockStore.On("LoadBlockMeta", mock.AnythingOfType("int64")).Return(func(h int64) *types.BlockMeta {
 		if h == height || h == expiredHeight {
-			return &types.BlockMeta{Header: types.Header{Time: defaultEvidenceTime}}
+			return &types.BlockMeta{Header: types.Header{Time: lastBlockTime}}
 		}
 		return &types.BlockMeta{Header: types.Header{Time: expiredEvidenceTime}}
 	})
@@ -112,12 +126,12 @@ func TestAddExpiredEvidence(t *testing.T) {
 		expErr        bool
 		evDescription string
 	}{
-		{height, defaultEvidenceTime, false, "valid evidence"},
-		{expiredHeight, defaultEvidenceTime, false, "valid evidence (despite old height)"},
+		{height, lastBlockTime, false, "valid evidence"},
+		{expiredHeight, lastBlockTime, false, "valid evidence (despite old height)"},
 		{height - 1, expiredEvidenceTime, false, "valid evidence (despite old time)"},
 		{expiredHeight - 1, expiredEvidenceTime, true,
 			"evidence from height 1 (created at: 2019-01-01 00:00:00 +0000 UTC) is too old"},
-		{height, defaultEvidenceTime.Add(1 * time.Minute), true, "evidence time and block time is different"},
+		{height, lastBlockTime.Add(1 * time.Minute), true, "evidence time and block time is different"},
 	}
 
 	for _, tc := range testCases {
@@ -135,6 +149,184 @@ func TestAddExpiredEvidence(t *testing.T) {
 	}
 }
 
+func TestAddEvidenceErrorTypes(t *testing.T) {
+	var height int64 = 10
+	pool, val := defaultTestPool(t, height)
+
+	committed := newTestDuplicateVoteEvidence(height-1, val)
+	require.NoError(t, pool.AddEvidence(committed))
+	state := pool.State()
+	state.LastBlockHeight++
+	state.LastBlockTime = defaultEvidenceTime.Add(time.Hour)
+	state.ConsensusParams.Evidence.MaxAgeNumBlocks = 5
+	state.ConsensusParams.Evidence.MaxAgeDuration = time.Minute
+	pool.Update(state, types.EvidenceList{committed})
+
+	expired := newTestDuplicateVoteEvidence(1, val)
+	badSignature := newTestDuplicateVoteEvidence(height, val)
+	badSignature.VoteB.Signature = []byte("invalid signature")
+
+	isInvalid := func(err error) bool {
+		_, ok := err.(*types.ErrInvalidEvidence)
+		return ok
+	}
+
+	// committed evidence is benign
+	err := pool.AddEvidence(committed)
+	require.True(t, errors.Is(err, evidence.ErrAlreadyCommitted), err)
+	require.False(t, isInvalid(err))
+	require.True(t, errors.Is(pool.VerifyEvidence(committed), evidence.ErrAlreadyCommitted))
+
+	// expired evidence is stale but not invalid
+	err = pool.AddEvidence(expired)
+	require.True(t, errors.Is(err, evidence.ErrStaleEvidence), err)
+	require.True(t, errors.Is(err, evidence.ErrExpired), err)
+	require.False(t, isInvalid(err))
+
+	// evidence with a bad signature is invalid
+	err = pool.AddEvidence(badSignature)
+	require.True(t, isInvalid(err), err)
+	require.True(t, errors.Is(err, evidence.ErrInvalidSignature), err)
+	require.False(t, errors.Is(err, evidence.ErrStaleEvidence))
+
+	// in a batch, invalid evidence takes precedence over stale evidence
+	_, err = pool.AddEvidenceBatch([]types.Evidence{committed, expired, badSignature})
+	require.True(t, isInvalid(err), err)
+	_, err = pool.AddEvidenceBatch([]types.Evidence{committed, expired})
+	require.True(t, errors.Is(err, evidence.ErrStaleEvidence), err)
+
+	// blocks with expired evidence are still invalid
+	err = pool.CheckEvidence(types.EvidenceList{expired})
+	require.True(t, isInvalid(err), err)
+	require.EqualValues(t, 0, pool.Size())
+}
+
+func TestAddVerifiedEvidence(t *testing.T) {
+	var height int64 = 10
+	var verified int
+	pool, val := defaultTestPool(t, height, evidence.WithMaxPendingEvidence(2), evidence.WithVerifier(verifierFunc(
+		func(types.Evidence, sm.State) error {
+			verified++
+			return types.NewErrInvalidEvidence(nil, errors.New("rejected by verifier"))
+		})))
+
+	// verification is skipped
+	ev := newTestDuplicateVoteEvidence(height-1, val)
+	require.Error(t, pool.AddEvidence(ev))
+	require.Equal(t, 1, verified)
+	require.NoError(t, pool.AddVerifiedEvidence(ev))
+	require.Equal(t, 1, verified)
+	require.EqualValues(t, 1, pool.Size())
+	evList, _ := pool.PendingEvidence(-1)
+	require.Equal(t, []types.Evidence{ev}, evList)
+
+	// but pending and committed evidence is still not added
+	require.NoError(t, pool.AddVerifiedEvidence(ev))
+	require.EqualValues(t, 1, pool.Size())
+	state := pool.State()
+	state.LastBlockHeight++
+	pool.Update(state, types.EvidenceList{ev})
+	err := pool.AddVerifiedEvidence(ev)
+	require.True(t, errors.Is(err, evidence.ErrAlreadyCommitted), err)
+	require.EqualValues(t, 0, pool.Size())
+
+	// and the size of the pool is still limited
+	for h := height - 3; h < height-1; h++ {
+		require.NoError(t, pool.AddVerifiedEvidence(newTestDuplicateVoteEvidence(h, val)))
+	}
+	require.Equal(t, evidence.ErrEvidencePoolFull, pool.AddVerifiedEvidence(newTestDuplicateVoteEvidence(height, val)))
+	require.EqualValues(t, 2, pool.Size())
+	require.Equal(t, 1, verified)
+}
+
+func TestAddDuplicateVote(t *testing.T) {
+	var height int64 = 10
+	pool, val := defaultTestPool(t, height)
+
+	// a valid pair of conflicting votes
+	ev := newTestDuplicateVoteEvidence(height-1, val)
+	require.NoError(t, pool.AddDuplicateVote(ev.VoteB, ev.VoteA))
+	evList, _ := pool.PendingEvidence(-1)
+	require.Equal(t, []types.Evidence{ev}, evList)
+
+	// votes of different heights don't conflict
+	mismatched := newTestDuplicateVoteEvidence(height-2, val).VoteA
+	err := pool.AddDuplicateVote(newTestDuplicateVoteEvidence(height-3, val).VoteA, mismatched)
+	_, ok := err.(*types.ErrInvalidEvidence)
+	require.True(t, ok, err)
+
+	// nor do votes of a validator not in the validator set
+	other := newTestDuplicateVoteEvidence(height-3, types.NewMockPV())
+	require.Error(t, pool.AddDuplicateVote(other.VoteA, other.VoteB))
+
+	// and the height must be committed
+	future := types.NewMockDuplicateVoteEvidenceWithValidator(height+1, defaultEvidenceTime, val, evidenceChainID)
+	require.Error(t, pool.AddDuplicateVote(future.VoteA, future.VoteB))
+	require.Error(t, pool.AddDuplicateVote(nil, ev.VoteB))
+
+	require.EqualValues(t, 1, pool.Size())
+}
+
+func TestVerifyEvidence(t *testing.T) {
+	var height int64 = 10
+	pool, val := defaultTestPool(t, height, evidence.WithMaxPendingEvidence(2))
+
+	committed := newTestDuplicateVoteEvidence(height-1, val)
+	require.NoError(t, pool.AddEvidence(committed))
+	pending := newTestDuplicateVoteEvidence(height-2, val)
+	require.NoError(t, pool.AddEvidence(pending))
+	state := pool.State()
+	state.LastBlockHeight++
+	state.LastBlockTime = defaultEvidenceTime.Add(time.Hour)
+	state.ConsensusParams.Evidence.MaxAgeNumBlocks = 5
+	state.ConsensusParams.Evidence.MaxAgeDuration = time.Minute
+	pool.Update(state, types.EvidenceList{committed})
+
+	badSignature := newTestDuplicateVoteEvidence(height, val)
+	badSignature.VoteB.Signature = []byte("invalid signature")
+
+	testCases := []struct {
+		name string
+		ev   types.Evidence
+	}{
+		{"valid", newTestDuplicateVoteEvidence(height-3, val)},
+		{"pending", pending},
+		{"committed", committed},
+		{"expired", newTestDuplicateVoteEvidence(1, val)},
+		{"bad signature", badSignature},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			size := pool.Size()
+			_, statusBefore, err := pool.GetEvidenceByHash(tc.ev.Hash())
+			require.NoError(t, err)
+
+			// the dry run writes nothing
+			verifyErr := pool.VerifyEvidence(tc.ev)
+			require.Equal(t, size, pool.Size())
+			_, status, err := pool.GetEvidenceByHash(tc.ev.Hash())
+			require.NoError(t, err)
+			require.Equal(t, statusBefore, status)
+
+			addErr := pool.AddEvidence(tc.ev)
+			if addErr == nil {
+				require.NoError(t, verifyErr)
+				return
+			}
+			require.Error(t, verifyErr)
+			require.IsType(t, addErr, verifyErr)
+			require.Equal(t, errors.Is(addErr, evidence.ErrStaleEvidence), errors.Is(verifyErr, evidence.ErrStaleEvidence))
+			require.Equal(t, addErr.Error(), verifyErr.Error())
+		})
+	}
+
+	// the pool is full now
+	ev := newTestDuplicateVoteEvidence(height-4, val)
+	require.Equal(t, evidence.ErrEvidencePoolFull, pool.VerifyEvidence(ev))
+	require.Equal(t, evidence.ErrEvidencePoolFull, pool.AddEvidence(ev))
+}
+
 func TestReportConflictingVotes(t *testing.T) {
 	var height int64 = 10
 
@@ -147,6 +339,11 @@ func TestReportConflictingVotes(t *testing.T) {
 	// shouldn't be able to submit the same evidence twice
 	pool.ReportConflictingVotes(ev.VoteA, ev.VoteB)
 
+	// even the votes of a committed height are buffered
+	state := pool.State()
+	committedEv := types.NewMockDuplicateVoteEvidenceWithValidator(height, state.LastBlockTime, pv, evidenceChainID)
+	pool.ReportConflictingVotes(committedEv.VoteA, committedEv.VoteB)
+
 	// evidence from consensus should not be added immediately but reside in the consensus buffer
 	evList, evSize := pool.PendingEvidence(defaultEvidenceMaxBytes)
 	require.Empty(t, evList)
@@ -156,7 +353,6 @@ func TestReportConflictingVotes(t *testing.T) {
 	require.Nil(t, next)
 
 	// move to next height and update state and evidence pool
-	state := pool.State()
 	state.LastBlockHeight++
 	state.LastBlockTime = ev.Time()
 	state.LastValidators = types.NewValidatorSet([]*types.Validator{val})
@@ -164,7 +360,494 @@ func TestReportConflictingVotes(t *testing.T) {
 
 	// should be able to retrieve evidence from pool
 	evList, _ = pool.PendingEvidence(defaultEvidenceMaxBytes)
+	require.Len(t, evList, 2)
+	// the evidence of the committed height has the time of its block
+	require.Equal(t, committedEv.VoteA, evList[0].(*types.DuplicateVoteEvidence).VoteA)
+	require.Equal(t, ev, evList[1])
+}
+
+func TestReportConflictingVotesWithoutBuffer(t *testing.T) {
+	var height int64 = 10
+
+	pool, pv := defaultTestPool(t, height, evidence.WithBufferConsensusEvidence(false))
+	state := pool.State()
+
+	// evidence of a committed height is added immediately
+	committedEv := types.NewMockDuplicateVoteEvidenceWithValidator(height, state.LastBlockTime, pv, evidenceChainID)
+	pool.ReportConflictingVotes(committedEv.VoteA, committedEv.VoteB)
+	pool.ReportConflictingVotes(committedEv.VoteA, committedEv.VoteB)
+	require.EqualValues(t, 1, pool.Size())
+	evList, _ := pool.PendingEvidence(defaultEvidenceMaxBytes)
+	require.Equal(t, []types.Evidence{committedEv}, evList)
+	require.Equal(t, committedEv, pool.EvidenceFront().Value)
+}
+
+func TestReportConflictingVotesWithoutBufferAtCurrentHeight(t *testing.T) {
+	var height int64 = 10
+	bufferSize := generic.NewGauge("consensus_buffer_size")
+	metrics := evidence.NopMetrics()
+	metrics.ConsensusBufferSize = bufferSize
+	pool, pv := defaultTestPool(t, height, evidence.WithBufferConsensusEvidence(false),
+		evidence.WithMetrics(metrics))
+	val := types.NewValidator(pv.PrivKey.PubKey(), 10)
+
+	// evidence of the height in progress still waits for the time of its block
+	ev := types.NewMockDuplicateVoteEvidenceWithValidator(height+1, defaultEvidenceTime, pv, evidenceChainID)
+	pool.ReportConflictingVotes(ev.VoteA, ev.VoteB)
+	require.Zero(t, pool.Size())
+	require.EqualValues(t, 1, bufferSize.Value())
+
+	// and is added by the update that commits the height
+	state := pool.State()
+	state.LastBlockHeight++
+	state.LastBlockTime = ev.Time()
+	state.LastValidators = types.NewValidatorSet([]*types.Validator{val})
+	pool.Update(state, []types.Evidence{})
+	evList, _ := pool.PendingEvidence(defaultEvidenceMaxBytes)
+	require.Equal(t, []types.Evidence{ev}, evList)
+	require.Zero(t, bufferSize.Value())
+}
+
+func TestConsensusBufferLimits(t *testing.T) {
+	var height int64 = 10
+	bufferSize := generic.NewGauge("consensus_buffer_size")
+	metrics := evidence.NopMetrics()
+	metrics.ConsensusBufferSize = bufferSize
+	pool, pv := defaultTestPool(t, height,
+		evidence.WithMaxConsensusBufferSize(2),
+		evidence.WithMetrics(metrics))
+	val := types.NewValidator(pv.PrivKey.PubKey(), 10)
+
+	var evs []*types.DuplicateVoteEvidence
+	for i := 0; i < 3; i++ {
+		evs = append(evs,
+			types.NewMockDuplicateVoteEvidenceWithValidator(height+1, defaultEvidenceTime, pv, evidenceChainID))
+	}
+
+	// the same votes are only buffered once, in either order
+	pool.ReportConflictingVotes(evs[0].VoteA, evs[0].VoteB)
+	pool.ReportConflictingVotes(evs[0].VoteB, evs[0].VoteA)
+	require.EqualValues(t, 1, bufferSize.Value())
+
+	// votes are dropped once the buffer is full
+	pool.ReportConflictingVotes(evs[1].VoteA, evs[1].VoteB)
+	pool.ReportConflictingVotes(evs[2].VoteA, evs[2].VoteB)
+	require.EqualValues(t, 2, bufferSize.Value())
+
+	state := pool.State()
+	state.LastBlockHeight++
+	state.LastBlockTime = defaultEvidenceTime
+	state.LastValidators = types.NewValidatorSet([]*types.Validator{val})
+	pool.Update(state, types.EvidenceList{})
+	require.EqualValues(t, 0, bufferSize.Value())
+
+	evList, _ := pool.PendingEvidence(-1)
+	require.ElementsMatch(t, []types.Evidence{evs[0], evs[1]}, evList)
+}
+
+func TestReportConflictingVotesOfPendingEvidence(t *testing.T) {
+	var height int64 = 10
+	pool, val := defaultTestPool(t, height)
+
+	// the same evidence is received from a peer and detected in consensus
+	ev := newTestDuplicateVoteEvidence(height, val)
+	require.NoError(t, pool.AddEvidence(ev))
+	pool.ReportConflictingVotes(ev.VoteA, ev.VoteB)
+
+	state := pool.State()
+	state.LastBlockHeight++
+	pool.Update(state, types.EvidenceList{})
+
+	require.EqualValues(t, 1, pool.Size())
+	evList, _ := pool.PendingEvidence(-1)
 	require.Equal(t, []types.Evidence{ev}, evList)
+	var listed int
+	for e := pool.EvidenceFront(); e != nil; e = e.Next() {
+		listed++
+	}
+	require.Equal(t, 1, listed)
+}
+
+func TestCloseFlushesConsensusBuffer(t *testing.T) {
+	var height int64 = 10
+	val := types.NewMockPV()
+	evidenceDB := dbm.NewMemDB()
+	pool := newTestPool(t, height, val, evidenceDB)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := pool.MutationStream(ctx)
+	require.NoError(t, err)
+
+	// votes of a committed height and of the height in progress
+	committed := newTestDuplicateVoteEvidence(height-1, val)
+	inProgress := newTestDuplicateVoteEvidence(height+1, val)
+	pool.ReportConflictingVotes(committed.VoteA, committed.VoteB)
+	pool.ReportConflictingVotes(inProgress.VoteA, inProgress.VoteB)
+
+	require.NoError(t, pool.Close())
+	require.NoError(t, pool.Close())
+	<-events // the evidence formed from the committed votes
+	_, ok := <-events
+	require.False(t, ok)
+
+	pool = newTestPool(t, height, val, evidenceDB)
+	evList, _ := pool.PendingEvidence(-1)
+	require.Equal(t, []types.Evidence{committed}, evList)
+
+	// the votes of the height in progress are buffered again
+	state := pool.State()
+	state.LastBlockHeight++
+	state.LastBlockTime = inProgress.Time()
+	state.LastValidators = types.NewValidatorSet([]*types.Validator{
+		types.NewValidator(val.PrivKey.PubKey(), 10),
+	})
+	pool.Update(state, types.EvidenceList{})
+	evList, _ = pool.PendingEvidence(-1)
+	require.Equal(t, []types.Evidence{committed, inProgress}, evList)
+}
+
+func TestFlush(t *testing.T) {
+	var height int64 = 10
+	pool, val := defaultTestPool(t, height)
+
+	committed := newTestDuplicateVoteEvidence(height-1, val)
+	inProgress := newTestDuplicateVoteEvidence(height+1, val)
+	pool.ReportConflictingVotes(committed.VoteA, committed.VoteB)
+	pool.ReportConflictingVotes(inProgress.VoteA, inProgress.VoteB)
+
+	// the votes of the committed height become pending without an update
+	pool.Flush()
+	require.Equal(t, height, pool.State().LastBlockHeight)
+	evList, _ := pool.PendingEvidence(-1)
+	require.Equal(t, []types.Evidence{committed}, evList)
+
+	// while those of the height in progress wait for it to be committed
+	state := pool.State()
+	state.LastBlockHeight++
+	state.LastBlockTime = inProgress.Time()
+	state.LastValidators = types.NewValidatorSet([]*types.Validator{
+		types.NewValidator(val.PrivKey.PubKey(), 10),
+	})
+	pool.Update(state, types.EvidenceList{})
+	evList, _ = pool.PendingEvidence(-1)
+	require.Equal(t, []types.Evidence{committed, inProgress}, evList)
+}
+
+func TestFlushWhileReportingVotes(t *testing.T) {
+	var height int64 = 10
+	pool, val := defaultTestPool(t, height)
+
+	// votes reported while flushing stay buffered
+	const n = 1000
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < n; i++ {
+			ev := newTestDuplicateVoteEvidence(height+1, val)
+			pool.ReportConflictingVotes(ev.VoteA, ev.VoteB)
+		}
+	}()
+	for flushing := true; flushing; {
+		select {
+		case <-done:
+			flushing = false
+		default:
+		}
+		pool.Flush()
+	}
+	require.Zero(t, pool.Size())
+
+	state := pool.State()
+	state.LastBlockHeight++
+	state.LastBlockTime = defaultEvidenceTime.Add(time.Duration(height+1) * time.Minute)
+	state.LastValidators = types.NewValidatorSet([]*types.Validator{
+		types.NewValidator(val.PrivKey.PubKey(), 10),
+	})
+	pool.Update(state, types.EvidenceList{})
+	require.EqualValues(t, n, pool.Size())
+}
+
+func TestCommittedFromSelf(t *testing.T) {
+	var height int64 = 10
+
+	now := defaultEvidenceTime
+	pool, pv := defaultTestPool(t, height, evidence.WithClock(func() time.Time { return now }))
+	val := types.NewValidator(pv.PrivKey.PubKey(), 10)
+
+	// evidence received from a peer
+	peerEv := newTestDuplicateVoteEvidence(height-1, pv)
+	require.NoError(t, pool.AddEvidence(peerEv))
+
+	// evidence detected in consensus
+	selfEv := types.NewMockDuplicateVoteEvidenceWithValidator(height+1, defaultEvidenceTime, pv, evidenceChainID)
+	pool.ReportConflictingVotes(selfEv.VoteA, selfEv.VoteB)
+
+	state := pool.State()
+	state.LastBlockHeight++
+	state.LastBlockTime = selfEv.Time()
+	state.LastValidators = types.NewValidatorSet([]*types.Validator{val})
+	pool.Update(state, types.EvidenceList{})
+	require.EqualValues(t, 2, pool.Size())
+
+	// nothing has been committed yet
+	infos, err := pool.CommittedFromSelf(1, height+1)
+	require.NoError(t, err)
+	require.Empty(t, infos)
+
+	state.LastBlockHeight++
+	pool.Update(state, types.EvidenceList{peerEv, selfEv})
+	require.EqualValues(t, 0, pool.Size())
+
+	infos, err = pool.CommittedFromSelf(1, height+1)
+	require.NoError(t, err)
+	require.Equal(t, []evidence.EvidenceInfo{{
+		Height:         selfEv.Height(),
+		Hash:           selfEv.Hash(),
+		FirstSeen:      now,
+		DetectedBySelf: true,
+		AddedHeight:    height + 1,
+	}}, infos)
+
+	// the range is inclusive
+	infos, err = pool.CommittedFromSelf(height+1, height+1)
+	require.NoError(t, err)
+	require.Len(t, infos, 1)
+	infos, err = pool.CommittedFromSelf(1, height)
+	require.NoError(t, err)
+	require.Empty(t, infos)
+}
+
+func TestRemoveEvidenceWithEmptyHash(t *testing.T) {
+	var height int64 = 10
+	pool, val := defaultTestPool(t, height)
+
+	emptyA := emptyHashEvidence{newTestDuplicateVoteEvidence(height-1, val)}
+	emptyB := emptyHashEvidence{newTestDuplicateVoteEvidence(height-2, val)}
+	ev := newTestDuplicateVoteEvidence(height, val)
+	pool.PushEvidenceToList(emptyA)
+	pool.PushEvidenceToList(ev)
+	pool.PushEvidenceToList(emptyB)
+
+	listed := func() []types.Evidence {
+		var evs []types.Evidence
+		for e := pool.EvidenceFront(); e != nil; e = e.Next() {
+			evs = append(evs, e.Value.(types.Evidence))
+		}
+		return evs
+	}
+
+	// an empty key can't identify a single piece of evidence
+	pool.RemoveEvidenceFromList(map[string]struct{}{"": {}})
+	require.Equal(t, []types.Evidence{emptyA, ev, emptyB}, listed())
+
+	pool.RemoveEvidenceFromList(map[string]struct{}{evidence.EvMapKey(ev): {}})
+	require.Equal(t, []types.Evidence{emptyA, emptyB}, listed())
+}
+
+func TestAddUnkeyableEvidence(t *testing.T) {
+	var height int64 = 10
+	pool, val := defaultTestPool(t, height)
+
+	var valid []types.Evidence
+	for _, ev := range []types.Evidence{
+		emptyHashEvidence{newTestDuplicateVoteEvidence(height, val)},
+		zeroHeightEvidence{newTestDuplicateVoteEvidence(height, val)},
+	} {
+		var invalidErr *types.ErrInvalidEvidence
+		require.True(t, errors.As(pool.AddEvidence(ev), &invalidErr))
+		require.True(t, errors.As(pool.AddVerifiedEvidence(ev), &invalidErr))
+
+		// the rest of a batch is still added
+		validEv := newTestDuplicateVoteEvidence(height-1, val)
+		added, err := pool.AddEvidenceBatch([]types.Evidence{ev, validEv})
+		require.Equal(t, 1, added)
+		require.True(t, errors.As(err, &invalidErr))
+		valid = append(valid, validEv)
+	}
+
+	// nothing else was stored
+	evList, _ := pool.PendingEvidence(-1)
+	require.ElementsMatch(t, valid, evList)
+	corrupt, err := pool.ValidateStore()
+	require.NoError(t, err)
+	require.Empty(t, corrupt)
+	require.NoError(t, pool.CheckConsistency())
+}
+
+func TestRemoveEvidenceWithCollidingHash(t *testing.T) {
+	var height int64 = 10
+	pool, val := defaultTestPool(t, height)
+
+	hash := bytes.Repeat([]byte{1}, 32)
+	evA := collidingEvidence{newTestDuplicateVoteEvidence(height-1, val), hash}
+	evB := collidingEvidence{newTestDuplicateVoteEvidence(height, val), hash}
+	require.NotEqual(t, evidence.EvMapKey(evA), evidence.EvMapKey(evB))
+	pool.PushEvidenceToList(evA)
+	pool.PushEvidenceToList(evB)
+
+	pool.RemoveEvidenceFromList(map[string]struct{}{evidence.EvMapKey(evB): {}})
+	require.Equal(t, evA, pool.EvidenceFront().Value)
+	require.Nil(t, pool.EvidenceFront().Next())
+}
+
+func TestPendingAccusedValidators(t *testing.T) {
+	var height int64 = 10
+	pvA, pvB := types.NewMockPV(), types.NewMockPV()
+	valSet := types.NewValidatorSet([]*types.Validator{
+		types.NewValidator(pvA.PrivKey.PubKey(), 10),
+		types.NewValidator(pvB.PrivKey.PubKey(), 10),
+	})
+	stateStore := initializeStateFromValidatorSet(t, valSet, height)
+	state, err := stateStore.Load()
+	require.NoError(t, err)
+	blockStore := initializeBlockStore(dbm.NewMemDB(), state, pvA.PrivKey.PubKey().Address())
+	evidenceDB := dbm.NewMemDB()
+	pool, err := evidence.NewPool(log.TestingLogger(), evidenceDB, stateStore, blockStore)
+	require.NoError(t, err)
+
+	newEv := func(height int64, pv types.MockPV) types.Evidence {
+		ev := newTestDuplicateVoteEvidence(height, pv)
+		ev.TotalVotingPower = valSet.TotalVotingPower()
+		return ev
+	}
+	accused := func(p *evidence.Pool) [][]byte {
+		addrs, err := p.PendingAccusedValidators()
+		require.NoError(t, err)
+		return addrs
+	}
+
+	addrA, addrB := []byte(pvA.PrivKey.PubKey().Address()), []byte(pvB.PrivKey.PubKey().Address())
+	both := [][]byte{addrA, addrB}
+	if bytes.Compare(addrA, addrB) > 0 {
+		both = [][]byte{addrB, addrA}
+	}
+
+	require.Empty(t, accused(pool))
+
+	// validator A is accused twice
+	evA1, evA2, evB := newEv(height, pvA), newEv(height-1, pvA), newEv(height, pvB)
+	for _, ev := range []types.Evidence{evA1, evA2, evB} {
+		require.NoError(t, pool.AddEvidence(ev))
+	}
+	require.Equal(t, both, accused(pool))
+
+	// the pool recovers the set on restart
+	require.NoError(t, pool.Close())
+	pool, err = evidence.NewPool(log.TestingLogger(), evidenceDB, stateStore, blockStore)
+	require.NoError(t, err)
+	require.Equal(t, both, accused(pool))
+
+	// A is still implicated by the remaining evidence
+	state.LastBlockHeight = height + 1
+	pool.Update(state, types.EvidenceList{evA1})
+	require.Equal(t, both, accused(pool))
+
+	state.LastBlockHeight++
+	pool.Update(state, types.EvidenceList{evA2})
+	require.Equal(t, [][]byte{addrB}, accused(pool))
+
+	state.LastBlockHeight++
+	pool.Update(state, types.EvidenceList{evB})
+	require.Empty(t, accused(pool))
+}
+
+func TestHasEvidenceAgainst(t *testing.T) {
+	var height int64 = 10
+	pool, val := defaultTestPool(t, height)
+	hasEvidence := func(addr []byte) bool {
+		ok, err := pool.HasEvidenceAgainst(addr)
+		require.NoError(t, err)
+		return ok
+	}
+
+	// duplicate vote evidence implicates the validator that signed the votes
+	addr := val.PrivKey.PubKey().Address()
+	require.False(t, hasEvidence(addr))
+	dve := newTestDuplicateVoteEvidence(height, val)
+	require.NoError(t, pool.AddEvidence(dve))
+	require.True(t, hasEvidence(addr))
+
+	// light client attack evidence implicates all its byzantine validators
+	byzVals, byzPrivVals := types.RandValidatorSet(2, 10)
+	header := makeHeaderRandom(height - 1)
+	header.ValidatorsHash = byzVals.Hash()
+	blockID := makeBlockID(header.Hash(), 1000, []byte("partshash"))
+	voteSet := types.NewVoteSet(evidenceChainID, header.Height, 1, tmproto.SignedMsgType(2), byzVals)
+	commit, err := types.MakeCommit(blockID, header.Height, 1, voteSet, byzPrivVals, defaultEvidenceTime)
+	require.NoError(t, err)
+	lcae := &types.LightClientAttackEvidence{
+		ConflictingBlock: &types.LightBlock{
+			SignedHeader: &types.SignedHeader{Header: header, Commit: commit},
+			ValidatorSet: byzVals,
+		},
+		CommonHeight:        header.Height,
+		TotalVotingPower:    byzVals.TotalVotingPower(),
+		ByzantineValidators: byzVals.Validators,
+		Timestamp:           defaultEvidenceTime,
+	}
+	for _, byzVal := range byzVals.Validators {
+		require.False(t, hasEvidence(byzVal.Address))
+	}
+	require.NoError(t, pool.AddVerifiedEvidence(lcae))
+	for _, byzVal := range byzVals.Validators {
+		require.True(t, hasEvidence(byzVal.Address))
+	}
+	require.False(t, hasEvidence(types.NewMockPV().PrivKey.PubKey().Address()))
+
+	// validators are no longer implicated once the evidence is committed
+	state := pool.State()
+	state.LastBlockHeight++
+	pool.Update(state, types.EvidenceList{dve, lcae})
+	require.False(t, hasEvidence(addr))
+	for _, byzVal := range byzVals.Validators {
+		require.False(t, hasEvidence(byzVal.Address))
+	}
+}
+
+func TestConcurrentReadsDuringUpdates(t *testing.T) {
+	var height int64 = 10
+	pool, val := defaultTestPool(t, height)
+	require.NoError(t, pool.AddEvidence(newTestDuplicateVoteEvidence(height, val)))
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				assert.GreaterOrEqual(t, pool.State().LastBlockHeight, height)
+				assert.NotZero(t, pool.EvidenceParams().MaxAgeNumBlocks)
+				evList, _ := pool.PendingEvidence(-1)
+				assert.Len(t, evList, 1)
+			}
+		}()
+	}
+
+	state := pool.State()
+	for i := 0; i < 100; i++ {
+		state.LastBlockHeight++
+		pool.Update(state, nil)
+		pool.Flush()
+	}
+	close(done)
+	wg.Wait()
+	require.Equal(t, state.LastBlockHeight, pool.State().LastBlockHeight)
+}
+
+func BenchmarkStateConcurrentReads(b *testing.B) {
+	pool := newTestPool(b, 10, types.NewMockPV(), dbm.NewMemDB())
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_ = pool.State()
+		}
+	})
 }
 
 func TestEvidencePoolUpdate(t *testing.T) {
@@ -191,202 +874,3323 @@ func TestEvidencePoolUpdate(t *testing.T) {
 	lastCommit := makeCommit(height, val.PrivKey.PubKey().Address())
 	block := types.MakeBlock(height+1, []types.Tx{}, lastCommit, []types.Evidence{ev})
 
-	// update state (partially)
-	state.LastBlockHeight = height + 1
-	state.LastBlockTime = defaultEvidenceTime.Add(22 * time.Minute)
+	// update state (partially)
+	state.LastBlockHeight = height + 1
+	state.LastBlockTime = defaultEvidenceTime.Add(22 * time.Minute)
+
+	require.NoError(t, pool.CheckEvidence(types.EvidenceList{ev}))
+
+	pool.Update(state, block.Evidence.Evidence)
+
+	// a) Update marks evidence as committed so pending evidence should be empty
+	evList, evSize := pool.PendingEvidence(defaultEvidenceMaxBytes)
+	require.Empty(t, evList)
+	require.Zero(t, evSize)
+
+	// b) If we try to check this evidence again it should fail because it has already been committed
+	err := pool.CheckEvidence(types.EvidenceList{ev})
+	if assert.Error(t, err) {
+		assert.Equal(t, "evidence was already committed", err.(*types.ErrInvalidEvidence).Reason.Error())
+	}
+}
+
+func TestVerifyPendingEvidencePasses(t *testing.T) {
+	var height int64 = 1
+
+	pool, val := defaultTestPool(t, height)
+	ev := types.NewMockDuplicateVoteEvidenceWithValidator(
+		height,
+		defaultEvidenceTime.Add(1*time.Minute),
+		val,
+		evidenceChainID,
+	)
+
+	require.NoError(t, pool.AddEvidence(ev))
+	require.NoError(t, pool.CheckEvidence(types.EvidenceList{ev}))
+}
+
+func TestVerifyDuplicatedEvidenceFails(t *testing.T) {
+	var height int64 = 1
+	pool, val := defaultTestPool(t, height)
+	ev := types.NewMockDuplicateVoteEvidenceWithValidator(
+		height,
+		defaultEvidenceTime.Add(1*time.Minute),
+		val,
+		evidenceChainID,
+	)
+
+	err := pool.CheckEvidence(types.EvidenceList{ev, ev})
+	if assert.Error(t, err) {
+		assert.Equal(t, "duplicate evidence", err.(*types.ErrInvalidEvidence).Reason.Error())
+	}
+}
+
+func TestCheckEvidenceDuplicatePositions(t *testing.T) {
+	var height int64 = 10
+	pool, val := defaultTestPool(t, height)
+
+	evs := make(types.EvidenceList, 5)
+	for i := range evs {
+		evs[i] = newTestDuplicateVoteEvidence(height-int64(i), val)
+	}
+	require.NoError(t, pool.CheckEvidence(evs))
+
+	testCases := []struct {
+		name   string
+		evList types.EvidenceList
+		dupIdx int // index of the first repeated evidence, -1 for none
+	}{
+		{"adjacent at start", types.EvidenceList{evs[0], evs[0], evs[1], evs[2]}, 1},
+		{"first and last", types.EvidenceList{evs[0], evs[1], evs[2], evs[0]}, 3},
+		{"in the middle", types.EvidenceList{evs[0], evs[1], evs[2], evs[1], evs[3]}, 3},
+		{"adjacent at end", types.EvidenceList{evs[0], evs[1], evs[2], evs[2]}, 3},
+		{"repeated twice", types.EvidenceList{evs[4], evs[3], evs[4], evs[4]}, 2},
+		{"no duplicates", evs, -1},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			err := pool.CheckEvidence(tc.evList)
+			errs := pool.CheckEvidenceDetailed(tc.evList)
+			if tc.dupIdx == -1 {
+				require.NoError(t, err)
+				require.Equal(t, make([]error, len(tc.evList)), errs)
+				return
+			}
+
+			var invalidErr *types.ErrInvalidEvidence
+			require.True(t, errors.As(err, &invalidErr), err)
+			require.Equal(t, "duplicate evidence", invalidErr.Reason.Error())
+			require.Equal(t, tc.evList[tc.dupIdx], invalidErr.Evidence)
+			require.Equal(t, err, errs[tc.dupIdx])
+			for idx := 0; idx < tc.dupIdx; idx++ {
+				require.NoError(t, errs[idx])
+			}
+		})
+	}
+}
+
+func BenchmarkCheckEvidenceDuplicates(b *testing.B) {
+	var height int64 = 10
+	for _, n := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("evidence=%d", n), func(b *testing.B) {
+			val := types.NewMockPV()
+			pool := newTestPool(b, height, val, dbm.NewMemDB(),
+				evidence.WithVerifier(verifierFunc(func(types.Evidence, sm.State) error { return nil })))
+			evList := make(types.EvidenceList, n)
+			for i := range evList {
+				evList[i] = newTestDuplicateVoteEvidence(height-int64(i%int(height)), val)
+				require.NoError(b, pool.AddEvidence(evList[i]))
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := pool.CheckEvidence(evList); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckEvidenceDetailed(t *testing.T) {
+	var height int64 = 10
+	pool, val := defaultTestPool(t, height)
+
+	committed := newTestDuplicateVoteEvidence(height-2, val)
+	require.NoError(t, pool.AddEvidence(committed))
+	state := pool.State()
+	state.LastBlockHeight++
+	pool.Update(state, types.EvidenceList{committed})
+
+	valid := newTestDuplicateVoteEvidence(height, val)
+	pending := newTestDuplicateVoteEvidence(height-1, val)
+	require.NoError(t, pool.AddEvidence(pending))
+	// evidence against a validator that isn't in the validator set
+	unknown := newTestDuplicateVoteEvidence(height-1, types.NewMockPV())
+
+	evList := types.EvidenceList{valid, committed, pending, unknown, valid}
+	errs := pool.CheckEvidenceDetailed(evList)
+	require.Len(t, errs, len(evList))
+	var invalidErr *types.ErrInvalidEvidence
+	assert.NoError(t, errs[0])
+	if assert.True(t, errors.As(errs[1], &invalidErr)) {
+		assert.Equal(t, "evidence was already committed", invalidErr.Reason.Error())
+	}
+	assert.NoError(t, errs[2])
+	assert.True(t, errors.As(errs[3], &invalidErr))
+	if assert.True(t, errors.As(errs[4], &invalidErr)) {
+		assert.Equal(t, "duplicate evidence", invalidErr.Reason.Error())
+	}
+
+	// valid evidence is added to the pool, like with CheckEvidence, which
+	// stops at the first problem
+	require.EqualValues(t, 2, pool.Size())
+	require.Equal(t, errs[1], pool.CheckEvidence(evList))
+	require.Equal(t, make([]error, 2), pool.CheckEvidenceDetailed(types.EvidenceList{valid, pending}))
+}
+
+// check that valid light client evidence is correctly validated and stored in
+// evidence pool
+func TestCheckEvidenceWithoutStore(t *testing.T) {
+	var height int64 = 10
+	val := types.NewMockPV()
+	evidenceDB := &unavailableDB{DB: dbm.NewMemDB()}
+	verified := 0
+	pool := newTestPool(t, height, val, evidenceDB, evidence.WithVerifier(verifierFunc(
+		func(types.Evidence, sm.State) error {
+			verified++
+			return nil
+		})))
+
+	// the evidence is valid but can't be stored
+	ev := newTestDuplicateVoteEvidence(height, val)
+	evidenceDB.failures = 1
+	require.NoError(t, pool.CheckEvidence(types.EvidenceList{ev}))
+	require.Equal(t, 1, verified)
+	require.Zero(t, pool.Size())
+
+	// it is kept in memory, so it needn't be verified again and can still be
+	// turned into ABCI evidence
+	require.NoError(t, pool.CheckEvidence(types.EvidenceList{ev}))
+	require.Equal(t, 1, verified)
+	found, status, err := pool.GetEvidenceByHash(ev.Hash())
+	require.NoError(t, err)
+	require.Equal(t, evidence.EvidencePending, status)
+	require.Equal(t, ev, found)
+	require.NotEmpty(t, found.ABCI())
+
+	// the next update stores it
+	state := pool.State()
+	state.LastBlockHeight++
+	pool.Update(state, nil)
+	require.EqualValues(t, 1, pool.Size())
+	require.NoError(t, pool.CheckEvidence(types.EvidenceList{ev}))
+	require.Equal(t, 1, verified)
+
+	// and forgets it once it's committed
+	state.LastBlockHeight++
+	pool.Update(state, types.EvidenceList{ev})
+	require.Zero(t, pool.Size())
+	_, status, err = pool.GetEvidenceByHash(ev.Hash())
+	require.NoError(t, err)
+	require.Equal(t, evidence.EvidenceCommitted, status)
+}
+
+func TestRestoreEvidenceWithoutStore(t *testing.T) {
+	var height int64 = 10
+	val := types.NewMockPV()
+	evidenceDB := &unavailableDB{DB: dbm.NewMemDB()}
+	pool := newTestPool(t, height, val, evidenceDB, evidence.WithVerifier(verifierFunc(
+		func(types.Evidence, sm.State) error { return nil })))
+	before, err := pool.Snapshot()
+	require.NoError(t, err)
+
+	// the evidence is kept in memory as it can't be stored
+	ev := newTestDuplicateVoteEvidence(height, val)
+	evidenceDB.failures = 1
+	require.NoError(t, pool.CheckEvidence(types.EvidenceList{ev}))
+	after, err := pool.Snapshot()
+	require.NoError(t, err)
+
+	// it's forgotten by restoring a snapshot taken before it was checked
+	require.NoError(t, pool.Restore(before))
+	_, status, err := pool.GetEvidenceByHash(ev.Hash())
+	require.NoError(t, err)
+	require.Equal(t, evidence.EvidenceNotFound, status)
+
+	// and kept again by restoring one taken after
+	require.NoError(t, pool.Restore(after))
+	found, status, err := pool.GetEvidenceByHash(ev.Hash())
+	require.NoError(t, err)
+	require.Equal(t, evidence.EvidencePending, status)
+	require.Equal(t, ev, found)
+	require.Zero(t, pool.Size())
+}
+
+func TestCheckEvidenceInSyncMode(t *testing.T) {
+	var height int64 = 10
+	val := types.NewMockPV()
+
+	// the evidence of five blocks
+	var blocks []types.EvidenceList
+	for h := int64(1); h <= 5; h++ {
+		blocks = append(blocks, types.EvidenceList{newTestDuplicateVoteEvidence(h, val)})
+	}
+
+	checkBlocks := func(syncing bool) (*evidence.Pool, int) {
+		stateStore := &countingStateStore{Store: initializeValidatorState(t, val, height)}
+		state, err := stateStore.Load()
+		require.NoError(t, err)
+		blockStore := initializeBlockStore(dbm.NewMemDB(), state, val.PrivKey.PubKey().Address())
+		pool, err := evidence.NewPool(log.TestingLogger(), dbm.NewMemDB(), stateStore, blockStore,
+			evidence.WithValidatorSetCacheSize(0),
+			evidence.WithSyncSignal(func() bool { return syncing }))
+		require.NoError(t, err)
+
+		for _, evList := range blocks {
+			require.NoError(t, pool.CheckEvidence(evList))
+		}
+		return pool, stateStore.loads
+	}
+
+	// every piece of evidence is verified against its validator set
+	pool, loads := checkBlocks(false)
+	require.Equal(t, len(blocks), loads)
+	require.EqualValues(t, len(blocks), pool.Size())
+
+	// none is verified while syncing, nor added to the pending pool
+	pool, loads = checkBlocks(true)
+	require.Zero(t, loads)
+	require.EqualValues(t, 0, pool.Size())
+
+	// but duplicate and malformed evidence is still rejected
+	ev := blocks[0][0].(*types.DuplicateVoteEvidence)
+	require.Error(t, pool.CheckEvidence(types.EvidenceList{ev, ev}))
+	malformed := *ev
+	malformed.VoteA, malformed.VoteB = ev.VoteB, ev.VoteA
+	require.Error(t, pool.CheckEvidence(types.EvidenceList{&malformed}))
+}
+
+func TestCheckEvidenceWithLightClientAttack(t *testing.T) {
+	var (
+		nValidators          = 5
+		validatorPower int64 = 10
+		height         int64 = 10
+	)
+
+	conflictingVals, conflictingPrivVals := types.RandValidatorSet(nValidators, validatorPower)
+	trustedHeader := makeHeaderRandom(height)
+	trustedHeader.Time = defaultEvidenceTime
+
+	conflictingHeader := makeHeaderRandom(height)
+	conflictingHeader.ValidatorsHash = conflictingVals.Hash()
+
+	trustedHeader.ValidatorsHash = conflictingHeader.ValidatorsHash
+	trustedHeader.NextValidatorsHash = conflictingHeader.NextValidatorsHash
+	trustedHeader.ConsensusHash = conflictingHeader.ConsensusHash
+	trustedHeader.AppHash = conflictingHeader.AppHash
+	trustedHeader.LastResultsHash = conflictingHeader.LastResultsHash
+
+	// For simplicity we are simulating a duplicate vote attack where all the
+	// validators in the conflictingVals set voted twice.
+	blockID := makeBlockID(conflictingHeader.Hash(), 1000, []byte("partshash"))
+	voteSet := types.NewVoteSet(evidenceChainID, height, 1, tmproto.SignedMsgType(2), conflictingVals)
+
+	commit, err := types.MakeCommit(blockID, height, 1, voteSet, conflictingPrivVals, defaultEvidenceTime)
+	require.NoError(t, err)
+
+	ev := &types.LightClientAttackEvidence{
+		ConflictingBlock: &types.LightBlock{
+			SignedHeader: &types.SignedHeader{
+				Header: conflictingHeader,
+				Commit: commit,
+			},
+			ValidatorSet: conflictingVals,
+		},
+		CommonHeight:        10,
+		TotalVotingPower:    int64(nValidators) * validatorPower,
+		ByzantineValidators: conflictingVals.Validators,
+		Timestamp:           defaultEvidenceTime,
+	}
+
+	trustedBlockID := makeBlockID(trustedHeader.Hash(), 1000, []byte("partshash"))
+	trustedVoteSet := types.NewVoteSet(evidenceChainID, height, 1, tmproto.SignedMsgType(2), conflictingVals)
+	trustedCommit, err := types.MakeCommit(
+		trustedBlockID,
+		height,
+		1,
+		trustedVoteSet,
+		conflictingPrivVals,
+		defaultEvidenceTime,
+	)
+	require.NoError(t, err)
+
+	state := sm.State{
+		LastBlockTime:   defaultEvidenceTime.Add(1 * time.Minute),
+		LastBlockHeight: 11,
+		ConsensusParams: *types.DefaultConsensusParams(),
+	}
+
+	stateStore := &smmocks.Store{}
+	stateStore.On("LoadValidators", height).Return(conflictingVals, nil)
+	stateStore.On("Load").Return(state, nil)
+
+	blockStore := &mocks.BlockStore{}
+	blockStore.On("LoadBlockMeta", height).Return(&types.BlockMeta{Header: *trustedHeader})
+	blockStore.On("LoadBlockCommit", height).Return(trustedCommit)
+
+	pool, err := evidence.NewPool(log.TestingLogger(), dbm.NewMemDB(), stateStore, blockStore)
+	require.NoError(t, err)
+
+	require.NoError(t, pool.AddEvidence(ev))
+	require.NoError(t, pool.CheckEvidence(types.EvidenceList{ev}))
+
+	// Take away the last signature -> there are less validators then what we have detected,
+	// hence this should fail.
+	commit.Signatures = append(commit.Signatures[:nValidators-1], types.NewCommitSigAbsent())
+	require.Error(t, pool.CheckEvidence(types.EvidenceList{ev}))
+}
+
+func TestCheckEvidenceBounds(t *testing.T) {
+	var height int64 = 10
+	verified := false
+	pool, val := defaultTestPool(t, height, evidence.WithMaxByzantineValidators(100),
+		evidence.WithVerifier(verifierFunc(func(types.Evidence, sm.State) error {
+			verified = true
+			return nil
+		})))
+
+	// evidence accusing too many validators is rejected without copying or
+	// encoding the validators
+	byzVal := types.NewValidator(val.PrivKey.PubKey(), 10)
+	lcae := &types.LightClientAttackEvidence{
+		CommonHeight:        height,
+		ByzantineValidators: make([]*types.Validator, types.MaxVotesCount),
+		Timestamp:           defaultEvidenceTime,
+	}
+	for i := range lcae.ByzantineValidators {
+		lcae.ByzantineValidators[i] = byzVal
+	}
+	err := pool.CheckEvidence(types.EvidenceList{lcae})
+	require.True(t, errors.Is(err, evidence.ErrTooManyByzantineValidators), err)
+	_, ok := err.(*types.ErrInvalidEvidence)
+	require.True(t, ok)
+	allocs := testing.AllocsPerRun(10, func() { _ = pool.CheckEvidence(types.EvidenceList{lcae}) })
+	require.Less(t, allocs, float64(20))
+	require.False(t, verified)
+
+	// evidence larger than the limit is rejected before it is verified
+	ev := newTestDuplicateVoteEvidence(height, val)
+	pool, _ = defaultTestPool(t, height, evidence.WithMaxEvidenceBytes(10),
+		evidence.WithVerifier(verifierFunc(func(types.Evidence, sm.State) error {
+			verified = true
+			return nil
+		})))
+	err = pool.CheckEvidence(types.EvidenceList{ev})
+	require.True(t, errors.Is(err, evidence.ErrEvidenceTooLarge), err)
+	require.False(t, verified)
+	require.Zero(t, pool.Size())
+
+	// by default evidence is limited by the evidence consensus params
+	pool, val = defaultTestPool(t, height)
+	require.NoError(t, pool.CheckEvidence(types.EvidenceList{newTestDuplicateVoteEvidence(height, val)}))
+	state := pool.State()
+	state.LastBlockHeight++
+	state.ConsensusParams.Evidence.MaxBytes = 10
+	pool.Update(state, nil)
+	err = pool.CheckEvidence(types.EvidenceList{newTestDuplicateVoteEvidence(height-1, val)})
+	require.True(t, errors.Is(err, evidence.ErrEvidenceTooLarge), err)
+}
+
+// Tests that restarting the evidence pool after a potential failure will recover the
+// pending evidence and continue to gossip it
+func TestEvidenceBelowRetainedHeight(t *testing.T) {
+	var height int64 = 10
+
+	testCases := []struct {
+		policy         evidence.PrunedEvidencePolicy
+		expCheckPasses bool
+	}{
+		{evidence.RejectPrunedEvidence, false},
+		{evidence.TrustPrunedEvidenceFromConsensus, true},
+	}
+
+	for _, tc := range testCases {
+		val := types.NewMockPV()
+		stateStore := initializeValidatorState(t, val, height)
+		state, err := stateStore.Load()
+		require.NoError(t, err)
+		blockStore := initializeBlockStore(dbm.NewMemDB(), state, val.PrivKey.PubKey().Address())
+		pool, err := evidence.NewPool(log.TestingLogger(), dbm.NewMemDB(), stateStore, blockStore,
+			evidence.WithPrunedEvidencePolicy(tc.policy))
+		require.NoError(t, err)
+
+		_, err = blockStore.PruneBlocks(6)
+		require.NoError(t, err)
+
+		// peers are never punished for sending evidence we can't verify
+		pruned := newTestDuplicateVoteEvidence(4, val)
+		err = pool.AddEvidence(pruned)
+		require.True(t, errors.Is(err, evidence.ErrBelowRetainedHeight), err)
+		_, ok := err.(*types.ErrInvalidEvidence)
+		require.False(t, ok)
+
+		err = pool.CheckEvidence(types.EvidenceList{pruned})
+		if tc.expCheckPasses {
+			require.NoError(t, err)
+		} else {
+			require.True(t, errors.Is(err, evidence.ErrBelowRetainedHeight), err)
+		}
+		// unverified evidence is never gossiped
+		require.EqualValues(t, 0, pool.Size())
+
+		// evidence within the retained range is verified as usual
+		require.NoError(t, pool.AddEvidence(newTestDuplicateVoteEvidence(8, val)))
+		require.EqualValues(t, 1, pool.Size())
+	}
+}
+
+func TestRecoverPendingEvidence(t *testing.T) {
+	height := int64(10)
+	val := types.NewMockPV()
+	valAddress := val.PrivKey.PubKey().Address()
+	evidenceDB := dbm.NewMemDB()
+	stateStore := initializeValidatorState(t, val, height)
+
+	state, err := stateStore.Load()
+	require.NoError(t, err)
+
+	blockStore := initializeBlockStore(dbm.NewMemDB(), state, valAddress)
+
+	// create previous pool and populate it
+	pool, err := evidence.NewPool(log.TestingLogger(), evidenceDB, stateStore, blockStore)
+	require.NoError(t, err)
+
+	goodEvidence := types.NewMockDuplicateVoteEvidenceWithValidator(
+		height,
+		defaultEvidenceTime.Add(10*time.Minute),
+		val,
+		evidenceChainID,
+	)
+	expiredEvidence := types.NewMockDuplicateVoteEvidenceWithValidator(
+		int64(1),
+		defaultEvidenceTime.Add(1*time.Minute),
+		val,
+		evidenceChainID,
+	)
+
+	require.NoError(t, pool.AddEvidence(goodEvidence))
+	require.NoError(t, pool.AddEvidence(expiredEvidence))
+	require.NoError(t, pool.Close())
+
+	// now recover from the previous pool at a different time
+	newStateStore := &smmocks.Store{}
+	newStateStore.On("Load").Return(sm.State{
+		LastBlockTime:   defaultEvidenceTime.Add(25 * time.Minute),
+		LastBlockHeight: height + 15,
+		ConsensusParams: types.ConsensusParams{
+			Block: types.BlockParams{
+				MaxBytes: 22020096,
+				MaxGas:   -1,
+			},
+			Evidence: types.EvidenceParams{
+				MaxAgeNumBlocks: 20,
+				MaxAgeDuration:  20 * time.Minute,
+				MaxBytes:        1000,
+			},
+		},
+	}, nil)
+
+	newPool, err := evidence.NewPool(log.TestingLogger(), evidenceDB, newStateStore, blockStore)
+	require.NoError(t, err)
+
+	evList, _ := newPool.PendingEvidence(defaultEvidenceMaxBytes)
+	require.Equal(t, 1, len(evList))
+
+	next := newPool.EvidenceFront()
+	require.Equal(t, goodEvidence, next.Value.(types.Evidence))
+}
+
+func TestRecoverPruningPoint(t *testing.T) {
+	var height int64 = 10
+	val := types.NewMockPV()
+	evidenceDB := dbm.NewMemDB()
+
+	// the pruning point of an empty pool is the current height and time
+	pool := newTestPool(t, height, val, evidenceDB)
+	pruningHeight, pruningTime := pool.PruningPoint()
+	require.Equal(t, height, pruningHeight)
+	require.Equal(t, pool.State().LastBlockTime, pruningTime)
+	ev := newTestDuplicateVoteEvidence(1, val)
+	require.NoError(t, pool.AddEvidence(ev))
+	require.NoError(t, pool.Close())
+
+	// the persisted pruning point is restored without scanning the evidence
+	pool = newTestPool(t, height, val, evidenceDB)
+	pruningHeight, pruningTime = pool.PruningPoint()
+	require.Equal(t, height, pruningHeight)
+	require.Equal(t, pool.State().LastBlockTime, pruningTime)
+
+	// without it, the pending evidence determines the pruning point
+	key, err := orderedcode.Append(nil, int64(14))
+	require.NoError(t, err)
+	require.NoError(t, evidenceDB.Delete(key))
+	require.NoError(t, pool.Close())
+	pool = newTestPool(t, height, val, evidenceDB)
+	params := pool.State().ConsensusParams.Evidence
+	pruningHeight, pruningTime = pool.PruningPoint()
+	require.Equal(t, ev.Height()+params.MaxAgeNumBlocks, pruningHeight)
+	require.Equal(t, ev.Time().Add(params.MaxAgeDuration), pruningTime)
+}
+
+func TestPendingBytes(t *testing.T) {
+	var height int64 = 10
+	val := types.NewMockPV()
+	evidenceDB := dbm.NewMemDB()
+	pool := newTestPool(t, height, val, evidenceDB)
+	evBytes := func(evs ...types.Evidence) int64 {
+		var total int64
+		for _, ev := range evs {
+			evpb, err := types.EvidenceToProto(ev)
+			require.NoError(t, err)
+			total += int64(evpb.Size())
+		}
+		return total
+	}
+
+	require.Zero(t, pool.PendingBytes())
+	expired := newTestDuplicateVoteEvidence(1, val)
+	committed := newTestDuplicateVoteEvidence(height-1, val)
+	pending := newTestDuplicateVoteEvidence(height, val)
+	for _, ev := range []types.Evidence{expired, committed, pending} {
+		require.NoError(t, pool.AddEvidence(ev))
+	}
+	require.Equal(t, evBytes(expired, committed, pending), pool.PendingBytes())
+
+	// evidence that is already pending isn't counted twice
+	require.NoError(t, pool.AddEvidence(pending))
+	require.Equal(t, evBytes(expired, committed, pending), pool.PendingBytes())
+
+	// commit one and expire another evidence
+	state := pool.State()
+	state.LastBlockHeight++
+	state.LastBlockTime = defaultEvidenceTime.Add(time.Hour)
+	state.ConsensusParams.Evidence.MaxAgeNumBlocks = 5
+	state.ConsensusParams.Evidence.MaxAgeDuration = 30 * time.Minute
+	pool.Update(state, types.EvidenceList{committed})
+	require.EqualValues(t, 1, pool.Size())
+	require.Equal(t, evBytes(pending), pool.PendingBytes())
+
+	// the total is recovered on restart
+	require.NoError(t, pool.Close())
+	require.Equal(t, evBytes(pending), newTestPool(t, height, val, evidenceDB).PendingBytes())
+}
+
+func TestMaxExpiredPerUpdate(t *testing.T) {
+	const maxExpired = 5
+	var height int64 = 40
+	pool, val := defaultTestPool(t, height, evidence.WithMaxExpiredPerUpdate(maxExpired))
+
+	var unexpired []types.Evidence
+	for h := int64(20); h <= height; h++ {
+		if h > 30 && h <= 35 {
+			continue
+		}
+		ev := newTestDuplicateVoteEvidence(h, val)
+		require.NoError(t, pool.AddEvidence(ev))
+		if h > 35 {
+			unexpired = append(unexpired, ev)
+		}
+	}
+	require.EqualValues(t, 16, pool.Size())
+
+	// the evidence up to height 30 expires at once, but is pruned over several
+	// updates
+	state := pool.State()
+	state.LastBlockTime = defaultEvidenceTime.Add(2 * time.Hour)
+	state.ConsensusParams.Evidence.MaxAgeNumBlocks = 8
+	for _, expected := range []uint32{11, 6, 5, 5} {
+		state.LastBlockHeight++
+		pool.Update(state, nil)
+		require.Equal(t, expected, pool.Size())
+
+		// expired evidence is never proposed
+		evList, _ := pool.PendingEvidence(-1)
+		require.Equal(t, unexpired, evList)
+		evList, _ = pool.PendingEvidenceExcluding(nil, -1)
+		require.Equal(t, unexpired, evList)
+	}
+}
+
+func TestBackgroundPruning(t *testing.T) {
+	var height int64 = 30
+	var (
+		clockMtx sync.Mutex
+		now      = defaultEvidenceTime.Add(30 * time.Minute)
+	)
+	clock := func() time.Time {
+		clockMtx.Lock()
+		defer clockMtx.Unlock()
+		return now
+	}
+	advance := func(d time.Duration) {
+		clockMtx.Lock()
+		defer clockMtx.Unlock()
+		now = now.Add(d)
+	}
+	overrides := map[evidence.EvidenceType]evidence.ExpiryParams{
+		evidence.DuplicateVoteEvidenceType: {MaxAgeNumBlocks: 10, MaxAgeDuration: time.Hour},
+	}
+	pool, val := defaultTestPool(t, height, evidence.WithClock(clock), evidence.WithExpiryOverrides(overrides),
+		evidence.WithBackgroundPruning(time.Millisecond))
+
+	// the first evidence is older than MaxAgeNumBlocks, and also older than
+	// MaxAgeDuration once the clock advances
+	expired := newTestDuplicateVoteEvidence(5, val)
+	unexpired := newTestDuplicateVoteEvidence(25, val)
+	require.NoError(t, pool.AddEvidence(expired))
+	require.NoError(t, pool.AddEvidence(unexpired))
+
+	// nothing is pruned until background pruning is started
+	advance(time.Hour)
+	time.Sleep(10 * time.Millisecond)
+	require.EqualValues(t, 2, pool.Size())
+
+	// the first evidence is pruned although only the clock advanced
+	pool.StartPruning()
+	pool.StartPruning()
+	require.Eventually(t, func() bool { return pool.Size() == 1 }, time.Second, time.Millisecond)
+	evList, _ := pool.PendingEvidence(-1)
+	require.Equal(t, []types.Evidence{unexpired}, evList)
+	require.Equal(t, height, pool.State().LastBlockHeight)
+
+	// the other evidence stays pending however far the clock advances, as it's
+	// too recent in blocks
+	advance(1000 * time.Hour)
+	time.Sleep(10 * time.Millisecond)
+	require.EqualValues(t, 1, pool.Size())
+
+	pool.StopPruning()
+	pool.StopPruning()
+}
+
+func TestNextPrune(t *testing.T) {
+	var height int64 = 10
+	pool, val := defaultTestPool(t, height)
+	params := pool.EvidenceParams()
+
+	// without pending evidence nothing expires before the next block
+	pruningHeight, pruningTime := pool.NextPrune()
+	require.Equal(t, height, pruningHeight)
+	require.Equal(t, pool.State().LastBlockTime, pruningTime)
+
+	expiry := func(ev types.Evidence) (int64, time.Time) {
+		return ev.Height() + params.MaxAgeNumBlocks, ev.Time().Add(params.MaxAgeDuration)
+	}
+
+	// the next prune is when the oldest pending evidence expires
+	ev5 := newTestDuplicateVoteEvidence(5, val)
+	require.NoError(t, pool.AddEvidence(ev5))
+	expectedHeight, expectedTime := expiry(ev5)
+	pruningHeight, pruningTime = pool.NextPrune()
+	require.Equal(t, expectedHeight, pruningHeight)
+	require.Equal(t, expectedTime, pruningTime)
+
+	ev3 := newTestDuplicateVoteEvidence(3, val)
+	require.NoError(t, pool.AddEvidence(ev3))
+	require.NoError(t, pool.AddEvidence(newTestDuplicateVoteEvidence(8, val)))
+	expectedHeight, expectedTime = expiry(ev3)
+	pruningHeight, pruningTime = pool.NextPrune()
+	require.Equal(t, expectedHeight, pruningHeight)
+	require.Equal(t, expectedTime, pruningTime)
+
+	// once the oldest evidence is pruned, the next prune is when the next
+	// evidence expires
+	state := pool.State()
+	state.LastBlockHeight = expectedHeight + 1
+	state.LastBlockTime = expectedTime.Add(time.Second)
+	pool.Update(state, nil)
+	require.EqualValues(t, 2, pool.Size())
+	expectedHeight, expectedTime = expiry(ev5)
+	pruningHeight, pruningTime = pool.NextPrune()
+	require.Equal(t, expectedHeight, pruningHeight)
+	require.Equal(t, expectedTime, pruningTime)
+}
+
+func TestExpiryOverrides(t *testing.T) {
+	var height int64 = 10
+	val := types.NewMockPV()
+	overrides := map[evidence.EvidenceType]evidence.ExpiryParams{
+		evidence.LightClientAttackEvidenceType: {MaxAgeNumBlocks: 20, MaxAgeDuration: 2 * time.Hour},
+	}
+	pool := newTestPool(t, height, val, dbm.NewMemDB(), evidence.WithExpiryOverrides(overrides))
+	defaultPool := newTestPool(t, height, val, dbm.NewMemDB())
+
+	byzVals, byzPrivVals := types.RandValidatorSet(2, 10)
+	header := makeHeaderRandom(2)
+	header.ValidatorsHash = byzVals.Hash()
+	blockID := makeBlockID(header.Hash(), 1000, []byte("partshash"))
+	voteSet := types.NewVoteSet(evidenceChainID, header.Height, 1, tmproto.SignedMsgType(2), byzVals)
+	commit, err := types.MakeCommit(blockID, header.Height, 1, voteSet, byzPrivVals, defaultEvidenceTime)
+	require.NoError(t, err)
+	lcae := &types.LightClientAttackEvidence{
+		ConflictingBlock: &types.LightBlock{
+			SignedHeader: &types.SignedHeader{Header: header, Commit: commit},
+			ValidatorSet: byzVals,
+		},
+		CommonHeight:        header.Height,
+		TotalVotingPower:    byzVals.TotalVotingPower(),
+		ByzantineValidators: byzVals.Validators,
+		Timestamp:           defaultEvidenceTime.Add(2 * time.Minute),
+	}
+	dve := newTestDuplicateVoteEvidence(2, val)
+	later := newTestDuplicateVoteEvidence(height, val)
+	for _, p := range []*evidence.Pool{pool, defaultPool} {
+		require.NoError(t, p.AddEvidence(dve))
+		require.NoError(t, p.AddVerifiedEvidence(lcae))
+		require.NoError(t, p.AddEvidence(later))
+	}
+
+	state := pool.State()
+	state.ConsensusParams.Evidence.MaxAgeNumBlocks = 5
+	state.ConsensusParams.Evidence.MaxAgeDuration = 30 * time.Minute
+	update := func(height int64, blockTime time.Duration) {
+		state.LastBlockHeight = height
+		state.LastBlockTime = defaultEvidenceTime.Add(blockTime)
+		pool.Update(state, nil)
+		defaultPool.Update(state, nil)
+	}
+
+	// both evidence from height 2 expire under the consensus params, but the
+	// light client attack evidence is kept by its override
+	update(height+1, time.Hour)
+	evList, _ := defaultPool.PendingEvidence(-1)
+	require.Equal(t, []types.Evidence{later}, evList)
+	evList, _ = pool.PendingEvidence(-1)
+	require.Equal(t, []types.Evidence{lcae, later}, evList)
+
+	// evidence after the light client attack evidence still expires in time
+	update(17, 90*time.Minute)
+	evList, _ = pool.PendingEvidence(-1)
+	require.Equal(t, []types.Evidence{lcae}, evList)
+	require.EqualValues(t, 1, pool.Size())
+
+	// until it expires by its override as well
+	update(23, 3*time.Hour)
+	require.Zero(t, pool.Size())
+}
+
+func TestEvidenceExpiresAtBoundary(t *testing.T) {
+	var height int64 = 10
+	pool, val := defaultTestPool(t, height)
+
+	state := pool.State()
+	state.ConsensusParams.Evidence.MaxAgeNumBlocks = 2
+	state.ConsensusParams.Evidence.MaxAgeDuration = time.Minute
+
+	ev := newTestDuplicateVoteEvidence(height, val)
+	require.NoError(t, pool.AddEvidence(ev))
+	expiryTime := ev.Time().Add(time.Minute)
+
+	// the block clock advances past the evidence's maximum age in blocks but
+	// only reaches its maximum age in time
+	for h := height + 1; h <= height+3; h++ {
+		state.LastBlockHeight = h
+		state.LastBlockTime = expiryTime
+		pool.Update(state, types.EvidenceList{})
+		require.EqualValues(t, 1, pool.Size(), h)
+	}
+
+	// one nanosecond later the evidence has expired
+	state.LastBlockHeight++
+	state.LastBlockTime = expiryTime.Add(time.Nanosecond)
+	pool.Update(state, types.EvidenceList{})
+	require.EqualValues(t, 0, pool.Size())
+	record, ok := pool.RemovalInfo(ev.Hash())
+	require.True(t, ok)
+	require.Equal(t, evidence.RemovalExpired, record.Reason)
+
+	// and likewise when the time is past but the height only reaches the limit
+	ev = newTestDuplicateVoteEvidence(height-1, val)
+	state.LastBlockHeight++
+	state.LastBlockTime = ev.Time().Add(time.Hour)
+	state.ConsensusParams.Evidence.MaxAgeNumBlocks = state.LastBlockHeight - ev.Height() + 1
+	pool.Update(state, types.EvidenceList{})
+	require.NoError(t, pool.AddEvidence(ev))
+
+	state.LastBlockHeight++
+	pool.Update(state, types.EvidenceList{})
+	require.EqualValues(t, 1, pool.Size())
+
+	state.LastBlockHeight++
+	pool.Update(state, types.EvidenceList{})
+	require.EqualValues(t, 0, pool.Size())
+}
+
+func TestEvidenceExpiresAtClockBoundary(t *testing.T) {
+	var height int64 = 10
+	var now time.Time
+	testCases := []struct {
+		name    string
+		offset  int64
+		expired bool
+	}{
+		{"just before", -1, false},
+		{"at", 0, false},
+		{"just after", 1, true},
+	}
+
+	// the clock moves across the maximum age in time, with the evidence past
+	// its maximum age in blocks
+	for _, tc := range testCases {
+		t.Run("time "+tc.name, func(t *testing.T) {
+			pool, val := defaultTestPool(t, height, evidence.WithClock(func() time.Time { return now }))
+			ev := newTestDuplicateVoteEvidence(height, val)
+			require.NoError(t, pool.AddEvidence(ev))
+
+			state := pool.State()
+			state.LastBlockHeight += 3
+			state.ConsensusParams.Evidence.MaxAgeNumBlocks = 2
+			state.ConsensusParams.Evidence.MaxAgeDuration = time.Minute
+			pool.Update(state, types.EvidenceList{})
+			require.EqualValues(t, 1, pool.Size())
+
+			now = ev.Time().Add(time.Minute + time.Duration(tc.offset))
+			pool.PruneExpired()
+			require.Equal(t, tc.expired, pool.Size() == 0)
+		})
+	}
+
+	// the height moves across the maximum age in blocks, with the clock past
+	// the evidence's maximum age in time
+	for _, tc := range testCases {
+		t.Run("height "+tc.name, func(t *testing.T) {
+			pool, val := defaultTestPool(t, height, evidence.WithClock(func() time.Time { return now }))
+			ev := newTestDuplicateVoteEvidence(height, val)
+			require.NoError(t, pool.AddEvidence(ev))
+
+			state := pool.State()
+			state.LastBlockHeight = ev.Height() + 2 + tc.offset
+			state.ConsensusParams.Evidence.MaxAgeNumBlocks = 2
+			state.ConsensusParams.Evidence.MaxAgeDuration = time.Minute
+			pool.Update(state, types.EvidenceList{})
+			require.EqualValues(t, 1, pool.Size())
+
+			now = ev.Time().Add(time.Hour)
+			pool.PruneExpired()
+			require.Equal(t, tc.expired, pool.Size() == 0)
+		})
+	}
+}
+
+func TestMarkEvidenceAsCommittedIsAtomic(t *testing.T) {
+	var height int64 = 10
+	val := types.NewMockPV()
+	stateStore := initializeValidatorState(t, val, height)
+	state, err := stateStore.Load()
+	require.NoError(t, err)
+	blockStore := initializeBlockStore(dbm.NewMemDB(), state, val.PrivKey.PubKey().Address())
+
+	evidenceKeys := func(ev types.Evidence) (pending, committed []byte) {
+		pending, err := orderedcode.Append(nil, int64(9), ev.Height(), string(ev.Hash()))
+		require.NoError(t, err)
+		committed, err = orderedcode.Append(nil, int64(8), ev.Height(), string(ev.Hash()))
+		require.NoError(t, err)
+		return pending, committed
+	}
+	requireStored := func(db dbm.DB, key []byte, stored bool) {
+		ok, err := db.Has(key)
+		require.NoError(t, err)
+		require.Equal(t, stored, ok)
+	}
+
+	// the node crashes while marking the evidence as committed
+	evidenceDB := &unavailableDB{DB: dbm.NewMemDB()}
+	pool, err := evidence.NewPool(log.TestingLogger(), evidenceDB, stateStore, blockStore)
+	require.NoError(t, err)
+	ev := newTestDuplicateVoteEvidence(height, val)
+	require.NoError(t, pool.AddEvidence(ev))
+	evidenceDB.failures = 1
+	pool.Update(createState(height+1, state.Validators), types.EvidenceList{ev})
+
+	pendingKey, committedKey := evidenceKeys(ev)
+	requireStored(evidenceDB, pendingKey, true)
+	requireStored(evidenceDB, committedKey, false)
+
+	require.NoError(t, pool.Close())
+	pool, err = evidence.NewPool(log.TestingLogger(), evidenceDB, stateStore, blockStore)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, pool.Size())
+
+	// an older version crashed after marking the evidence as committed but
+	// before removing it from the pending pool
+	require.NoError(t, evidenceDB.Set(committedKey, []byte{1}))
+	require.NoError(t, pool.Close())
+	pool, err = evidence.NewPool(log.TestingLogger(), evidenceDB, stateStore, blockStore)
+	require.NoError(t, err)
+	require.EqualValues(t, 0, pool.Size())
+	require.Nil(t, pool.EvidenceFront())
+	requireStored(evidenceDB, pendingKey, false)
+	requireStored(evidenceDB, committedKey, true)
+}
+
+func TestMarkBlockEvidenceAsCommittedIsAtomic(t *testing.T) {
+	var height int64 = 10
+	val := types.NewMockPV()
+	evidenceDB := &unavailableDB{DB: dbm.NewMemDB()}
+	pool := newTestPool(t, height, val, evidenceDB)
+
+	var block types.EvidenceList
+	for h := height - 2; h <= height; h++ {
+		ev := newTestDuplicateVoteEvidence(h, val)
+		require.NoError(t, pool.AddEvidence(ev))
+		block = append(block, ev)
+	}
+	pending := newTestDuplicateVoteEvidence(height, val)
+	require.NoError(t, pool.AddEvidence(pending))
+	// evidence that was never pending is committed along with the rest
+	block = append(block, newTestDuplicateVoteEvidence(height-3, val))
+
+	// none of the evidence is marked as committed if the write fails
+	evidenceDB.failures = 1
+	state := pool.State()
+	state.LastBlockHeight++
+	pool.Update(state, block)
+	require.EqualValues(t, 4, pool.Size())
+	require.NoError(t, pool.CheckConsistency())
+	for _, ev := range block {
+		_, ok := pool.CommittedHeight(ev)
+		require.False(t, ok)
+	}
+
+	// all of it is once the block is committed again, even if it lists the
+	// same evidence twice
+	state.LastBlockHeight++
+	pool.Update(state, append(block, block[0]))
+	require.EqualValues(t, 1, pool.Size())
+	evpb, err := types.EvidenceToProto(pending)
+	require.NoError(t, err)
+	require.EqualValues(t, evpb.Size(), pool.PendingBytes())
+	require.NoError(t, pool.CheckConsistency())
+	evList, _ := pool.PendingEvidence(-1)
+	require.Equal(t, []types.Evidence{pending}, evList)
+	for _, ev := range block {
+		committedHeight, ok := pool.CommittedHeight(ev)
+		require.True(t, ok)
+		require.Equal(t, state.LastBlockHeight, committedHeight)
+	}
+}
+
+func TestRemovalInfo(t *testing.T) {
+	var height int64 = 10
+	val := types.NewMockPV()
+	evidenceDB := dbm.NewMemDB()
+	now := defaultEvidenceTime
+	pool := newTestPool(t, height, val, evidenceDB,
+		evidence.WithClock(func() time.Time { return now }),
+		evidence.WithTombstoneRetention(2))
+
+	committed := newTestDuplicateVoteEvidence(height-1, val)
+	expired := newTestDuplicateVoteEvidence(1, val)
+	require.NoError(t, pool.AddEvidence(committed))
+	require.NoError(t, pool.AddEvidence(expired))
+	_, ok := pool.RemovalInfo(committed.Hash())
+	require.False(t, ok)
+
+	// commit one and expire the other evidence
+	state := pool.State()
+	state.LastBlockHeight++
+	state.LastBlockTime = defaultEvidenceTime.Add(time.Hour)
+	state.ConsensusParams.Evidence.MaxAgeNumBlocks = 2
+	state.ConsensusParams.Evidence.MaxAgeDuration = time.Minute
+	pool.Update(state, types.EvidenceList{committed})
+
+	// remove a corrupt entry by hand
+	corruptHash := bytes.Repeat([]byte{1}, 32)
+	corruptKey, err := orderedcode.Append(nil, int64(9), height, string(corruptHash))
+	require.NoError(t, err)
+	require.NoError(t, evidenceDB.Set(corruptKey, []byte("garbage")))
+	require.NoError(t, pool.RemoveCorruptEvidence([][]byte{corruptKey}))
+
+	testCases := []struct {
+		hash     []byte
+		expected evidence.RemovalRecord
+	}{
+		{committed.Hash(), evidence.RemovalRecord{
+			Reason: evidence.RemovalCommitted, EvidenceHeight: height - 1, Height: height + 1, Time: now}},
+		{expired.Hash(), evidence.RemovalRecord{
+			Reason: evidence.RemovalExpired, EvidenceHeight: 1, Height: height + 1, Time: now}},
+		{corruptHash, evidence.RemovalRecord{
+			Reason: evidence.RemovalManual, EvidenceHeight: height, Height: height + 1, Time: now}},
+	}
+	for _, tc := range testCases {
+		record, ok := pool.RemovalInfo(tc.hash)
+		require.True(t, ok)
+		assert.Equal(t, tc.expected, record)
+	}
+
+	// records are kept for the retention period and then pruned
+	for i := 0; i < 2; i++ {
+		state.LastBlockHeight++
+		pool.Update(state, types.EvidenceList{})
+	}
+	_, ok = pool.RemovalInfo(committed.Hash())
+	require.True(t, ok)
+
+	state.LastBlockHeight++
+	pool.Update(state, types.EvidenceList{})
+	for _, tc := range testCases {
+		_, ok := pool.RemovalInfo(tc.hash)
+		assert.False(t, ok)
+	}
+}
+
+func TestGetEvidenceByHash(t *testing.T) {
+	var height int64 = 10
+	val := types.NewMockPV()
+	evidenceDB := dbm.NewMemDB()
+	pool := newTestPool(t, height, val, evidenceDB, evidence.WithCommittedEvidenceCopies(true))
+
+	pending := newTestDuplicateVoteEvidence(height-1, val)
+	committed := newTestDuplicateVoteEvidence(height-2, val)
+	require.NoError(t, pool.AddEvidence(pending))
+	require.NoError(t, pool.AddEvidence(committed))
+	state := pool.State()
+	state.LastBlockHeight++
+	pool.Update(state, types.EvidenceList{committed})
+
+	ev, status, err := pool.GetEvidenceByHash(pending.Hash())
+	require.NoError(t, err)
+	assert.Equal(t, evidence.EvidencePending, status)
+	assert.Equal(t, pending, ev)
+
+	ev, status, err = pool.GetEvidenceByHash(committed.Hash())
+	require.NoError(t, err)
+	assert.Equal(t, evidence.EvidenceCommitted, status)
+	assert.Equal(t, committed, ev)
+
+	// evidence committed without keeping a copy is only reported as committed
+	key, err := orderedcode.Append(nil, int64(16), committed.Height(), string(committed.Hash()))
+	require.NoError(t, err)
+	require.NoError(t, evidenceDB.Delete(key))
+	ev, status, err = pool.GetEvidenceByHash(committed.Hash())
+	require.NoError(t, err)
+	assert.Equal(t, evidence.EvidenceCommitted, status)
+	assert.Nil(t, ev)
+
+	absent := newTestDuplicateVoteEvidence(height, val)
+	ev, status, err = pool.GetEvidenceByHash(absent.Hash())
+	require.NoError(t, err)
+	assert.Equal(t, evidence.EvidenceNotFound, status)
+	assert.Nil(t, ev)
+}
+
+func TestHashIndex(t *testing.T) {
+	var height int64 = 10
+	val := types.NewMockPV()
+	evidenceDB := dbm.NewMemDB()
+	pool := newTestPool(t, height, val, evidenceDB)
+
+	indexKey := func(ev types.Evidence) []byte {
+		key, err := orderedcode.Append(nil, int64(17), string(ev.Hash()))
+		require.NoError(t, err)
+		return key
+	}
+	pendingKey := func(ev types.Evidence) []byte {
+		key, err := orderedcode.Append(nil, int64(9), ev.Height(), string(ev.Hash()))
+		require.NoError(t, err)
+		return key
+	}
+	requireIndexed := func(ev types.Evidence, indexed bool) {
+		value, err := evidenceDB.Get(indexKey(ev))
+		require.NoError(t, err)
+		if indexed {
+			require.Equal(t, pendingKey(ev), value)
+		} else {
+			require.Nil(t, value)
+		}
+	}
+
+	pending := newTestDuplicateVoteEvidence(height, val)
+	committed := newTestDuplicateVoteEvidence(height-1, val)
+	expired := newTestDuplicateVoteEvidence(1, val)
+	for _, ev := range []types.Evidence{pending, committed, expired} {
+		require.NoError(t, pool.AddEvidence(ev))
+		requireIndexed(ev, true)
+	}
+
+	// commit one and expire another evidence
+	state := pool.State()
+	state.LastBlockHeight++
+	state.LastBlockTime = defaultEvidenceTime.Add(time.Hour)
+	state.ConsensusParams.Evidence.MaxAgeNumBlocks = 5
+	state.ConsensusParams.Evidence.MaxAgeDuration = 30 * time.Minute
+	pool.Update(state, types.EvidenceList{committed})
+	requireIndexed(pending, true)
+	requireIndexed(committed, false)
+	requireIndexed(expired, false)
+
+	ev, status, err := pool.GetEvidenceByHash(pending.Hash())
+	require.NoError(t, err)
+	assert.Equal(t, evidence.EvidencePending, status)
+	assert.Equal(t, pending, ev)
+
+	// pending evidence stored without the index is indexed when the pool starts
+	require.NoError(t, evidenceDB.Delete(indexKey(pending)))
+	_, status, err = pool.GetEvidenceByHash(pending.Hash())
+	require.NoError(t, err)
+	assert.Equal(t, evidence.EvidenceNotFound, status)
+	require.NoError(t, pool.Close())
+	newTestPool(t, height, val, evidenceDB)
+	requireIndexed(pending, true)
+}
+
+func TestCommittedEvidence(t *testing.T) {
+	var height int64 = 10
+	pool, val := defaultTestPool(t, height, evidence.WithCommittedRetention(5),
+		evidence.WithCommittedEvidenceCopies(true))
+
+	evList, size := pool.CommittedEvidence(-1)
+	require.Empty(t, evList)
+	require.Zero(t, size)
+
+	var (
+		committed []types.Evidence
+		sizes     []int64 // size of the first i+1 committed evidence
+		list      tmproto.EvidenceList
+	)
+	for h := height - 3; h <= height; h++ {
+		ev := newTestDuplicateVoteEvidence(h, val)
+		require.NoError(t, pool.AddEvidence(ev))
+		committed = append(committed, ev)
+		evpb, err := types.EvidenceToProto(ev)
+		require.NoError(t, err)
+		list.Evidence = append(list.Evidence, *evpb)
+		sizes = append(sizes, int64(list.Size()))
+	}
+	pending := newTestDuplicateVoteEvidence(height-4, val)
+	require.NoError(t, pool.AddEvidence(pending))
+
+	// commit the evidence over two blocks, newest first
+	state := pool.State()
+	state.LastBlockHeight++
+	pool.Update(state, types.EvidenceList{committed[3], committed[2]})
+	state.LastBlockHeight++
+	pool.Update(state, types.EvidenceList{committed[1], committed[0]})
+
+	evList, size = pool.CommittedEvidence(-1)
+	require.Equal(t, committed, evList)
+	require.Equal(t, sizes[3], size)
+
+	evList, size = pool.CommittedEvidence(sizes[1])
+	require.Equal(t, committed[:2], evList)
+	require.Equal(t, sizes[1], size)
+
+	// pruned committed evidence is no longer listed
+	state.LastBlockHeight++
+	pool.Update(state, types.EvidenceList{})
+	evList, _ = pool.CommittedEvidence(-1)
+	require.Equal(t, committed[1:], evList)
+}
+
+func TestCommittedHeight(t *testing.T) {
+	var height int64 = 10
+	val := types.NewMockPV()
+	evidenceDB := dbm.NewMemDB()
+	pool := newTestPool(t, height, val, evidenceDB)
+
+	ev := newTestDuplicateVoteEvidence(height-2, val)
+	require.NoError(t, pool.AddEvidence(ev))
+	_, ok := pool.CommittedHeight(ev)
+	require.False(t, ok)
+
+	state := pool.State()
+	state.LastBlockHeight++
+	pool.Update(state, types.EvidenceList{ev})
+
+	commitHeight, ok := pool.CommittedHeight(ev)
+	require.True(t, ok)
+	assert.Equal(t, height+1, commitHeight)
+
+	// a corrupt value is reported as not found
+	key, err := orderedcode.Append(nil, int64(8), ev.Height(), string(ev.Hash()))
+	require.NoError(t, err)
+	require.NoError(t, evidenceDB.Set(key, []byte("garbage")))
+	_, ok = pool.CommittedHeight(ev)
+	assert.False(t, ok)
+}
+
+func TestExpiryWithBackwardsBlockTime(t *testing.T) {
+	var height int64 = 10
+	pool, val := defaultTestPool(t, height)
+
+	ev := newTestDuplicateVoteEvidence(height, val)
+	require.NoError(t, pool.AddEvidence(ev))
+
+	state := pool.State()
+	state.ConsensusParams.Evidence.MaxAgeNumBlocks = 2
+	state.ConsensusParams.Evidence.MaxAgeDuration = time.Minute
+	state.LastBlockHeight++
+	state.LastBlockTime = ev.Time().Add(time.Hour)
+	pool.Update(state, types.EvidenceList{})
+	require.EqualValues(t, 1, pool.Size())
+
+	// the block time goes back to before the evidence, which is kept in the
+	// state but doesn't stop the evidence from expiring by the latest time
+	state.LastBlockTime = ev.Time().Add(-time.Hour)
+	for i := 0; i < 2; i++ {
+		state.LastBlockHeight++
+		pool.Update(state, types.EvidenceList{})
+		require.Equal(t, state.LastBlockTime, pool.State().LastBlockTime)
+	}
+	require.EqualValues(t, 0, pool.Size())
+	record, ok := pool.RemovalInfo(ev.Hash())
+	require.True(t, ok)
+	require.Equal(t, evidence.RemovalExpired, record.Reason)
+}
+
+func TestBlockStoreCommittedLookup(t *testing.T) {
+	var height int64 = 10
+	val := types.NewMockPV()
+	stateStore := initializeValidatorState(t, val, height)
+	state, err := stateStore.Load()
+	require.NoError(t, err)
+
+	// the evidence was committed before the node synced, so the pool never
+	// marked it as committed
+	committed := newTestDuplicateVoteEvidence(3, val)
+	blockStore := &historicalBlockStore{
+		BlockStore: initializeBlockStore(dbm.NewMemDB(), state, val.PrivKey.PubKey().Address()),
+		evidence: map[int64]types.EvidenceList{
+			5: {committed},
+			8: {newTestDuplicateVoteEvidence(7, val)},
+		},
+	}
+
+	pool, err := evidence.NewPool(log.TestingLogger(), dbm.NewMemDB(), stateStore, blockStore)
+	require.NoError(t, err)
+	require.NoError(t, pool.AddEvidence(committed))
+	require.NoError(t, pool.Close())
+
+	pool, err = evidence.NewPool(log.TestingLogger(), dbm.NewMemDB(), stateStore, blockStore,
+		evidence.WithBlockStoreCommittedLookup(true))
+	require.NoError(t, err)
+	err = pool.AddEvidence(committed)
+	require.True(t, errors.Is(err, evidence.ErrAlreadyCommitted), err)
+	require.EqualValues(t, 0, pool.Size())
+	require.Equal(t, 1, blockStore.loaded)
+
+	// the evidence is marked as committed, so the block isn't loaded again
+	committedHeight, ok := pool.CommittedHeight(committed)
+	require.True(t, ok)
+	require.EqualValues(t, 5, committedHeight)
+	require.Error(t, pool.CheckEvidence(types.EvidenceList{committed}))
+	require.Equal(t, 1, blockStore.loaded)
+
+	// evidence that isn't in any block is accepted
+	require.NoError(t, pool.AddEvidence(newTestDuplicateVoteEvidence(4, val)))
+	require.EqualValues(t, 1, pool.Size())
+	require.Equal(t, 3, blockStore.loaded)
+
+	// the blocks evidence has been searched in aren't searched again
+	ev := newTestDuplicateVoteEvidence(6, val)
+	require.NoError(t, pool.CheckEvidence(types.EvidenceList{ev}))
+	require.Equal(t, 4, blockStore.loaded)
+	require.NoError(t, pool.CheckEvidence(types.EvidenceList{ev}))
+	require.Equal(t, 4, blockStore.loaded)
+
+	// the blocks after the evidence expired aren't searched
+	overrides := map[evidence.EvidenceType]evidence.ExpiryParams{
+		evidence.DuplicateVoteEvidenceType: {MaxAgeNumBlocks: 2, MaxAgeDuration: 2 * time.Minute},
+	}
+	pool, err = evidence.NewPool(log.TestingLogger(), dbm.NewMemDB(), stateStore, blockStore,
+		evidence.WithBlockStoreCommittedLookup(true), evidence.WithExpiryOverrides(overrides))
+	require.NoError(t, err)
+	err = pool.AddEvidence(newTestDuplicateVoteEvidence(2, val))
+	require.True(t, errors.Is(err, evidence.ErrStaleEvidence), err)
+	require.Equal(t, 4, blockStore.loaded)
+}
+
+func TestCommittedRetention(t *testing.T) {
+	var height int64 = 10
+	val := types.NewMockPV()
+	evidenceDB := dbm.NewMemDB()
+	pool := newTestPool(t, height, val, evidenceDB, evidence.WithCommittedRetention(3),
+		evidence.WithCommittedEvidenceCopies(true), evidence.WithTombstoneRetention(1))
+
+	old := newTestDuplicateVoteEvidence(height-5, val)
+	recent := newTestDuplicateVoteEvidence(height-2, val)
+	require.NoError(t, pool.AddEvidence(old))
+	require.NoError(t, pool.AddEvidence(recent))
+
+	state := pool.State()
+	state.LastBlockHeight++
+	pool.Update(state, types.EvidenceList{old, recent})
+
+	// old committed evidence is pruned while recent evidence survives
+	_, ok := pool.CommittedHeight(old)
+	assert.False(t, ok)
+	_, ok = pool.CommittedHeight(recent)
+	assert.True(t, ok)
+
+	// until it falls out of the retention period too
+	state.LastBlockHeight++
+	pool.Update(state, types.EvidenceList{})
+	_, ok = pool.CommittedHeight(recent)
+	assert.False(t, ok)
+
+	// nothing is left of the evidence in the store
+	state.LastBlockHeight++
+	pool.Update(state, types.EvidenceList{})
+	for _, prefix := range []int64{8, 9, 12, 13, 15, 16, 17, 18} {
+		key, err := orderedcode.Append(nil, prefix)
+		require.NoError(t, err)
+		iter, err := dbm.IteratePrefix(evidenceDB, key)
+		require.NoError(t, err)
+		assert.False(t, iter.Valid(), "keys left under prefix %d", prefix)
+		require.NoError(t, iter.Close())
+	}
+}
+
+func TestCommittedCount(t *testing.T) {
+	var height int64 = 10
+	val := types.NewMockPV()
+	evidenceDB := dbm.NewMemDB()
+	pool := newTestPool(t, height, val, evidenceDB, evidence.WithCommittedRetention(5))
+	requireCount := func(pool *evidence.Pool, expected uint32) {
+		count, err := pool.CommittedCount()
+		require.NoError(t, err)
+		require.Equal(t, expected, count)
+	}
+	requireCount(pool, 0)
+
+	evA := newTestDuplicateVoteEvidence(height-2, val)
+	evB := newTestDuplicateVoteEvidence(height-1, val)
+	require.NoError(t, pool.AddEvidence(evA))
+	state := pool.State()
+	state.LastBlockHeight++
+	pool.Update(state, types.EvidenceList{evA, evB})
+	requireCount(pool, 2)
+
+	// evidence committed twice is counted once
+	state.LastBlockHeight++
+	pool.Update(state, types.EvidenceList{evB})
+	requireCount(pool, 2)
+
+	// pruned evidence is no longer counted
+	state.LastBlockHeight += 2
+	pool.Update(state, nil)
+	_, ok := pool.CommittedHeight(evA)
+	require.False(t, ok)
+	requireCount(pool, 1)
+
+	// the count matches a fresh count of the store
+	require.NoError(t, pool.Close())
+	pool = newTestPool(t, height, val, evidenceDB)
+	requireCount(pool, 1)
+}
+
+func TestNewPoolReadOnly(t *testing.T) {
+	var height int64 = 10
+	val := types.NewMockPV()
+	evidenceDB := dbm.NewMemDB()
+	pool := newTestPool(t, height, val, evidenceDB)
+	pending := newTestDuplicateVoteEvidence(height, val)
+	committed := newTestDuplicateVoteEvidence(height-1, val)
+	require.NoError(t, pool.AddEvidence(pending))
+	require.NoError(t, pool.AddEvidence(committed))
+	state := pool.State()
+	state.LastBlockHeight++
+	pool.Update(state, types.EvidenceList{committed})
+	require.NoError(t, pool.Close())
+
+	storeContents := func() map[string]string {
+		contents := make(map[string]string)
+		iter, err := evidenceDB.Iterator(nil, nil)
+		require.NoError(t, err)
+		defer iter.Close()
+		for ; iter.Valid(); iter.Next() {
+			contents[string(iter.Key())] = string(iter.Value())
+		}
+		return contents
+	}
+	before := storeContents()
+
+	pool, err := evidence.NewPoolReadOnly(log.TestingLogger(), evidenceDB)
+	require.NoError(t, err)
+
+	// the evidence can be inspected
+	require.EqualValues(t, 1, pool.Size())
+	evList, _ := pool.PendingEvidence(-1)
+	require.Equal(t, []types.Evidence{pending}, evList)
+	_, status, err := pool.GetEvidenceByHash(committed.Hash())
+	require.NoError(t, err)
+	require.Equal(t, evidence.EvidenceCommitted, status)
+	exported, err := pool.ExportPending()
+	require.NoError(t, err)
+
+	// but not changed
+	other := newTestDuplicateVoteEvidence(height, types.NewMockPV())
+	require.True(t, errors.Is(pool.AddEvidence(other), evidence.ErrReadOnly))
+	_, err = pool.AddEvidenceBatch([]types.Evidence{other})
+	require.True(t, errors.Is(err, evidence.ErrReadOnly), err)
+	require.True(t, errors.Is(pool.CheckEvidence(types.EvidenceList{pending}), evidence.ErrReadOnly))
+	require.True(t, errors.Is(pool.ImportPending(exported), evidence.ErrReadOnly))
+	require.True(t, errors.Is(pool.RemovePending(pending), evidence.ErrReadOnly))
+	require.True(t, errors.Is(pool.Reset(), evidence.ErrReadOnly))
+	pool.ReportConflictingVotes(other.VoteA, other.VoteB)
+	pool.ReportConflictingVotes(nil, nil)
+	pool.Update(state, types.EvidenceList{pending})
+	require.EqualValues(t, 1, pool.Size())
+	require.Zero(t, pool.State().LastBlockHeight)
+	require.NoError(t, pool.Close())
+	require.Equal(t, before, storeContents())
+
+	// a read-only pool holds the store like any other pool
+	pool, err = evidence.NewPoolReadOnly(log.TestingLogger(), evidenceDB)
+	require.NoError(t, err)
+	_, err = evidence.NewPoolReadOnly(log.TestingLogger(), evidenceDB)
+	require.Equal(t, evidence.ErrPoolAlreadyOpen, err)
+	require.NoError(t, pool.Close())
+}
+
+func TestCommittedEvidenceWithoutCopies(t *testing.T) {
+	var height int64 = 10
+	val := types.NewMockPV()
+	evidenceDB := dbm.NewMemDB()
+	pool := newTestPool(t, height, val, evidenceDB)
+
+	ev := newTestDuplicateVoteEvidence(height, val)
+	require.NoError(t, pool.AddEvidence(ev))
+	state := pool.State()
+	state.LastBlockHeight++
+	pool.Update(state, types.EvidenceList{ev})
+
+	// only the height at which the evidence was committed is kept
+	committedHeight, ok := pool.CommittedHeight(ev)
+	require.True(t, ok)
+	require.Equal(t, state.LastBlockHeight, committedHeight)
+	evList, size := pool.CommittedEvidence(-1)
+	require.Empty(t, evList)
+	require.Zero(t, size)
+	_, status, err := pool.GetEvidenceByHash(ev.Hash())
+	require.NoError(t, err)
+	require.Equal(t, evidence.EvidenceCommitted, status)
+
+	copyPrefix, err := orderedcode.Append(nil, int64(16))
+	require.NoError(t, err)
+	iter, err := dbm.IteratePrefix(evidenceDB, copyPrefix)
+	require.NoError(t, err)
+	defer iter.Close()
+	require.False(t, iter.Valid())
+}
+
+func TestCommittedEvidenceIsKeptByDefault(t *testing.T) {
+	var height int64 = 10
+	pool, val := defaultTestPool(t, height)
+
+	ev := newTestDuplicateVoteEvidence(1, val)
+	require.NoError(t, pool.AddEvidence(ev))
+	state := pool.State()
+	for i := 0; i < 5; i++ {
+		state.LastBlockHeight++
+		evList := types.EvidenceList{}
+		if i == 0 {
+			evList = types.EvidenceList{ev}
+		}
+		pool.Update(state, evList)
+	}
+	_, ok := pool.CommittedHeight(ev)
+	assert.True(t, ok)
+}
+
+func TestMaxPoolSize(t *testing.T) {
+	var height int64 = 10
+	pool, val := defaultTestPool(t, height, evidence.WithMaxPendingEvidence(2))
+
+	for h := int64(1); h <= 2; h++ {
+		require.NoError(t, pool.AddEvidence(newTestDuplicateVoteEvidence(h, val)))
+	}
+	require.EqualValues(t, 2, pool.Size())
+
+	// further evidence is rejected, but isn't considered invalid
+	err := pool.AddEvidence(newTestDuplicateVoteEvidence(height, val))
+	require.True(t, errors.Is(err, evidence.ErrEvidencePoolFull))
+	var invalidErr *types.ErrInvalidEvidence
+	require.False(t, errors.As(err, &invalidErr))
+
+	// evidence in blocks is accepted without growing the pool
+	require.NoError(t, pool.CheckEvidence(types.EvidenceList{newTestDuplicateVoteEvidence(height-1, val)}))
+	require.EqualValues(t, 2, pool.Size())
+
+	// expiring evidence makes room again
+	state := pool.State()
+	state.LastBlockHeight++
+	state.LastBlockTime = defaultEvidenceTime.Add(time.Hour)
+	state.ConsensusParams.Evidence.MaxAgeNumBlocks = 2
+	state.ConsensusParams.Evidence.MaxAgeDuration = time.Minute
+	pool.Update(state, types.EvidenceList{})
+	require.EqualValues(t, 0, pool.Size())
+
+	require.NoError(t, pool.AddEvidence(newTestDuplicateVoteEvidence(height, val)))
+	require.EqualValues(t, 1, pool.Size())
+}
+
+func TestPressure(t *testing.T) {
+	var height int64 = 10
+	pool, val := defaultTestPool(t, height, evidence.WithPressureThresholds(evidence.PressureThresholds{
+		HighSize: 3,
+		LowSize:  1,
+	}))
+	requireClosed := func(ch <-chan struct{}, closed bool) {
+		select {
+		case <-ch:
+			require.True(t, closed, "channel is closed")
+		default:
+			require.False(t, closed, "channel is open")
+		}
+	}
+
+	pressureCh := pool.PressureChan()
+	for h := height - 2; h <= height; h++ {
+		require.False(t, pool.UnderPressure())
+		requireClosed(pressureCh, false)
+		require.NoError(t, pool.AddEvidence(newTestDuplicateVoteEvidence(h, val)))
+	}
+	require.True(t, pool.UnderPressure())
+	requireClosed(pressureCh, true)
+	require.Equal(t, pressureCh, pool.PressureChan())
+
+	// the pool stays under pressure until it drains to the low-water mark
+	_, err := pool.RemovePendingAtHeight(height)
+	require.NoError(t, err)
+	require.True(t, pool.UnderPressure())
+	_, err = pool.RemovePendingAtHeight(height - 1)
+	require.NoError(t, err)
+	require.False(t, pool.UnderPressure())
+	requireClosed(pool.PressureChan(), false)
+
+	// the size of the pending evidence counts as well
+	pool, val = defaultTestPool(t, height, evidence.WithPressureThresholds(evidence.PressureThresholds{
+		HighBytes: 1,
+	}))
+	require.False(t, pool.UnderPressure())
+	ev := newTestDuplicateVoteEvidence(height, val)
+	require.NoError(t, pool.AddEvidence(ev))
+	require.True(t, pool.UnderPressure())
+	requireClosed(pool.PressureChan(), true)
+
+	state := pool.State()
+	state.LastBlockHeight++
+	pool.Update(state, types.EvidenceList{ev})
+	require.False(t, pool.UnderPressure())
+}
+
+func TestEvictionPolicy(t *testing.T) {
+	var height int64 = 10
+
+	testCases := []struct {
+		name   string
+		policy evidence.EvictionPolicy
+	}{
+		{"reject new", evidence.RejectNew},
+		{"evict oldest", evidence.EvictOldest},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			pool, val := defaultTestPool(t, height,
+				evidence.WithMaxPendingEvidence(2), evidence.WithEvictionPolicy(tc.policy))
+			listed := func() []types.Evidence {
+				var evList []types.Evidence
+				for e := pool.EvidenceFront(); e != nil; e = e.Next() {
+					evList = append(evList, e.Value.(types.Evidence))
+				}
+				return evList
+			}
+
+			evs := make([]types.Evidence, 0, 5)
+			for h := height - 4; h <= height; h++ {
+				evs = append(evs, newTestDuplicateVoteEvidence(h, val))
+			}
+			require.NoError(t, pool.AddEvidence(evs[0]))
+			require.NoError(t, pool.AddEvidence(evs[1]))
+
+			// invalid evidence never makes room
+			badSignature := newTestDuplicateVoteEvidence(height-5, val)
+			badSignature.VoteB.Signature = []byte("invalid signature")
+			require.Error(t, pool.AddEvidence(badSignature))
+			require.Equal(t, evs[:2], listed())
+
+			err := pool.AddEvidence(evs[2])
+			_, batchErr := pool.AddEvidenceBatch(evs[3:])
+			evList, _ := pool.PendingEvidence(-1)
+
+			switch tc.policy {
+			case evidence.RejectNew:
+				require.Equal(t, evidence.ErrEvidencePoolFull, err)
+				require.Equal(t, evidence.ErrEvidencePoolFull, batchErr)
+				require.Equal(t, evs[:2], evList)
+				_, ok := pool.RemovalInfo(evs[0].Hash())
+				require.False(t, ok)
+
+			case evidence.EvictOldest:
+				require.NoError(t, err)
+				require.NoError(t, batchErr)
+				require.Equal(t, evs[3:], evList)
+				for _, ev := range evs[:3] {
+					record, ok := pool.RemovalInfo(ev.Hash())
+					require.True(t, ok)
+					require.Equal(t, evidence.RemovalEvicted, record.Reason)
+				}
+			}
+			require.Equal(t, evList, listed())
+			require.EqualValues(t, 2, pool.Size())
+		})
+	}
+}
+
+func TestUpdateWithCommittedEvidenceTwice(t *testing.T) {
+	var height int64 = 10
+	pool, val := defaultTestPool(t, height)
+
+	committed := newTestDuplicateVoteEvidence(height-2, val)
+	require.NoError(t, pool.AddEvidence(committed))
+	require.NoError(t, pool.AddEvidence(newTestDuplicateVoteEvidence(height-1, val)))
+
+	state := pool.State()
+	for i := 0; i < 2; i++ {
+		state.LastBlockHeight++
+		pool.Update(state, types.EvidenceList{committed})
+		require.EqualValues(t, 1, pool.Size())
+	}
+
+	// the count never wraps around, even if it has drifted
+	pending, _ := pool.PendingEvidence(-1)
+	pool.SetSize(0)
+	state.LastBlockHeight++
+	pool.Update(state, pending)
+	require.EqualValues(t, 0, pool.Size())
+}
+
+func TestRecalculateSize(t *testing.T) {
+	var height int64 = 10
+	pool, val := defaultTestPool(t, height)
+
+	var evs []types.Evidence
+	for h := height - 2; h <= height; h++ {
+		ev := newTestDuplicateVoteEvidence(h, val)
+		require.NoError(t, pool.AddEvidence(ev))
+		evs = append(evs, ev)
+	}
+
+	pool.SetSize(42)
+	pool.RemoveEvidenceFromList(map[string]struct{}{evidence.EvMapKey(evs[0]): {}})
+	pool.PushEvidenceToList(newTestDuplicateVoteEvidence(height-1, val))
+
+	require.NoError(t, pool.RecalculateSize())
+	require.EqualValues(t, len(evs), pool.Size())
+	var listed []types.Evidence
+	for e := pool.EvidenceFront(); e != nil; e = e.Next() {
+		listed = append(listed, e.Value.(types.Evidence))
+	}
+	require.Equal(t, evs, listed)
+}
+
+func TestPoolMetrics(t *testing.T) {
+	var height int64 = 10
+	metrics := &evidence.Metrics{
+		Size:                        generic.NewGauge("size"),
+		ConsensusBufferSize:         generic.NewGauge("consensus_buffer_size"),
+		AddedEvidence:               generic.NewCounter("added_evidence"),
+		CommittedEvidence:           generic.NewCounter("committed_evidence"),
+		CommittedEvidenceAgeBlocks:  generic.NewHistogram("committed_evidence_age_blocks", 50),
+		CommittedEvidenceAgeSeconds: generic.NewHistogram("committed_evidence_age_seconds", 50),
+		ExpiredEvidence:             generic.NewCounter("expired_evidence"),
+		FailedVerifications:         generic.NewCounter("failed_verifications"),
+	}
+	pool, val := defaultTestPool(t, height, evidence.WithMetrics(metrics))
+
+	committed := newTestDuplicateVoteEvidence(height-1, val)
+	expired := newTestDuplicateVoteEvidence(1, val)
+	require.NoError(t, pool.AddEvidence(committed))
+	require.NoError(t, pool.AddEvidence(expired))
+	// quarantined evidence doesn't count as failing verification
+	require.Error(t, pool.AddEvidence(newTestDuplicateVoteEvidence(height+1, val)))
+	require.Error(t, pool.AddEvidence(newTestDuplicateVoteEvidence(height+5, val)))
+
+	future := newTestDuplicateVoteEvidence(height+5, val)
+	pool.ReportConflictingVotes(future.VoteA, future.VoteB)
+
+	assert.EqualValues(t, 2, metrics.Size.(*generic.Gauge).Value())
+	assert.EqualValues(t, 1, metrics.ConsensusBufferSize.(*generic.Gauge).Value())
+	assert.EqualValues(t, 2, metrics.AddedEvidence.(*generic.Counter).Value())
+	assert.EqualValues(t, 1, metrics.FailedVerifications.(*generic.Counter).Value())
+
+	// commit one and expire the other evidence
+	state := pool.State()
+	state.LastBlockHeight++
+	state.LastBlockTime = defaultEvidenceTime.Add(time.Hour)
+	state.ConsensusParams.Evidence.MaxAgeNumBlocks = 2
+	state.ConsensusParams.Evidence.MaxAgeDuration = time.Minute
+	pool.Update(state, types.EvidenceList{committed})
+
+	assert.EqualValues(t, 0, metrics.Size.(*generic.Gauge).Value())
+	assert.EqualValues(t, 0, metrics.ConsensusBufferSize.(*generic.Gauge).Value())
+	assert.EqualValues(t, 1, metrics.CommittedEvidence.(*generic.Counter).Value())
+	assert.EqualValues(t, 1, metrics.ExpiredEvidence.(*generic.Counter).Value())
+	// the age of the committed evidence is observed by the block it's committed in
+	ageSeconds := state.LastBlockTime.Sub(committed.Time()).Seconds()
+	assert.EqualValues(t, 2, metrics.CommittedEvidenceAgeBlocks.(*generic.Histogram).Quantile(0.5))
+	assert.EqualValues(t, ageSeconds, metrics.CommittedEvidenceAgeSeconds.(*generic.Histogram).Quantile(0.5))
+
+	// evidence that is already committed is neither counted nor published again
+	events, unsubscribe := pool.Subscribe(10)
+	defer unsubscribe()
+	state.LastBlockHeight++
+	pool.Update(state, types.EvidenceList{committed})
+	assert.EqualValues(t, 1, metrics.CommittedEvidence.(*generic.Counter).Value())
+	select {
+	case event := <-events:
+		t.Fatalf("unexpected event %v", event)
+	default:
+	}
+}
+
+func TestPendingEvidenceByHeight(t *testing.T) {
+	var height int64 = 10
+	val := types.NewMockPV()
+	evidenceDB := dbm.NewMemDB()
+	pool := newTestPool(t, height, val, evidenceDB)
+
+	var evs []types.Evidence
+	for h := int64(1); h <= height; h += 2 {
+		ev := newTestDuplicateVoteEvidence(h, val)
+		require.NoError(t, pool.AddEvidence(ev))
+		evs = append(evs, ev)
+	}
+
+	testCases := []struct {
+		minHeight, maxHeight int64
+		expected             []types.Evidence
+	}{
+		{1, height, evs},
+		{3, 7, evs[1:4]},
+		{4, 4, nil},
+		{5, 5, evs[2:3]},
+		{height + 1, height + 5, nil},
+		{5, math.MaxInt64, evs[2:]},
+		{math.MaxInt64, math.MaxInt64, nil},
+	}
+	for _, tc := range testCases {
+		evList, err := pool.PendingEvidenceByHeight(tc.minHeight, tc.maxHeight)
+		require.NoError(t, err)
+		assert.Equal(t, tc.expected, evList, "heights %d-%d", tc.minHeight, tc.maxHeight)
+	}
+
+	_, err := pool.PendingEvidenceByHeight(5, 4)
+	require.Error(t, err)
+
+	// entries that can't be decoded are skipped, or fail with strict decoding
+	garbageKey, err := orderedcode.Append(nil, int64(9), int64(5), string(make([]byte, 32)))
+	require.NoError(t, err)
+	require.NoError(t, evidenceDB.Set(garbageKey, []byte("garbage")))
+	evList, err := pool.PendingEvidenceByHeight(1, height)
+	require.NoError(t, err)
+	require.Equal(t, evs, evList)
+	recent, err := pool.RecentlyAdded(time.Time{})
+	require.NoError(t, err)
+	require.Len(t, recent, len(evs))
+
+	strictDB := dbm.NewMemDB()
+	strictPool := newTestPool(t, height, val, strictDB, evidence.WithStrictDecoding(true))
+	for _, ev := range evs {
+		require.NoError(t, strictPool.AddEvidence(ev))
+	}
+	require.NoError(t, strictDB.Set(garbageKey, []byte("garbage")))
+	_, err = strictPool.PendingEvidenceByHeight(1, height)
+	require.Error(t, err)
+	_, err = strictPool.RecentlyAdded(time.Time{})
+	require.Error(t, err)
+}
+
+func TestIteratePending(t *testing.T) {
+	var height int64 = 10
+	val := types.NewMockPV()
+	evidenceDB := dbm.NewMemDB()
+	pool := newTestPool(t, height, val, evidenceDB)
+	collect := func(p *evidence.Pool, max int) ([]types.Evidence, error) {
+		var evList []types.Evidence
+		err := p.IteratePending(func(ev types.Evidence) bool {
+			evList = append(evList, ev)
+			return len(evList) < max
+		})
+		return evList, err
+	}
+
+	evList, err := collect(pool, 10)
+	require.NoError(t, err)
+	require.Empty(t, evList)
+
+	var evs []types.Evidence
+	for h := height; h > height-4; h-- {
+		ev := newTestDuplicateVoteEvidence(h, val)
+		require.NoError(t, pool.AddEvidence(ev))
+		evs = append([]types.Evidence{ev}, evs...)
+	}
+
+	evList, err = collect(pool, 10)
+	require.NoError(t, err)
+	require.Equal(t, evs, evList)
+
+	evList, err = collect(pool, 2)
+	require.NoError(t, err)
+	require.Equal(t, evs[:2], evList)
+
+	// entries that can't be decoded are skipped, or fail strict iteration. The
+	// empty hash sorts before the evidence at the same height.
+	garbageKey, err := orderedcode.Append(nil, int64(9), height-1, string(make([]byte, 32)))
+	require.NoError(t, err)
+	require.NoError(t, evidenceDB.Set(garbageKey, []byte("garbage")))
+	evList, err = collect(pool, 10)
+	require.NoError(t, err)
+	require.Equal(t, evs, evList)
+
+	strictDB := dbm.NewMemDB()
+	strictPool := newTestPool(t, height, val, strictDB, evidence.WithStrictDecoding(true))
+	for _, ev := range evs {
+		require.NoError(t, strictPool.AddEvidence(ev))
+	}
+	require.NoError(t, strictDB.Set(garbageKey, []byte("garbage")))
+	evList, err = collect(strictPool, 10)
+	require.Error(t, err)
+	require.Equal(t, evs[:2], evList)
+}
+
+func TestListPendingPaged(t *testing.T) {
+	var height int64 = 10
+	pool, val := defaultTestPool(t, height)
+
+	evList, total, err := pool.ListPendingPaged(0, 10)
+	require.NoError(t, err)
+	require.Empty(t, evList)
+	require.Zero(t, total)
+
+	for h := height - 4; h <= height; h++ {
+		require.NoError(t, pool.AddEvidence(newTestDuplicateVoteEvidence(h, val)))
+	}
+	all, _ := pool.PendingEvidence(-1)
+	require.Len(t, all, 5)
+
+	testCases := []struct {
+		name          string
+		offset, limit int
+		expected      []types.Evidence
+	}{
+		{"first page", 0, 2, all[:2]},
+		{"middle page", 2, 2, all[2:4]},
+		{"last page", 4, 2, all[4:]},
+		{"everything", 0, 10, all},
+		{"out of range", 5, 2, []types.Evidence{}},
+		{"empty page", 1, 0, []types.Evidence{}},
+	}
+	for _, tc := range testCases {
+		evList, total, err := pool.ListPendingPaged(tc.offset, tc.limit)
+		require.NoError(t, err, tc.name)
+		require.Equal(t, tc.expected, evList, tc.name)
+		require.Equal(t, 5, total, tc.name)
+	}
+
+	// the total follows the pending evidence
+	require.NoError(t, pool.RemovePending(all[0]))
+	evList, total, err = pool.ListPendingPaged(0, 2)
+	require.NoError(t, err)
+	require.Equal(t, all[1:3], evList)
+	require.Equal(t, 4, total)
+
+	_, _, err = pool.ListPendingPaged(-1, 2)
+	require.Error(t, err)
+	_, _, err = pool.ListPendingPaged(0, -1)
+	require.Error(t, err)
+}
+
+func TestEvLogFields(t *testing.T) {
+	dve := newTestDuplicateVoteEvidence(3, types.NewMockPV())
+	lcae := &types.LightClientAttackEvidence{
+		ConflictingBlock: &types.LightBlock{
+			SignedHeader: &types.SignedHeader{Header: makeHeaderRandom(5)},
+		},
+		CommonHeight: 4,
+	}
+
+	testCases := []struct {
+		ev       types.Evidence
+		height   int64
+		expected string
+	}{
+		{dve, 3, "duplicate_vote"},
+		{lcae, 4, "light_client_attack"},
+	}
+	for _, tc := range testCases {
+		require.Equal(t, []interface{}{
+			"evidence_hash", fmt.Sprintf("%X", tc.ev.Hash()[:6]),
+			"height", tc.height,
+			"type", tc.expected,
+		}, evidence.EvLogFields(tc.ev))
+	}
+}
+
+func TestBytesToEvWithMalformedBytes(t *testing.T) {
+	ev := newTestDuplicateVoteEvidence(1, types.NewMockPV())
+	evpb, err := types.EvidenceToProto(ev)
+	require.NoError(t, err)
+	bz, err := evpb.Marshal()
+	require.NoError(t, err)
+
+	decoded, err := evidence.BytesToEv(bz)
+	require.NoError(t, err)
+	require.Equal(t, ev, decoded)
+
+	for _, malformed := range [][]byte{[]byte("garbage"), bz[:len(bz)-1], {}} {
+		decoded, err := evidence.BytesToEv(malformed)
+		require.Error(t, err)
+		require.Nil(t, decoded)
+	}
+}
+
+func TestListEvidenceWithCorruptEntries(t *testing.T) {
+	var height int64 = 10
+	val := types.NewMockPV()
+
+	testCases := []struct {
+		name     string
+		strict   bool
+		expected func(evs []types.Evidence) []types.Evidence
+	}{
+		{"lenient", false, func(evs []types.Evidence) []types.Evidence { return evs }},
+		{"strict", true, func([]types.Evidence) []types.Evidence { return nil }},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			evidenceDB := dbm.NewMemDB()
+			pool := newTestPool(t, height, val, evidenceDB, evidence.WithStrictDecoding(tc.strict))
+
+			var evs []types.Evidence
+			for _, h := range []int64{height - 3, height - 1} {
+				ev := newTestDuplicateVoteEvidence(h, val)
+				require.NoError(t, pool.AddEvidence(ev))
+				evs = append(evs, ev)
+			}
+			// corrupt entries in between the valid ones, one that isn't protobuf
+			// and one that isn't evidence
+			for i, value := range [][]byte{[]byte("garbage"), {}} {
+				key, err := orderedcode.Append(nil, int64(9), height-2, string(rune('a'+i)))
+				require.NoError(t, err)
+				require.NoError(t, evidenceDB.Set(key, value))
+			}
+
+			evList, _ := pool.PendingEvidence(-1)
+			require.Equal(t, tc.expected(evs), evList)
+		})
+	}
+}
+
+func TestCommittedEvidenceChan(t *testing.T) {
+	var height int64 = 10
+	pool, val := defaultTestPool(t, height)
+
+	pending := newTestDuplicateVoteEvidence(height-2, val)
+	require.NoError(t, pool.AddEvidence(pending))
+	// evidence that was never pending is delivered as well
+	unseen := newTestDuplicateVoteEvidence(height-1, val)
+
+	state := pool.State()
+	state.LastBlockHeight++
+	pool.Update(state, types.EvidenceList{pending, unseen})
+
+	committed := pool.CommittedEvidenceChan()
+	require.Equal(t, pending, <-committed)
+	require.Equal(t, unseen, <-committed)
+	select {
+	case ev := <-committed:
+		t.Fatalf("unexpected committed evidence %v", ev)
+	default:
+	}
+
+	// Update doesn't block if nobody receives
+	var evList types.EvidenceList
+	for i := 0; i < 101; i++ {
+		evList = append(evList, types.NewMockDuplicateVoteEvidenceWithValidator(
+			height, defaultEvidenceTime, val, evidenceChainID))
+	}
+	state.LastBlockHeight++
+	pool.Update(state, evList)
+	require.Len(t, committed, cap(committed))
+	require.Equal(t, evList[0], <-committed)
+}
+
+func TestRecentlyAdded(t *testing.T) {
+	var height int64 = 10
+
+	now := defaultEvidenceTime
+	pool, val := defaultTestPool(t, height, evidence.WithClock(func() time.Time { return now }))
+
+	// evidence is added in a different order to its offense height
+	var evs []types.Evidence
+	for i, h := range []int64{10, 5, 8} {
+		now = defaultEvidenceTime.Add(time.Duration(i+1) * time.Hour)
+		ev := newTestDuplicateVoteEvidence(h, val)
+		require.NoError(t, pool.AddEvidence(ev))
+		evs = append(evs, ev)
+	}
+
+	recent, err := pool.RecentlyAdded(time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, evs, recent)
+
+	recent, err = pool.RecentlyAdded(defaultEvidenceTime.Add(1 * time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, evs[1:], recent)
+
+	recent, err = pool.RecentlyAdded(defaultEvidenceTime.Add(3 * time.Hour))
+	require.NoError(t, err)
+	require.Empty(t, recent)
+}
+
+func TestPendingEvidenceMaxNum(t *testing.T) {
+	var height int64 = 10
+	pool, val := defaultTestPool(t, height, evidence.WithMaxListedEvidence(3))
+
+	// evidence is added newest first but returned oldest first
+	added := make(map[int64]types.Evidence)
+	for h := height; h > 0; h-- {
+		added[h] = newTestDuplicateVoteEvidence(h, val)
+		require.NoError(t, pool.AddEvidence(added[h]))
+	}
+	require.EqualValues(t, height, pool.Size())
+
+	var (
+		expected []types.Evidence
+		evList   tmproto.EvidenceList
+	)
+	for h := int64(1); h <= 3; h++ {
+		evpb, err := types.EvidenceToProto(added[h])
+		require.NoError(t, err)
+		expected = append(expected, added[h])
+		evList.Evidence = append(evList.Evidence, *evpb)
+	}
+
+	evs, size := pool.PendingEvidence(-1)
+	require.Equal(t, expected, evs)
+	require.EqualValues(t, evList.Size(), size)
+
+	// the byte limit still applies below the count cap
+	evs, _ = pool.PendingEvidence(size - 1)
+	require.Len(t, evs, 2)
+
+	// as does the count cap when excluding evidence
+	evs, _ = pool.PendingEvidenceExcluding(map[string]struct{}{string(expected[0].Hash()): {}}, -1)
+	require.Len(t, evs, 3)
+	require.Equal(t, expected[1:], evs[:2])
+}
+
+func TestPendingEvidenceOrder(t *testing.T) {
+	var height int64 = 10
+	val := types.NewMockPV()
+	acceptAll := evidence.WithVerifier(verifierFunc(func(types.Evidence, sm.State) error { return nil }))
+
+	// duplicate vote evidence implicating the given voting power
+	dve := func(h, power int64) types.Evidence {
+		ev := newTestDuplicateVoteEvidence(h, val)
+		ev.ValidatorPower = power
+		return ev
+	}
+	// light client attack evidence implicating 3 validators with a total
+	// voting power of 30
+	byzVals, byzPrivVals := types.RandValidatorSet(3, 10)
+	header := makeHeaderRandom(height - 2)
+	header.ValidatorsHash = byzVals.Hash()
+	blockID := makeBlockID(header.Hash(), 1000, []byte("partshash"))
+	voteSet := types.NewVoteSet(evidenceChainID, header.Height, 1, tmproto.SignedMsgType(2), byzVals)
+	commit, err := types.MakeCommit(blockID, header.Height, 1, voteSet, byzPrivVals, defaultEvidenceTime)
+	require.NoError(t, err)
+	lcae := &types.LightClientAttackEvidence{
+		ConflictingBlock: &types.LightBlock{
+			SignedHeader: &types.SignedHeader{Header: header, Commit: commit},
+			ValidatorSet: byzVals,
+		},
+		CommonHeight:        header.Height,
+		TotalVotingPower:    byzVals.TotalVotingPower(),
+		ByzantineValidators: byzVals.Validators,
+		Timestamp:           defaultEvidenceTime,
+	}
+
+	evs := []types.Evidence{dve(height-5, 5), dve(height-4, 20), dve(height-3, 10), lcae, dve(height-1, 20)}
+	byImpact := []types.Evidence{evs[3], evs[1], evs[4], evs[2], evs[0]}
+
+	testCases := []struct {
+		name     string
+		order    evidence.PendingEvidenceOrder
+		expected []types.Evidence
+	}{
+		{"by age", evidence.OrderByAge, evs},
+		{"by impact", evidence.OrderByImpact, byImpact},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			pool, _ := defaultTestPool(t, height, acceptAll, evidence.WithPendingEvidenceOrder(tc.order))
+			for _, ev := range evs {
+				require.NoError(t, pool.AddEvidence(ev))
+			}
+
+			evList, _ := pool.PendingEvidence(-1)
+			require.Equal(t, tc.expected, evList)
+
+			// the limits apply after ordering
+			evList, size := pool.PendingEvidenceWithLimit(-1, 2)
+			require.Equal(t, tc.expected[:2], evList)
+			evList, _ = pool.PendingEvidence(size)
+			require.Equal(t, tc.expected[:2], evList)
+			evList, _ = pool.PendingEvidence(size - 1)
+			require.Equal(t, tc.expected[:1], evList)
+		})
+	}
+}
+
+func TestSetPriorityValidators(t *testing.T) {
+	var height int64 = 10
+	acceptAll := evidence.WithVerifier(verifierFunc(func(types.Evidence, sm.State) error { return nil }))
+	pool, val := defaultTestPool(t, height, acceptAll)
+	prioritized := types.NewMockPV()
+
+	evs := []types.Evidence{
+		newTestDuplicateVoteEvidence(height-3, val),
+		newTestDuplicateVoteEvidence(height-2, val),
+		newTestDuplicateVoteEvidence(height-1, prioritized),
+		newTestDuplicateVoteEvidence(height, prioritized),
+	}
+	for _, ev := range evs {
+		require.NoError(t, pool.AddEvidence(ev))
+	}
+	_, size := pool.PendingEvidenceWithLimit(-1, 2)
+
+	// without a hint the oldest evidence is selected
+	evList, _ := pool.PendingEvidence(size)
+	require.Equal(t, evs[:2], evList)
+
+	// with a hint the evidence of the prioritized validator is selected first,
+	// ordered by age
+	pool.SetPriorityValidators([][]byte{prioritized.PrivKey.PubKey().Address()})
+	evList, _ = pool.PendingEvidence(size)
+	require.Equal(t, evs[2:], evList)
+	evList, _ = pool.PendingEvidence(-1)
+	require.Equal(t, []types.Evidence{evs[2], evs[3], evs[0], evs[1]}, evList)
+
+	// an empty hint restores the default order
+	pool.SetPriorityValidators(nil)
+	evList, _ = pool.PendingEvidence(size)
+	require.Equal(t, evs[:2], evList)
+}
+
+func TestPendingEvidenceIsDeterministic(t *testing.T) {
+	var height int64 = 10
+	val := types.NewMockPV()
+
+	// several evidence per height, so that the order within a height depends
+	// on the hash
+	var evs []types.Evidence
+	for h := height - 3; h <= height; h++ {
+		for i := 0; i < 4; i++ {
+			evs = append(evs, newTestDuplicateVoteEvidence(h, val))
+		}
+	}
+	expected := make([]types.Evidence, len(evs))
+	copy(expected, evs)
+	sort.Slice(expected, func(i, j int) bool {
+		if expected[i].Height() != expected[j].Height() {
+			return expected[i].Height() < expected[j].Height()
+		}
+		return bytes.Compare(expected[i].Hash(), expected[j].Hash()) < 0
+	})
+
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for i := 0; i < 5; i++ {
+		shuffled := make([]types.Evidence, len(evs))
+		copy(shuffled, evs)
+		rng.Shuffle(len(shuffled), func(a, b int) { shuffled[a], shuffled[b] = shuffled[b], shuffled[a] })
+
+		pool := newTestPool(t, height, val, dbm.NewMemDB())
+		for _, ev := range shuffled {
+			require.NoError(t, pool.AddEvidence(ev))
+		}
+
+		evList, _ := pool.PendingEvidence(-1)
+		require.Equal(t, expected, evList, "added in order %v", shuffled)
+		evList, _ = pool.PendingEvidenceWithLimit(-1, 5)
+		require.Equal(t, expected[:5], evList)
+	}
+}
+
+func TestEligibilityDelay(t *testing.T) {
+	var height int64 = 10
+	val := types.NewMockPV()
+	evidenceDB := dbm.NewMemDB()
+	pool := newTestPool(t, height, val, evidenceDB, evidence.WithEligibilityDelay(2))
+
+	// evidence received from a peer
+	peerEv := newTestDuplicateVoteEvidence(height-1, val)
+	require.NoError(t, pool.AddEvidence(peerEv))
+	// evidence stored by an older version without the height it was added at
+	legacyEv := newTestDuplicateVoteEvidence(height-2, val)
+	require.NoError(t, pool.AddEvidence(legacyEv))
+	infoKey, err := orderedcode.Append(nil, int64(12), legacyEv.Height(), string(legacyEv.Hash()))
+	require.NoError(t, err)
+	legacyInfo, err := orderedcode.Append(nil, defaultEvidenceTime.UnixNano(), int64(0))
+	require.NoError(t, err)
+	require.NoError(t, evidenceDB.Set(infoKey, legacyInfo))
+	// evidence detected in consensus, which is added at the next height
+	selfEv := types.NewMockDuplicateVoteEvidenceWithValidator(height+1, defaultEvidenceTime, val, evidenceChainID)
+	pool.ReportConflictingVotes(selfEv.VoteA, selfEv.VoteB)
+
+	// the evidence is pending but not proposed until two heights after it was
+	// added
+	evList, _ := pool.PendingEvidence(-1)
+	require.Equal(t, []types.Evidence{legacyEv}, evList)
+	require.EqualValues(t, 2, pool.Size())
+
+	state := pool.State()
+	state.LastBlockHeight++
+	state.LastBlockTime = selfEv.Time()
+	state.LastValidators = types.NewValidatorSet([]*types.Validator{types.NewValidator(val.PrivKey.PubKey(), 10)})
+	pool.Update(state, nil)
+	require.EqualValues(t, 3, pool.Size())
+	evList, _ = pool.PendingEvidence(-1)
+	require.Equal(t, []types.Evidence{legacyEv}, evList)
+
+	state.LastBlockHeight++
+	pool.Update(state, nil)
+	evList, _ = pool.PendingEvidence(-1)
+	require.Equal(t, []types.Evidence{legacyEv, peerEv}, evList)
+	evpbs, _, err := pool.PendingEvidenceProto(-1)
+	require.NoError(t, err)
+	require.Len(t, evpbs, 2)
+
+	state.LastBlockHeight++
+	pool.Update(state, nil)
+	evList, _ = pool.PendingEvidence(-1)
+	require.Equal(t, []types.Evidence{legacyEv, peerEv, selfEv}, evList)
+}
+
+func TestEvidenceOverhead(t *testing.T) {
+	const overhead = 100
+	var height int64 = 10
+	pool, val := defaultTestPool(t, height, evidence.WithEvidenceOverhead(overhead))
+
+	var (
+		evs   []types.Evidence
+		sizes []int64 // protobuf size of the first i+1 evidence
+		list  tmproto.EvidenceList
+	)
+	for h := int64(1); h <= 3; h++ {
+		ev := newTestDuplicateVoteEvidence(h, val)
+		require.NoError(t, pool.AddEvidence(ev))
+		evpb, err := types.EvidenceToProto(ev)
+		require.NoError(t, err)
+		list.Evidence = append(list.Evidence, *evpb)
+		evs = append(evs, ev)
+		sizes = append(sizes, int64(list.Size()))
+	}
+
+	// the overhead counts towards the budget and the returned size
+	evList, size := pool.PendingEvidence(-1)
+	require.Equal(t, evs, evList)
+	require.Equal(t, sizes[2]+3*overhead, size)
+
+	evList, size = pool.PendingEvidence(sizes[1] + 2*overhead)
+	require.Equal(t, evs[:2], evList)
+	require.Equal(t, sizes[1]+2*overhead, size)
+
+	// a budget that fits the evidence alone no longer does with the overhead
+	evList, size = pool.PendingEvidence(sizes[1] + 2*overhead - 1)
+	require.Equal(t, evs[:1], evList)
+	require.Equal(t, sizes[0]+overhead, size)
+
+	evList, _ = pool.PendingEvidence(sizes[0])
+	require.Empty(t, evList)
+}
+
+func TestPendingEvidenceWithLimit(t *testing.T) {
+	var height int64 = 10
+	pool, val := defaultTestPool(t, height)
+
+	var (
+		evs   []types.Evidence
+		sizes []int64 // size of the first i+1 evidence
+		list  tmproto.EvidenceList
+	)
+	for h := int64(1); h <= 5; h++ {
+		ev := newTestDuplicateVoteEvidence(h, val)
+		require.NoError(t, pool.AddEvidence(ev))
+		evpb, err := types.EvidenceToProto(ev)
+		require.NoError(t, err)
+		list.Evidence = append(list.Evidence, *evpb)
+		evs = append(evs, ev)
+		sizes = append(sizes, int64(list.Size()))
+	}
+
+	testCases := []struct {
+		name     string
+		maxBytes int64
+		maxNum   int
+		expected int
+	}{
+		{"no limit", -1, 0, 5},
+		{"byte limited", sizes[2], 0, 3},
+		{"count limited", -1, 2, 2},
+		{"count limit reached first", sizes[3], 2, 2},
+		{"byte limit reached first", sizes[1], 4, 2},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			evList, size := pool.PendingEvidenceWithLimit(tc.maxBytes, tc.maxNum)
+			require.Equal(t, evs[:tc.expected], evList)
+			require.Equal(t, sizes[tc.expected-1], size)
+		})
+	}
+
+	// the pool's cap applies as well
+	pool, val = defaultTestPool(t, height, evidence.WithMaxListedEvidence(2))
+	for h := int64(1); h <= 5; h++ {
+		require.NoError(t, pool.AddEvidence(newTestDuplicateVoteEvidence(h, val)))
+	}
+	evList, _ := pool.PendingEvidenceWithLimit(-1, 3)
+	require.Len(t, evList, 2)
+	evList, _ = pool.PendingEvidenceWithLimit(-1, 1)
+	require.Len(t, evList, 1)
+}
+
+func TestPendingEvidenceDefault(t *testing.T) {
+	var height int64 = 10
+	pool, val := defaultTestPool(t, height)
+
+	var evs []types.Evidence
+	for h := height - 2; h <= height; h++ {
+		ev := newTestDuplicateVoteEvidence(h, val)
+		require.NoError(t, pool.AddEvidence(ev))
+		evs = append(evs, ev)
+	}
+	_, twoEvSize := pool.PendingEvidence(-1)
+	_, twoEvSize = pool.PendingEvidenceWithLimit(twoEvSize, 2)
+
+	state := pool.State()
+	testCases := []struct {
+		name                    string
+		maxBytes, maxBlockBytes int64
+		expected                []types.Evidence
+	}{
+		{"whole pool", 1 << 20, 22020096, evs},
+		{"evidence budget", twoEvSize, 22020096, evs[:2]},
+		{"block size", 1 << 20, twoEvSize, evs[:2]},
+		{"no evidence", 0, 22020096, []types.Evidence{}},
+	}
+	for _, tc := range testCases {
+		state.LastBlockHeight++
+		state.ConsensusParams.Evidence.MaxBytes = tc.maxBytes
+		state.ConsensusParams.Block.MaxBytes = tc.maxBlockBytes
+		pool.Update(state, nil)
+
+		evList, size := pool.PendingEvidenceDefault()
+		assert.Equal(t, tc.expected, evList, tc.name)
+		if len(tc.expected) == 2 {
+			assert.Equal(t, twoEvSize, size, tc.name)
+		}
+	}
+}
+
+func TestPendingEvidenceExcluding(t *testing.T) {
+	var height int64 = 10
+	pool, val := defaultTestPool(t, height)
+
+	var evs []types.Evidence
+	for h := int64(1); h <= 4; h++ {
+		ev := newTestDuplicateVoteEvidence(h, val)
+		require.NoError(t, pool.AddEvidence(ev))
+		evs = append(evs, ev)
+	}
+
+	known := map[string]struct{}{
+		string(evs[0].Hash()): {},
+		string(evs[2].Hash()): {},
+	}
+
+	evList, size := pool.PendingEvidenceExcluding(known, -1)
+	require.Equal(t, []types.Evidence{evs[1], evs[3]}, evList)
+
+	// only the first unknown evidence fits within a tighter budget
+	evList, _ = pool.PendingEvidenceExcluding(known, size-1)
+	require.Equal(t, []types.Evidence{evs[1]}, evList)
+
+	// everything is known
+	for _, ev := range evs {
+		known[string(ev.Hash())] = struct{}{}
+	}
+	evList, size = pool.PendingEvidenceExcluding(known, -1)
+	require.Empty(t, evList)
+	require.Zero(t, size)
+}
+
+func TestPendingEvidenceProto(t *testing.T) {
+	var height int64 = 10
+	for _, order := range []evidence.PendingEvidenceOrder{evidence.OrderByAge, evidence.OrderByImpact} {
+		pool, val := defaultTestPool(t, height, evidence.WithPendingEvidenceOrder(order))
+
+		evpbs, size, err := pool.PendingEvidenceProto(-1)
+		require.NoError(t, err)
+		require.Empty(t, evpbs)
+		require.Zero(t, size)
+
+		for h := int64(1); h <= 4; h++ {
+			require.NoError(t, pool.AddEvidence(newTestDuplicateVoteEvidence(h, val)))
+		}
+
+		_, total := pool.PendingEvidence(-1)
+		for _, maxBytes := range []int64{-1, total, total - 1, 1} {
+			expected, expectedSize := pool.PendingEvidence(maxBytes)
+			evpbs, size, err := pool.PendingEvidenceProto(maxBytes)
+			require.NoError(t, err)
+			require.Equal(t, expectedSize, size)
+			require.Len(t, evpbs, len(expected))
+			for i, ev := range expected {
+				evpb, err := types.EvidenceToProto(ev)
+				require.NoError(t, err)
+				require.Equal(t, *evpb, evpbs[i])
+			}
+		}
+	}
+}
+
+func TestPendingEvidenceJSON(t *testing.T) {
+	var height int64 = 10
+	pool, val := defaultTestPool(t, height)
+
+	bz, err := pool.PendingEvidenceJSON(-1)
+	require.NoError(t, err)
+	require.Equal(t, "[]", string(bz))
+
+	for h := height - 3; h <= height; h++ {
+		require.NoError(t, pool.AddEvidence(newTestDuplicateVoteEvidence(h, val)))
+	}
+
+	_, total := pool.PendingEvidence(-1)
+	for _, maxBytes := range []int64{-1, total - 1} {
+		expected, _ := pool.PendingEvidence(maxBytes)
+		bz, err := pool.PendingEvidenceJSON(maxBytes)
+		require.NoError(t, err)
+		require.True(t, json.Valid(bz))
+
+		var evList []types.Evidence
+		require.NoError(t, tmjson.Unmarshal(bz, &evList))
+		require.Len(t, evList, len(expected))
+		for i, ev := range expected {
+			require.Equal(t, ev.Hash(), evList[i].Hash())
+		}
+	}
+}
+
+func TestPoolSnapshotRestore(t *testing.T) {
+	var height int64 = 10
+	pool, val := defaultTestPool(t, height)
+
+	ev1 := newTestDuplicateVoteEvidence(height, val)
+	ev2 := newTestDuplicateVoteEvidence(height-1, val)
+	require.NoError(t, pool.AddEvidence(ev1))
+	require.NoError(t, pool.AddEvidence(ev2))
+
+	snapshot, err := pool.Snapshot()
+	require.NoError(t, err)
+
+	expectedState := pool.State()
+	expectedEvidence, expectedSize := pool.PendingEvidence(-1)
+
+	// mutate the pool: add new evidence, commit existing evidence and buffer
+	// conflicting votes from consensus
+	ev3 := newTestDuplicateVoteEvidence(height-2, val)
+	require.NoError(t, pool.AddEvidence(ev3))
+	pool.ReportConflictingVotes(ev3.VoteA, ev3.VoteB)
+
+	state := pool.State()
+	state.LastBlockHeight++
+	state.LastBlockTime = state.LastBlockTime.Add(time.Minute)
+	pool.Update(state, types.EvidenceList{ev1})
+	require.Error(t, pool.CheckEvidence(types.EvidenceList{ev1}))
+
+	require.NoError(t, pool.Restore(snapshot))
+
+	require.Equal(t, expectedState, pool.State())
+	require.EqualValues(t, 2, pool.Size())
+	evList, size := pool.PendingEvidence(-1)
+	require.Equal(t, expectedEvidence, evList)
+	require.Equal(t, expectedSize, size)
+	require.Equal(t, ev1, pool.EvidenceFront().Value.(types.Evidence))
+	require.Equal(t, ev2, pool.EvidenceFront().Next().Value.(types.Evidence))
+	require.Nil(t, pool.EvidenceFront().Next().Next())
+
+	// ev1 is no longer committed
+	require.NoError(t, pool.CheckEvidence(types.EvidenceList{ev1}))
+}
+
+func TestPoolReset(t *testing.T) {
+	var height int64 = 10
+	pool, val := defaultTestPool(t, height, evidence.WithCommittedEvidenceCopies(true))
+
+	committed := newTestDuplicateVoteEvidence(height-2, val)
+	pending := newTestDuplicateVoteEvidence(height-1, val)
+	require.NoError(t, pool.AddEvidence(committed))
+	require.NoError(t, pool.AddEvidence(pending))
+	state := pool.State()
+	state.LastBlockHeight++
+	state.LastBlockTime = state.LastBlockTime.Add(time.Minute)
+	pool.Update(state, types.EvidenceList{committed})
+	buffered := newTestDuplicateVoteEvidence(height+2, val)
+	pool.ReportConflictingVotes(buffered.VoteA, buffered.VoteB)
+	require.EqualValues(t, 1, pool.Size())
+
+	require.NoError(t, pool.Reset())
+
+	require.EqualValues(t, 0, pool.Size())
+	require.Zero(t, pool.PendingBytes())
+	require.Nil(t, pool.EvidenceFront())
+	require.NoError(t, pool.IteratePending(func(types.Evidence) bool {
+		t.Fatal("unexpected pending evidence")
+		return false
+	}))
+	evList, _ := pool.CommittedEvidence(-1)
+	require.Empty(t, evList)
+	require.False(t, pool.IsKnown(committed))
+	require.False(t, pool.IsKnown(pending))
+	require.Equal(t, state, pool.State())
+	require.NoError(t, pool.CheckConsistency())
+
+	// the buffered votes are gone as well
+	state.LastBlockHeight += 2
+	pool.Update(state, nil)
+	require.EqualValues(t, 0, pool.Size())
+
+	// the pool is usable after the reset
+	require.NoError(t, pool.AddEvidence(pending))
+	require.EqualValues(t, 1, pool.Size())
+}
+
+func TestNewPoolWarnsOfForeignKeys(t *testing.T) {
+	const warning = "found keys that are not evidence"
+
+	var height int64 = 10
+	val := types.NewMockPV()
+	stateStore := initializeValidatorState(t, val, height)
+	state, err := stateStore.Load()
+	require.NoError(t, err)
+	blockStore := initializeBlockStore(dbm.NewMemDB(), state, val.PrivKey.PubKey().Address())
+
+	// evidence written by the pool itself is not reported
+	evidenceDB := dbm.NewMemDB()
+	pool, err := evidence.NewPool(log.TestingLogger(), evidenceDB, stateStore, blockStore)
+	require.NoError(t, err)
+	require.NoError(t, pool.AddEvidence(newTestDuplicateVoteEvidence(height, val)))
+	pool.Update(createState(height+1, state.Validators), types.EvidenceList{newTestDuplicateVoteEvidence(height, val)})
+
+	require.NoError(t, pool.Close())
+
+	var buf bytes.Buffer
+	pool, err = evidence.NewPool(log.NewTMLogger(&buf), evidenceDB, stateStore, blockStore)
+	require.NoError(t, err)
+	require.NotContains(t, buf.String(), warning)
+	require.NoError(t, pool.Close())
+
+	// another subsystem writes under the committed prefix
+	foreignKey, err := orderedcode.Append(nil, int64(8), "foreign", "data")
+	require.NoError(t, err)
+	require.NoError(t, evidenceDB.Set(foreignKey, []byte("value")))
+
+	buf.Reset()
+	_, err = evidence.NewPool(log.NewTMLogger(&buf), evidenceDB, stateStore, blockStore)
+	require.NoError(t, err)
+	require.Contains(t, buf.String(), warning)
+
+	// another subsystem writes under the pending prefix. The pool may not be
+	// able to load the foreign entry but the collision must still be reported.
+	evidenceDB = dbm.NewMemDB()
+	foreignKey, err = orderedcode.Append(nil, int64(9), "foreign")
+	require.NoError(t, err)
+	require.NoError(t, evidenceDB.Set(foreignKey, []byte("value")))
+
+	buf.Reset()
+	_, _ = evidence.NewPool(log.NewTMLogger(&buf), evidenceDB, stateStore, blockStore)
+	require.Contains(t, buf.String(), warning)
+}
+
+func TestNewPoolOnOpenStore(t *testing.T) {
+	var height int64 = 10
+	val := types.NewMockPV()
+	stateStore := initializeValidatorState(t, val, height)
+	state, err := stateStore.Load()
+	require.NoError(t, err)
+	blockStore := initializeBlockStore(dbm.NewMemDB(), state, val.PrivKey.PubKey().Address())
+
+	evidenceDB := dbm.NewMemDB()
+	pool, err := evidence.NewPool(log.TestingLogger(), evidenceDB, stateStore, blockStore)
+	require.NoError(t, err)
+	require.NoError(t, pool.AddEvidence(newTestDuplicateVoteEvidence(height, val)))
+
+	_, err = evidence.NewPool(log.TestingLogger(), evidenceDB, stateStore, blockStore)
+	require.True(t, errors.Is(err, evidence.ErrPoolAlreadyOpen), err)
+
+	// other stores are unaffected
+	other, err := evidence.NewPool(log.TestingLogger(), dbm.NewMemDB(), stateStore, blockStore)
+	require.NoError(t, err)
+	require.NoError(t, other.Close())
+
+	// the store can be reopened once the pool is closed
+	require.NoError(t, pool.Close())
+	pool, err = evidence.NewPool(log.TestingLogger(), evidenceDB, stateStore, blockStore)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, pool.Size())
+	require.NoError(t, pool.Close())
+
+	// a pool that fails to open releases the store
+	votesKey, err := orderedcode.Append(nil, int64(15), height, string(bytes.Repeat([]byte{1}, 32)))
+	require.NoError(t, err)
+	require.NoError(t, evidenceDB.Set(votesKey, []byte("garbage")))
+	_, err = evidence.NewPool(log.TestingLogger(), evidenceDB, stateStore, blockStore)
+	require.Error(t, err)
+	require.NoError(t, evidenceDB.Delete(votesKey))
+	pool, err = evidence.NewPool(log.TestingLogger(), evidenceDB, stateStore, blockStore)
+	require.NoError(t, err)
+	require.NoError(t, pool.Close())
+}
+
+func TestChainIDPrefix(t *testing.T) {
+	var height int64 = 10
+	val := types.NewMockPV()
+	stateStore := initializeValidatorState(t, val, height)
+	state, err := stateStore.Load()
+	require.NoError(t, err)
+	blockStore := initializeBlockStore(dbm.NewMemDB(), state, val.PrivKey.PubKey().Address())
+	evidenceDB := dbm.NewMemDB()
+
+	// evidence added before the chain ID prefix is set is moved under it
+	legacy := newTestDuplicateVoteEvidence(height-1, val)
+	pool, err := evidence.NewPool(log.TestingLogger(), evidenceDB, stateStore, blockStore)
+	require.NoError(t, err)
+	require.NoError(t, pool.AddEvidence(legacy))
+	require.NoError(t, pool.Close())
+
+	poolA, err := evidence.NewPool(log.TestingLogger(), evidenceDB, stateStore, blockStore,
+		evidence.WithChainIDPrefix("chain-a"))
+	require.NoError(t, err)
+	defer poolA.Close()
+	require.EqualValues(t, 1, poolA.Size())
+	require.True(t, poolA.IsKnown(legacy))
+	pendingPrefix, err := orderedcode.Append(nil, int64(9))
+	require.NoError(t, err)
+	iter, err := dbm.IteratePrefix(evidenceDB, pendingPrefix)
+	require.NoError(t, err)
+	require.False(t, iter.Valid())
+	require.NoError(t, iter.Close())
+
+	// pools with different chain IDs share the store without seeing each
+	// other's evidence
+	poolB, err := evidence.NewPool(log.TestingLogger(), evidenceDB, stateStore, blockStore,
+		evidence.WithChainIDPrefix("chain-b"))
+	require.NoError(t, err)
+	defer poolB.Close()
+	require.Zero(t, poolB.Size())
+	require.False(t, poolB.IsKnown(legacy))
+
+	ev := newTestDuplicateVoteEvidence(height, val)
+	require.NoError(t, poolB.AddEvidence(ev))
+	require.False(t, poolA.IsKnown(ev))
+	evList, _ := poolA.PendingEvidence(-1)
+	require.Equal(t, []types.Evidence{legacy}, evList)
+	evList, _ = poolB.PendingEvidence(-1)
+	require.Equal(t, []types.Evidence{ev}, evList)
+
+	state.LastBlockHeight++
+	poolB.Update(state, types.EvidenceList{ev})
+	_, ok := poolA.CommittedHeight(ev)
+	require.False(t, ok)
+	require.NoError(t, poolA.AddEvidence(ev))
+	require.EqualValues(t, 2, poolA.Size())
+
+	// but only one pool may be open per chain ID
+	_, err = evidence.NewPool(log.TestingLogger(), evidenceDB, stateStore, blockStore,
+		evidence.WithChainIDPrefix("chain-a"))
+	require.True(t, errors.Is(err, evidence.ErrPoolAlreadyOpen), err)
+
+	// and a pool without a prefix can't share the store with them
+	_, err = evidence.NewPool(log.TestingLogger(), evidenceDB, stateStore, blockStore)
+	require.True(t, errors.Is(err, evidence.ErrPoolAlreadyOpen), err)
+}
+
+func TestChainIDPrefixWhileUnprefixedPoolIsOpen(t *testing.T) {
+	var height int64 = 10
+	val := types.NewMockPV()
+	stateStore := initializeValidatorState(t, val, height)
+	state, err := stateStore.Load()
+	require.NoError(t, err)
+	blockStore := initializeBlockStore(dbm.NewMemDB(), state, val.PrivKey.PubKey().Address())
+	evidenceDB := dbm.NewMemDB()
+
+	pool, err := evidence.NewPool(log.TestingLogger(), evidenceDB, stateStore, blockStore)
+	require.NoError(t, err)
+	defer pool.Close()
+	ev := newTestDuplicateVoteEvidence(height, val)
+	require.NoError(t, pool.AddEvidence(ev))
+
+	// the keys of the open pool aren't moved under the prefix
+	_, err = evidence.NewPool(log.TestingLogger(), evidenceDB, stateStore, blockStore,
+		evidence.WithChainIDPrefix("chain-a"))
+	require.True(t, errors.Is(err, evidence.ErrPoolAlreadyOpen), err)
+	require.True(t, pool.IsKnown(ev))
+	require.NoError(t, pool.CheckConsistency())
+	require.EqualValues(t, 1, pool.Size())
+}
+
+func TestAddEvidenceRetriesUnavailableStore(t *testing.T) {
+	var height int64 = 10
+	val := types.NewMockPV()
+	stateStore := initializeValidatorState(t, val, height)
+	state, err := stateStore.Load()
+	require.NoError(t, err)
+	blockStore := initializeBlockStore(dbm.NewMemDB(), state, val.PrivKey.PubKey().Address())
+
+	// without retrying the evidence is rejected straight away
+	evidenceDB := &unavailableDB{DB: dbm.NewMemDB(), failures: 3}
+	pool, err := evidence.NewPool(log.TestingLogger(), evidenceDB, stateStore, blockStore)
+	require.NoError(t, err)
+	err = pool.AddEvidence(newTestDuplicateVoteEvidence(height, val))
+	require.True(t, errors.Is(err, evidence.ErrPersistFailed), err)
+	require.False(t, errors.Is(err, evidence.ErrStoreUnavailable))
+	require.EqualValues(t, 0, pool.Size())
+
+	// the store recovers before the timeout
+	evidenceDB = &unavailableDB{DB: dbm.NewMemDB(), failures: 3}
+	pool, err = evidence.NewPool(log.TestingLogger(), evidenceDB, stateStore, blockStore,
+		evidence.WithStoreRetryTimeout(time.Second))
+	require.NoError(t, err)
+	require.NoError(t, pool.AddEvidence(newTestDuplicateVoteEvidence(height, val)))
+	require.EqualValues(t, 1, pool.Size())
+	require.Zero(t, evidenceDB.failures)
+
+	// the store doesn't recover in time
+	evidenceDB = &unavailableDB{DB: dbm.NewMemDB(), failures: 1000}
+	pool, err = evidence.NewPool(log.TestingLogger(), evidenceDB, stateStore, blockStore,
+		evidence.WithStoreRetryTimeout(50*time.Millisecond))
+	require.NoError(t, err)
+	err = pool.AddEvidence(newTestDuplicateVoteEvidence(height, val))
+	require.True(t, errors.Is(err, evidence.ErrStoreUnavailable), err)
+	require.True(t, errors.Is(err, evidence.ErrPersistFailed), err)
+	require.EqualValues(t, 0, pool.Size())
+
+	// the timeout is measured with the pool clock, which here moves on by an
+	// hour every time it's read
+	var (
+		clockMtx sync.Mutex
+		now      = defaultEvidenceTime
+	)
+	clock := func() time.Time {
+		clockMtx.Lock()
+		defer clockMtx.Unlock()
+		now = now.Add(time.Hour)
+		return now
+	}
+	evidenceDB = &unavailableDB{DB: dbm.NewMemDB(), failures: 1000}
+	pool, err = evidence.NewPool(log.TestingLogger(), evidenceDB, stateStore, blockStore,
+		evidence.WithStoreRetryTimeout(time.Minute), evidence.WithClock(clock))
+	require.NoError(t, err)
+	err = pool.AddEvidence(newTestDuplicateVoteEvidence(height, val))
+	require.True(t, errors.Is(err, evidence.ErrStoreUnavailable), err)
+	require.Greater(t, evidenceDB.failures, 990)
+	require.EqualValues(t, 0, pool.Size())
+}
+
+func TestLookupErrorsArePropagated(t *testing.T) {
+	var height int64 = 10
+	val := types.NewMockPV()
+	evidenceDB := &faultyDB{DB: dbm.NewMemDB()}
+	pool := newTestPool(t, height, val, evidenceDB)
+	pending := newTestDuplicateVoteEvidence(height-1, val)
+	require.NoError(t, pool.AddEvidence(pending))
+
+	errFault := errors.New("disk on fire")
+	evidenceDB.hasErr = errFault
+	ev := newTestDuplicateVoteEvidence(height, val)
+
+	err := pool.AddEvidence(ev)
+	require.True(t, errors.Is(err, errFault), err)
+	_, isInvalid := err.(*types.ErrInvalidEvidence)
+	require.False(t, isInvalid)
+
+	added, err := pool.AddEvidenceBatch([]types.Evidence{ev})
+	require.True(t, errors.Is(err, errFault), err)
+	require.Zero(t, added)
+
+	err = pool.VerifyEvidence(ev)
+	require.True(t, errors.Is(err, errFault), err)
+
+	err = pool.CheckEvidence(types.EvidenceList{ev})
+	require.True(t, errors.Is(err, errFault), err)
+	_, isInvalid = err.(*types.ErrInvalidEvidence)
+	require.False(t, isInvalid)
+
+	// best-effort lookups report the evidence as unknown
+	require.False(t, pool.IsKnown(pending))
+
+	require.EqualValues(t, 1, pool.Size())
+	evidenceDB.hasErr = nil
+	require.NoError(t, pool.AddEvidence(ev))
+	require.EqualValues(t, 2, pool.Size())
+}
+
+func TestWaitForEvidence(t *testing.T) {
+	var height int64 = 10
+	pool, val := defaultTestPool(t, height)
+
+	// the context is done before any evidence arrives
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	ev, err := pool.WaitForEvidence(ctx)
+	require.Equal(t, context.DeadlineExceeded, err)
+	require.Nil(t, ev)
+
+	// evidence arrives while waiting
+	expected := newTestDuplicateVoteEvidence(height, val)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		assert.NoError(t, pool.AddEvidence(expected))
+	}()
+	ev, err = pool.WaitForEvidence(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, expected, ev)
+
+	// the evidence stays in the pool
+	ev, err = pool.WaitForEvidence(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, expected, ev)
+	require.EqualValues(t, 1, pool.Size())
+}
+
+func TestAddEvidenceCtx(t *testing.T) {
+	var height int64 = 10
+	pool, val := defaultTestPool(t, height)
+
+	// evidence isn't added once the context is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ev := newTestDuplicateVoteEvidence(height, val)
+	require.Equal(t, context.Canceled, pool.AddEvidenceCtx(ctx, ev))
+	require.EqualValues(t, 0, pool.Size())
+	_, status, err := pool.GetEvidenceByHash(ev.Hash())
+	require.NoError(t, err)
+	require.Equal(t, evidence.EvidenceNotFound, status)
+
+	// nor while waiting for the store to become available
+	stateStore := initializeValidatorState(t, val, height)
+	state, err := stateStore.Load()
+	require.NoError(t, err)
+	blockStore := initializeBlockStore(dbm.NewMemDB(), state, val.PrivKey.PubKey().Address())
+	evidenceDB := &unavailableDB{DB: dbm.NewMemDB(), failures: 1000}
+	pool, err = evidence.NewPool(log.TestingLogger(), evidenceDB, stateStore, blockStore,
+		evidence.WithStoreRetryTimeout(time.Minute))
+	require.NoError(t, err)
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = pool.AddEvidenceCtx(ctx, ev)
+	require.True(t, errors.Is(err, context.DeadlineExceeded), err)
+	require.EqualValues(t, 0, pool.Size())
+}
+
+func TestEvidenceParams(t *testing.T) {
+	var height int64 = 10
+	pool, _ := defaultTestPool(t, height)
+	require.Equal(t, pool.State().ConsensusParams.Evidence, pool.EvidenceParams())
+
+	state := pool.State()
+	state.LastBlockHeight++
+	state.ConsensusParams.Evidence = types.EvidenceParams{
+		MaxAgeNumBlocks: 5,
+		MaxAgeDuration:  time.Hour,
+		MaxBytes:        1024,
+	}
+	pool.Update(state, types.EvidenceList{})
+	require.Equal(t, state.ConsensusParams.Evidence, pool.EvidenceParams())
+}
+
+func TestIsKnown(t *testing.T) {
+	var height int64 = 10
+	val := types.NewMockPV()
+	evidenceDB := dbm.NewMemDB()
+	pool := newTestPool(t, height, val, evidenceDB)
+
+	pending := newTestDuplicateVoteEvidence(height-3, val)
+	require.NoError(t, pool.AddEvidence(pending))
+	committed := newTestDuplicateVoteEvidence(height-2, val)
+	require.NoError(t, pool.AddEvidence(committed))
+	state := pool.State()
+	state.LastBlockHeight++
+	pool.Update(state, types.EvidenceList{committed})
+
+	// evidence that is both pending and committed, as after a crash between
+	// the two writes
+	both := newTestDuplicateVoteEvidence(height-1, val)
+	require.NoError(t, pool.AddEvidence(both))
+	key, err := orderedcode.Append(nil, int64(8), both.Height(), string(both.Hash()))
+	require.NoError(t, err)
+	require.NoError(t, evidenceDB.Set(key, []byte{}))
+
+	neither := newTestDuplicateVoteEvidence(height, val)
+
+	assert.True(t, pool.IsKnown(pending))
+	assert.True(t, pool.IsKnown(committed))
+	assert.True(t, pool.IsKnown(both))
+	assert.False(t, pool.IsKnown(neither))
+}
+
+func TestAddEvidenceBatch(t *testing.T) {
+	var height int64 = 10
+	pool, val := defaultTestPool(t, height)
+
+	pending := newTestDuplicateVoteEvidence(height-3, val)
+	require.NoError(t, pool.AddEvidence(pending))
+	committed := newTestDuplicateVoteEvidence(height-2, val)
+	require.NoError(t, pool.CheckEvidence(types.EvidenceList{committed}))
+	state := pool.State()
+	state.LastBlockHeight++
+	pool.Update(state, types.EvidenceList{committed})
+	require.EqualValues(t, 1, pool.Size())
 
-	require.NoError(t, pool.CheckEvidence(types.EvidenceList{ev}))
+	first := newTestDuplicateVoteEvidence(height-1, val)
+	second := newTestDuplicateVoteEvidence(height, val)
+	added, err := pool.AddEvidenceBatch([]types.Evidence{first, pending, first, committed, second})
+	require.NoError(t, err)
+	assert.Equal(t, 2, added)
+	assert.EqualValues(t, 3, pool.Size())
+	evList, _ := pool.PendingEvidence(-1)
+	assert.Equal(t, []types.Evidence{pending, first, second}, evList)
 
-	pool.Update(state, block.Evidence.Evidence)
+	// invalid evidence is reported while valid evidence is still added
+	invalid := types.NewMockDuplicateVoteEvidenceWithValidator(height-4, defaultEvidenceTime, val, evidenceChainID)
+	valid := newTestDuplicateVoteEvidence(height-5, val)
+	added, err = pool.AddEvidenceBatch([]types.Evidence{invalid, valid})
+	require.Error(t, err)
+	_, ok := err.(*types.ErrInvalidEvidence)
+	assert.True(t, ok, err)
+	assert.Equal(t, 1, added)
+	assert.EqualValues(t, 4, pool.Size())
+	_, status, err := pool.GetEvidenceByHash(invalid.Hash())
+	require.NoError(t, err)
+	assert.Equal(t, evidence.EvidenceNotFound, status)
 
-	// a) Update marks evidence as committed so pending evidence should be empty
-	evList, evSize := pool.PendingEvidence(defaultEvidenceMaxBytes)
-	require.Empty(t, evList)
-	require.Zero(t, evSize)
+	// nothing to add
+	added, err = pool.AddEvidenceBatch(nil)
+	require.NoError(t, err)
+	assert.Zero(t, added)
+}
 
-	// b) If we try to check this evidence again it should fail because it has already been committed
-	err := pool.CheckEvidence(types.EvidenceList{ev})
-	if assert.Error(t, err) {
-		assert.Equal(t, "evidence was already committed", err.(*types.ErrInvalidEvidence).Reason.Error())
-	}
+func TestAddEvidenceBatchToFullPool(t *testing.T) {
+	var height int64 = 10
+	pool, val := defaultTestPool(t, height, evidence.WithMaxPendingEvidence(2))
+
+	added, err := pool.AddEvidenceBatch([]types.Evidence{
+		newTestDuplicateVoteEvidence(height-2, val),
+		newTestDuplicateVoteEvidence(height-1, val),
+		newTestDuplicateVoteEvidence(height, val),
+	})
+	require.True(t, errors.Is(err, evidence.ErrEvidencePoolFull), err)
+	assert.Equal(t, 2, added)
+	assert.EqualValues(t, 2, pool.Size())
 }
 
-func TestVerifyPendingEvidencePasses(t *testing.T) {
-	var height int64 = 1
+func TestCheckConsistency(t *testing.T) {
+	var height int64 = 10
+	val := types.NewMockPV()
+	evidenceDB := dbm.NewMemDB()
+	pool := newTestPool(t, height, val, evidenceDB)
 
-	pool, val := defaultTestPool(t, height)
-	ev := types.NewMockDuplicateVoteEvidenceWithValidator(
-		height,
-		defaultEvidenceTime.Add(1*time.Minute),
-		val,
-		evidenceChainID,
-	)
+	stored := newTestDuplicateVoteEvidence(height-2, val)
+	require.NoError(t, pool.AddEvidence(stored))
+	require.NoError(t, pool.CheckConsistency())
 
-	require.NoError(t, pool.AddEvidence(ev))
-	require.NoError(t, pool.CheckEvidence(types.EvidenceList{ev}))
+	// evidence only in the list, evidence only in the store and a size that
+	// disagrees with both
+	listed := newTestDuplicateVoteEvidence(height-1, val)
+	pool.PushEvidenceToList(listed)
+	unlisted := newTestDuplicateVoteEvidence(height, val)
+	evpb, err := types.EvidenceToProto(unlisted)
+	require.NoError(t, err)
+	evBytes, err := evpb.Marshal()
+	require.NoError(t, err)
+	key, err := orderedcode.Append(nil, int64(9), unlisted.Height(), string(unlisted.Hash()))
+	require.NoError(t, err)
+	require.NoError(t, evidenceDB.Set(key, evBytes))
+	pool.SetSize(5)
+
+	err = pool.CheckConsistency()
+	var inconsistency *evidence.InconsistencyError
+	require.True(t, errors.As(err, &inconsistency), err)
+	assert.Equal(t, []tmbytes.HexBytes{unlisted.Hash()}, inconsistency.MissingFromList)
+	assert.Equal(t, []tmbytes.HexBytes{listed.Hash()}, inconsistency.MissingFromStore)
+	assert.EqualValues(t, 2, inconsistency.StoredSize)
+	assert.EqualValues(t, 5, inconsistency.Size)
+
+	// reloading the pending evidence restores consistency
+	require.NoError(t, pool.RecalculateSize())
+	require.NoError(t, pool.CheckConsistency())
 }
 
-func TestVerifyDuplicatedEvidenceFails(t *testing.T) {
-	var height int64 = 1
-	pool, val := defaultTestPool(t, height)
-	ev := types.NewMockDuplicateVoteEvidenceWithValidator(
-		height,
-		defaultEvidenceTime.Add(1*time.Minute),
-		val,
-		evidenceChainID,
-	)
+func TestValidateStore(t *testing.T) {
+	var height int64 = 10
+	val := types.NewMockPV()
+	stateStore := initializeValidatorState(t, val, height)
+	state, err := stateStore.Load()
+	require.NoError(t, err)
+	blockStore := initializeBlockStore(dbm.NewMemDB(), state, val.PrivKey.PubKey().Address())
+	evidenceDB := dbm.NewMemDB()
+	pool, err := evidence.NewPool(log.TestingLogger(), evidenceDB, stateStore, blockStore)
+	require.NoError(t, err)
 
-	err := pool.CheckEvidence(types.EvidenceList{ev, ev})
-	if assert.Error(t, err) {
-		assert.Equal(t, "duplicate evidence", err.(*types.ErrInvalidEvidence).Reason.Error())
+	pendingKey := func(height int64, hash []byte) []byte {
+		key, err := orderedcode.Append(nil, int64(9), height, string(hash))
+		require.NoError(t, err)
+		return key
+	}
+	evBytes := func(ev types.Evidence) []byte {
+		evpb, err := types.EvidenceToProto(ev)
+		require.NoError(t, err)
+		bz, err := evpb.Marshal()
+		require.NoError(t, err)
+		return bz
 	}
-}
 
-// check that valid light client evidence is correctly validated and stored in
-// evidence pool
-func TestCheckEvidenceWithLightClientAttack(t *testing.T) {
-	var (
-		nValidators          = 5
-		validatorPower int64 = 10
-		height         int64 = 10
-	)
+	good := newTestDuplicateVoteEvidence(height, val)
+	require.NoError(t, pool.AddEvidence(good))
+	nonCanonical := newTestDuplicateVoteEvidence(height-1, val)
+	require.NoError(t, pool.AddEvidence(nonCanonical))
 
-	conflictingVals, conflictingPrivVals := types.RandValidatorSet(nValidators, validatorPower)
-	trustedHeader := makeHeaderRandom(height)
-	trustedHeader.Time = defaultEvidenceTime
+	corrupt, err := pool.ValidateStore()
+	require.NoError(t, err)
+	require.Empty(t, corrupt)
 
-	conflictingHeader := makeHeaderRandom(height)
-	conflictingHeader.ValidatorsHash = conflictingVals.Hash()
+	// an unknown field is skipped when decoding but not encoded again
+	nonCanonicalKey := pendingKey(nonCanonical.Height(), nonCanonical.Hash())
+	require.NoError(t, evidenceDB.Set(nonCanonicalKey, append(evBytes(nonCanonical), 120, 1)))
+	// bytes that aren't evidence
+	garbageKey := pendingKey(height-2, bytes.Repeat([]byte{1}, 32))
+	require.NoError(t, evidenceDB.Set(garbageKey, []byte("garbage")))
+	// valid evidence stored under the wrong hash
+	misplacedKey := pendingKey(height, bytes.Repeat([]byte{2}, 32))
+	require.NoError(t, evidenceDB.Set(misplacedKey, evBytes(good)))
 
-	trustedHeader.ValidatorsHash = conflictingHeader.ValidatorsHash
-	trustedHeader.NextValidatorsHash = conflictingHeader.NextValidatorsHash
-	trustedHeader.ConsensusHash = conflictingHeader.ConsensusHash
-	trustedHeader.AppHash = conflictingHeader.AppHash
-	trustedHeader.LastResultsHash = conflictingHeader.LastResultsHash
+	corrupt, err = pool.ValidateStore()
+	require.NoError(t, err)
+	require.ElementsMatch(t, [][]byte{nonCanonicalKey, garbageKey, misplacedKey}, corrupt)
 
-	// For simplicity we are simulating a duplicate vote attack where all the
-	// validators in the conflictingVals set voted twice.
-	blockID := makeBlockID(conflictingHeader.Hash(), 1000, []byte("partshash"))
-	voteSet := types.NewVoteSet(evidenceChainID, height, 1, tmproto.SignedMsgType(2), conflictingVals)
+	// validation doesn't delete anything
+	ok, err := evidenceDB.Has(garbageKey)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.EqualValues(t, 2, pool.Size())
 
-	commit, err := types.MakeCommit(blockID, height, 1, voteSet, conflictingPrivVals, defaultEvidenceTime)
+	// valid entries are never removed
+	require.NoError(t, pool.RemoveCorruptEvidence(append(corrupt, pendingKey(good.Height(), good.Hash()))))
+	corrupt, err = pool.ValidateStore()
 	require.NoError(t, err)
+	require.Empty(t, corrupt)
 
-	ev := &types.LightClientAttackEvidence{
-		ConflictingBlock: &types.LightBlock{
-			SignedHeader: &types.SignedHeader{
-				Header: conflictingHeader,
-				Commit: commit,
-			},
-			ValidatorSet: conflictingVals,
-		},
-		CommonHeight:        10,
-		TotalVotingPower:    int64(nValidators) * validatorPower,
-		ByzantineValidators: conflictingVals.Validators,
-		Timestamp:           defaultEvidenceTime,
+	require.EqualValues(t, 1, pool.Size())
+	evList, _ := pool.PendingEvidence(-1)
+	require.Equal(t, []types.Evidence{good}, evList)
+	require.Equal(t, good, pool.EvidenceFront().Value.(types.Evidence))
+	require.Nil(t, pool.EvidenceFront().Next())
+}
+
+func TestRemovePending(t *testing.T) {
+	var height int64 = 10
+	val := types.NewMockPV()
+	evidenceDB := dbm.NewMemDB()
+	pool := newTestPool(t, height, val, evidenceDB)
+
+	evs := make([]types.Evidence, 3)
+	for i := range evs {
+		evs[i] = newTestDuplicateVoteEvidence(height-int64(i), val)
+		require.NoError(t, pool.AddEvidence(evs[i]))
 	}
+	bytesBefore := pool.PendingBytes()
 
-	trustedBlockID := makeBlockID(trustedHeader.Hash(), 1000, []byte("partshash"))
-	trustedVoteSet := types.NewVoteSet(evidenceChainID, height, 1, tmproto.SignedMsgType(2), conflictingVals)
-	trustedCommit, err := types.MakeCommit(
-		trustedBlockID,
-		height,
-		1,
-		trustedVoteSet,
-		conflictingPrivVals,
-		defaultEvidenceTime,
-	)
+	removed := evs[1]
+	require.NoError(t, pool.RemovePending(removed))
+	require.EqualValues(t, 2, pool.Size())
+	evList, _ := pool.PendingEvidence(-1)
+	require.ElementsMatch(t, []types.Evidence{evs[0], evs[2]}, evList)
+	pendingBytes := pool.PendingBytes()
+	require.Less(t, pendingBytes, bytesBefore)
+	require.NoError(t, pool.CheckConsistency())
+	_, status, err := pool.GetEvidenceByHash(removed.Hash())
 	require.NoError(t, err)
+	require.Equal(t, evidence.EvidenceNotFound, status)
+	record, ok := pool.RemovalInfo(removed.Hash())
+	require.True(t, ok)
+	require.Equal(t, evidence.RemovalManual, record.Reason)
 
-	state := sm.State{
-		LastBlockTime:   defaultEvidenceTime.Add(1 * time.Minute),
-		LastBlockHeight: 11,
-		ConsensusParams: *types.DefaultConsensusParams(),
+	// removing it again or removing evidence that was never added fails
+	err = pool.RemovePending(removed)
+	require.True(t, errors.Is(err, evidence.ErrNotPending), err)
+	err = pool.RemovePending(newTestDuplicateVoteEvidence(height, val))
+	require.True(t, errors.Is(err, evidence.ErrNotPending), err)
+	require.EqualValues(t, 2, pool.Size())
+
+	// the removed evidence stays removed after a restart
+	require.NoError(t, pool.Close())
+	pool = newTestPool(t, height, val, evidenceDB)
+	require.EqualValues(t, 2, pool.Size())
+	require.Equal(t, pendingBytes, pool.PendingBytes())
+	require.NoError(t, pool.CheckConsistency())
+}
+
+func TestRemovePendingWhileCommitting(t *testing.T) {
+	var height int64 = 10
+	pool, val := defaultTestPool(t, height)
+	require.NoError(t, pool.AddEvidence(newTestDuplicateVoteEvidence(height, val)))
+	size := pool.PendingBytes()
+
+	state := pool.State()
+	state.ConsensusParams.Evidence.MaxAgeNumBlocks = 1000
+	state.ConsensusParams.Evidence.MaxAgeDuration = 1000 * time.Minute
+	for i := 0; i < 200; i++ {
+		ev := newTestDuplicateVoteEvidence(state.LastBlockHeight, val)
+		require.NoError(t, pool.AddVerifiedEvidence(ev))
+
+		var removeErr error
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			removeErr = pool.RemovePending(ev)
+		}()
+		state.LastBlockHeight++
+		state.LastBlockTime = state.LastBlockTime.Add(time.Minute)
+		pool.Update(state, types.EvidenceList{ev})
+		<-done
+
+		// the evidence is either removed or committed, but not both
+		require.EqualValues(t, 1, pool.Size())
+		require.Equal(t, size, pool.PendingBytes())
+		record, ok := pool.RemovalInfo(ev.Hash())
+		require.True(t, ok)
+		if removeErr == nil {
+			require.Equal(t, evidence.RemovalManual, record.Reason)
+		} else {
+			require.True(t, errors.Is(removeErr, evidence.ErrNotPending), removeErr)
+			require.Equal(t, evidence.RemovalCommitted, record.Reason)
+		}
 	}
+}
 
-	stateStore := &smmocks.Store{}
-	stateStore.On("LoadValidators", height).Return(conflictingVals, nil)
-	stateStore.On("Load").Return(state, nil)
+func TestRevalidatePending(t *testing.T) {
+	var height int64 = 10
+	verdicts := make(map[string]error)
+	verifier := evidence.WithVerifier(verifierFunc(func(ev types.Evidence, _ sm.State) error {
+		return verdicts[string(ev.Hash())]
+	}))
+	pool, val := defaultTestPool(t, height, verifier, evidence.WithMaxExpiredPerUpdate(1))
 
-	blockStore := &mocks.BlockStore{}
-	blockStore.On("LoadBlockMeta", height).Return(&types.BlockMeta{Header: *trustedHeader})
-	blockStore.On("LoadBlockCommit", height).Return(trustedCommit)
+	evs := make(map[int64]types.Evidence)
+	for h := height - 5; h <= height; h++ {
+		evs[h] = newTestDuplicateVoteEvidence(h, val)
+		require.NoError(t, pool.AddEvidence(evs[h]))
+	}
 
-	pool, err := evidence.NewPool(log.TestingLogger(), dbm.NewMemDB(), stateStore, blockStore)
-	require.NoError(t, err)
+	// shorten the age window so that the evidence below height 8 expires, of
+	// which Update prunes only one
+	state := pool.State()
+	state.LastBlockHeight++
+	state.LastBlockTime = defaultEvidenceTime.Add(time.Duration(state.LastBlockHeight) * time.Minute)
+	state.ConsensusParams.Evidence.MaxAgeNumBlocks = 3
+	state.ConsensusParams.Evidence.MaxAgeDuration = time.Minute
+	pool.Update(state, nil)
+	require.EqualValues(t, 5, pool.Size())
 
-	require.NoError(t, pool.AddEvidence(ev))
-	require.NoError(t, pool.CheckEvidence(types.EvidenceList{ev}))
+	// evidence that is now invalid is removed, while evidence that can't be
+	// verified is kept
+	verdicts[string(evs[8].Hash())] = &types.ErrInvalidEvidence{Evidence: evs[8], Reason: errors.New("invalid")}
+	verdicts[string(evs[9].Hash())] = evidence.ErrNoValidatorSetForHeight
 
-	// Take away the last signature -> there are less validators then what we have detected,
-	// hence this should fail.
-	commit.Signatures = append(commit.Signatures[:nValidators-1], types.NewCommitSigAbsent())
-	require.Error(t, pool.CheckEvidence(types.EvidenceList{ev}))
+	removed, err := pool.RevalidatePending()
+	require.NoError(t, err)
+	require.Equal(t, 3, removed)
+	evList, _ := pool.PendingEvidence(-1)
+	require.Equal(t, []types.Evidence{evs[9], evs[10]}, evList)
+	require.NoError(t, pool.CheckConsistency())
+	for h, reason := range map[int64]evidence.RemovalReason{
+		6: evidence.RemovalExpired,
+		7: evidence.RemovalExpired,
+		8: evidence.RemovalInvalid,
+	} {
+		record, ok := pool.RemovalInfo(evs[h].Hash())
+		require.True(t, ok)
+		require.Equal(t, reason, record.Reason)
+	}
+
+	removed, err = pool.RevalidatePending()
+	require.NoError(t, err)
+	require.Zero(t, removed)
+	require.EqualValues(t, 2, pool.Size())
 }
 
-// Tests that restarting the evidence pool after a potential failure will recover the
-// pending evidence and continue to gossip it
-func TestRecoverPendingEvidence(t *testing.T) {
-	height := int64(10)
+func TestRemovePendingAtHeight(t *testing.T) {
+	var height int64 = 10
 	val := types.NewMockPV()
-	valAddress := val.PrivKey.PubKey().Address()
 	evidenceDB := dbm.NewMemDB()
-	stateStore := initializeValidatorState(t, val, height)
+	pool := newTestPool(t, height, val, evidenceDB)
 
-	state, err := stateStore.Load()
+	var kept, removed []types.Evidence
+	for h := height - 2; h <= height; h++ {
+		for i := 0; i < 2; i++ {
+			ev := newTestDuplicateVoteEvidence(h, val)
+			require.NoError(t, pool.AddEvidence(ev))
+			if h == height-1 {
+				removed = append(removed, ev)
+			} else {
+				kept = append(kept, ev)
+			}
+		}
+	}
+	// an entry that can't be decoded, which isn't counted in the size
+	garbageKey, err := orderedcode.Append(nil, int64(9), height-1, string(bytes.Repeat([]byte{1}, 32)))
 	require.NoError(t, err)
+	require.NoError(t, evidenceDB.Set(garbageKey, []byte("garbage")))
 
-	blockStore := initializeBlockStore(dbm.NewMemDB(), state, valAddress)
-
-	// create previous pool and populate it
-	pool, err := evidence.NewPool(log.TestingLogger(), evidenceDB, stateStore, blockStore)
+	n, err := pool.RemovePendingAtHeight(height - 1)
 	require.NoError(t, err)
+	require.Equal(t, 3, n)
 
-	goodEvidence := types.NewMockDuplicateVoteEvidenceWithValidator(
-		height,
-		defaultEvidenceTime.Add(10*time.Minute),
-		val,
-		evidenceChainID,
-	)
-	expiredEvidence := types.NewMockDuplicateVoteEvidenceWithValidator(
-		int64(1),
-		defaultEvidenceTime.Add(1*time.Minute),
-		val,
-		evidenceChainID,
-	)
-
-	require.NoError(t, pool.AddEvidence(goodEvidence))
-	require.NoError(t, pool.AddEvidence(expiredEvidence))
+	require.EqualValues(t, 4, pool.Size())
+	evList, _ := pool.PendingEvidence(-1)
+	require.ElementsMatch(t, kept, evList)
+	require.NoError(t, pool.CheckConsistency())
+	for _, ev := range removed {
+		_, status, err := pool.GetEvidenceByHash(ev.Hash())
+		require.NoError(t, err)
+		require.Equal(t, evidence.EvidenceNotFound, status)
+		record, ok := pool.RemovalInfo(ev.Hash())
+		require.True(t, ok)
+		require.Equal(t, evidence.RemovalManual, record.Reason)
+	}
+	ok, err := evidenceDB.Has(garbageKey)
+	require.NoError(t, err)
+	require.False(t, ok)
 
-	// now recover from the previous pool at a different time
-	newStateStore := &smmocks.Store{}
-	newStateStore.On("Load").Return(sm.State{
-		LastBlockTime:   defaultEvidenceTime.Add(25 * time.Minute),
-		LastBlockHeight: height + 15,
-		ConsensusParams: types.ConsensusParams{
-			Block: types.BlockParams{
-				MaxBytes: 22020096,
-				MaxGas:   -1,
-			},
-			Evidence: types.EvidenceParams{
-				MaxAgeNumBlocks: 20,
-				MaxAgeDuration:  20 * time.Minute,
-				MaxBytes:        1000,
-			},
-		},
-	}, nil)
+	// the removed evidence stays removed after a restart
+	require.NoError(t, pool.Close())
+	pool = newTestPool(t, height, val, evidenceDB)
+	require.EqualValues(t, 4, pool.Size())
 
-	newPool, err := evidence.NewPool(log.TestingLogger(), evidenceDB, newStateStore, blockStore)
+	// removing again or at a height without evidence changes nothing
+	n, err = pool.RemovePendingAtHeight(height - 1)
 	require.NoError(t, err)
+	require.Zero(t, n)
+	n, err = pool.RemovePendingAtHeight(height + 1)
+	require.NoError(t, err)
+	require.Zero(t, n)
+	require.EqualValues(t, 4, pool.Size())
 
-	evList, _ := newPool.PendingEvidence(defaultEvidenceMaxBytes)
-	require.Equal(t, 1, len(evList))
-
-	next := newPool.EvidenceFront()
-	require.Equal(t, goodEvidence, next.Value.(types.Evidence))
+	_, err = pool.RemovePendingAtHeight(0)
+	require.Error(t, err)
 }
 
-func initializeStateFromValidatorSet(t *testing.T, valSet *types.ValidatorSet, height int64) sm.Store {
+func initializeStateFromValidatorSet(t testing.TB, valSet *types.ValidatorSet, height int64) sm.Store {
 	stateDB := dbm.NewMemDB()
 	stateStore := sm.NewStore(stateDB)
 	state := sm.State{
@@ -411,16 +4215,17 @@ func initializeStateFromValidatorSet(t *testing.T, valSet *types.ValidatorSet, h
 		},
 	}
 
-	// save all states up to height
+	// save all states up to height, with the block times of initializeBlockStore
 	for i := int64(0); i <= height; i++ {
 		state.LastBlockHeight = i
+		state.LastBlockTime = defaultEvidenceTime.Add(time.Duration(i) * time.Minute)
 		require.NoError(t, stateStore.Save(state))
 	}
 
 	return stateStore
 }
 
-func initializeValidatorState(t *testing.T, privVal types.PrivValidator, height int64) sm.Store {
+func initializeValidatorState(t testing.TB, privVal types.PrivValidator, height int64) sm.Store {
 	pubKey, _ := privVal.GetPubKey()
 	validator := &types.Validator{Address: pubKey.Address(), VotingPower: 10, PubKey: pubKey}
 
@@ -465,18 +4270,131 @@ func makeCommit(height int64, valAddr []byte) *types.Commit {
 	return types.NewCommit(height, 0, types.BlockID{}, commitSigs)
 }
 
-func defaultTestPool(t *testing.T, height int64) (*evidence.Pool, types.MockPV) {
+func defaultTestPool(t *testing.T, height int64, options ...evidence.PoolOption) (*evidence.Pool, types.MockPV) {
 	val := types.NewMockPV()
+	return newTestPool(t, height, val, dbm.NewMemDB(), options...), val
+}
+
+// newTestPool creates a pool using the given evidence db, with val as the only
+// validator up to height.
+func newTestPool(
+	t testing.TB,
+	height int64,
+	val types.MockPV,
+	evidenceDB dbm.DB,
+	options ...evidence.PoolOption,
+) *evidence.Pool {
 	valAddress := val.PrivKey.PubKey().Address()
-	evidenceDB := dbm.NewMemDB()
 	stateStore := initializeValidatorState(t, val, height)
 	state, _ := stateStore.Load()
 	blockStore := initializeBlockStore(dbm.NewMemDB(), state, valAddress)
 
-	pool, err := evidence.NewPool(log.TestingLogger(), evidenceDB, stateStore, blockStore)
+	pool, err := evidence.NewPool(log.TestingLogger(), evidenceDB, stateStore, blockStore, options...)
 	require.NoError(t, err, "test evidence pool could not be created")
 
-	return pool, val
+	return pool
+}
+
+// newTestDuplicateVoteEvidence creates duplicate vote evidence at the given
+// height with the block time used by initializeBlockStore.
+func newTestDuplicateVoteEvidence(height int64, val types.MockPV) *types.DuplicateVoteEvidence {
+	return types.NewMockDuplicateVoteEvidenceWithValidator(
+		height,
+		defaultEvidenceTime.Add(time.Duration(height)*time.Minute),
+		val,
+		evidenceChainID,
+	)
+}
+
+// historicalBlockStore is a block store whose blocks contain the given
+// evidence, as if they had been synced from the network. Only the header and
+// evidence of blocks are loaded and the number of blocks loaded is counted.
+type historicalBlockStore struct {
+	*store.BlockStore
+	evidence map[int64]types.EvidenceList
+	loaded   int
+}
+
+func (bs *historicalBlockStore) LoadBlockMeta(height int64) *types.BlockMeta {
+	meta := bs.BlockStore.LoadBlockMeta(height)
+	if evList, ok := bs.evidence[height]; ok && meta != nil {
+		meta.Header.EvidenceHash = evList.Hash()
+	}
+	return meta
+}
+
+func (bs *historicalBlockStore) LoadBlock(height int64) *types.Block {
+	bs.loaded++
+	meta := bs.LoadBlockMeta(height)
+	if meta == nil {
+		return nil
+	}
+	return &types.Block{Header: meta.Header, Evidence: types.EvidenceData{Evidence: bs.evidence[height]}}
+}
+
+// emptyHashEvidence is evidence with an empty hash, which the pool should
+// never see.
+type emptyHashEvidence struct {
+	*types.DuplicateVoteEvidence
+}
+
+func (emptyHashEvidence) Hash() []byte { return nil }
+
+// zeroHeightEvidence is evidence with a height of zero.
+type zeroHeightEvidence struct {
+	*types.DuplicateVoteEvidence
+}
+
+func (zeroHeightEvidence) Height() int64 { return 0 }
+
+// collidingEvidence has the given hash rather than its own.
+type collidingEvidence struct {
+	*types.DuplicateVoteEvidence
+	hash []byte
+}
+
+func (ev collidingEvidence) Hash() []byte { return ev.hash }
+
+type temporaryError struct{}
+
+func (temporaryError) Error() string   { return "store is compacting" }
+func (temporaryError) Temporary() bool { return true }
+
+// unavailableDB fails the given number of batch writes with a temporary error
+// before letting writes through to the underlying db.
+type unavailableDB struct {
+	dbm.DB
+	failures int
+}
+
+func (db *unavailableDB) NewBatch() dbm.Batch {
+	return &unavailableBatch{Batch: db.DB.NewBatch(), db: db}
+}
+
+type unavailableBatch struct {
+	dbm.Batch
+	db *unavailableDB
+}
+
+func (b *unavailableBatch) WriteSync() error {
+	if b.db.failures > 0 {
+		b.db.failures--
+		return temporaryError{}
+	}
+	return b.Batch.WriteSync()
+}
+
+// faultyDB fails all Has calls with hasErr if it is set.
+type faultyDB struct {
+	dbm.DB
+	hasErr error
+}
+
+func (db *faultyDB) Has(key []byte) (bool, error) {
+	if db.hasErr != nil {
+		return false, db.hasErr
+	}
+	return db.DB.Has(key)
 }
 
 func createState(height int64, valSet *types.ValidatorSet) sm.State {
@@ -0,0 +1,64 @@
+package evidence
+
+// PressureThresholds are the high- and low-water marks of the pending evidence
+// which determine whether the pool is under pressure, see
+// WithPressureThresholds. A zero high-water mark is ignored.
+type PressureThresholds struct {
+	// The pool comes under pressure once it holds HighSize evidence or
+	// HighBytes bytes of evidence.
+	HighSize  uint32
+	HighBytes int64
+	// The pool is relieved once it holds at most LowSize evidence and at most
+	// LowBytes bytes of evidence. Low-water marks above their high-water mark
+	// are lowered to it.
+	LowSize  uint32
+	LowBytes int64
+}
+
+// UnderPressure returns true if the pending evidence has reached one of the
+// high-water marks set with WithPressureThresholds and hasn't dropped to the
+// low-water marks since. The reactor may then stop accepting evidence from
+// peers until the pool is relieved.
+func (evpool *Pool) UnderPressure() bool {
+	evpool.pressureMtx.Lock()
+	defer evpool.pressureMtx.Unlock()
+	return evpool.underPressure
+}
+
+// PressureChan returns a channel that is closed once the pool comes under
+// pressure, see UnderPressure. When the pool is relieved, PressureChan returns
+// a new channel.
+func (evpool *Pool) PressureChan() <-chan struct{} {
+	evpool.pressureMtx.Lock()
+	defer evpool.pressureMtx.Unlock()
+	return evpool.pressureCh
+}
+
+// updatePressure checks the pending evidence against the pressure thresholds.
+// It is called whenever the number or size of pending evidence changes.
+func (evpool *Pool) updatePressure() {
+	thresholds := evpool.pressureThresholds
+	if thresholds.HighSize == 0 && thresholds.HighBytes == 0 {
+		return
+	}
+
+	evpool.pressureMtx.Lock()
+	defer evpool.pressureMtx.Unlock()
+
+	size, pending := evpool.Size(), evpool.PendingBytes()
+	switch {
+	case !evpool.underPressure &&
+		(thresholds.HighSize > 0 && size >= thresholds.HighSize ||
+			thresholds.HighBytes > 0 && pending >= thresholds.HighBytes):
+		evpool.underPressure = true
+		close(evpool.pressureCh)
+		evpool.logger.Info("evidence pool is under pressure", "size", size, "bytes", pending)
+
+	case evpool.underPressure &&
+		(thresholds.HighSize == 0 || size <= thresholds.LowSize) &&
+		(thresholds.HighBytes == 0 || pending <= thresholds.LowBytes):
+		evpool.underPressure = false
+		evpool.pressureCh = make(chan struct{})
+		evpool.logger.Info("evidence pool is no longer under pressure", "size", size, "bytes", pending)
+	}
+}
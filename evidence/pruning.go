@@ -0,0 +1,151 @@
+package evidence
+
+import (
+	"time"
+
+	"github.com/google/orderedcode"
+
+	"github.com/tendermint/tendermint/types"
+)
+
+// StartPruning prunes expired pending evidence in the background at the
+// interval set with WithBackgroundPruning, measuring time against the local
+// clock. Heights are still measured against the last block, so a node that
+// receives no blocks only prunes evidence that was already older than
+// MaxAgeNumBlocks, as anything more recent may still be committed. It does
+// nothing if background pruning is disabled or running, or the pool is
+// read-only. Restore and Reset must not be called while it runs.
+func (evpool *Pool) StartPruning() {
+	evpool.pruneMtx.Lock()
+	defer evpool.pruneMtx.Unlock()
+	if evpool.pruneInterval <= 0 || evpool.pruneQuit != nil || evpool.readOnly {
+		return
+	}
+	evpool.pruneQuit = make(chan struct{})
+	evpool.pruneDone = make(chan struct{})
+	go evpool.pruneRoutine(evpool.pruneInterval, evpool.pruneQuit, evpool.pruneDone)
+}
+
+// StopPruning stops the background pruning started by StartPruning and waits
+// for it to finish. It does nothing if background pruning isn't running.
+func (evpool *Pool) StopPruning() {
+	evpool.pruneMtx.Lock()
+	quit, done := evpool.pruneQuit, evpool.pruneDone
+	evpool.pruneQuit, evpool.pruneDone = nil, nil
+	evpool.pruneMtx.Unlock()
+	if quit == nil {
+		return
+	}
+	close(quit)
+	<-done
+}
+
+// NextPrune returns the height and time after which pending evidence expires
+// next, see StartPruning and Update. Evidence that expires earlier, for example
+// because of an expiry override, lingers until then.
+func (evpool *Pool) NextPrune() (height int64, t time.Time) {
+	evpool.pruningMtx.Lock()
+	defer evpool.pruningMtx.Unlock()
+	return evpool.pruningHeight, evpool.pruningTime
+}
+
+// setPruningPoint sets when to prune next.
+func (evpool *Pool) setPruningPoint(height int64, t time.Time) {
+	evpool.pruningMtx.Lock()
+	defer evpool.pruningMtx.Unlock()
+	evpool.pruningHeight, evpool.pruningTime = height, t
+}
+
+// schedulePruning brings the next prune forward to when the evidence that was
+// just added to the pending pool expires, given the evidence params. If it's
+// the only pending evidence, the next prune is when it expires.
+func (evpool *Pool) schedulePruning(ev types.Evidence, params types.EvidenceParams) {
+	expiry := evpool.expiryParams(ev, params)
+	height := evpool.expiryHeight(ev) + expiry.MaxAgeNumBlocks
+	t := ev.Time().Add(expiry.MaxAgeDuration)
+
+	evpool.pruningMtx.Lock()
+	defer evpool.pruningMtx.Unlock()
+	if evpool.Size() <= 1 {
+		evpool.pruningHeight, evpool.pruningTime = height, t
+		return
+	}
+	if height < evpool.pruningHeight {
+		evpool.pruningHeight = height
+	}
+	if t.Before(evpool.pruningTime) {
+		evpool.pruningTime = t
+	}
+}
+
+// pruneRoutine prunes expired pending evidence every interval until quit is
+// closed, upon which it closes done.
+func (evpool *Pool) pruneRoutine(interval time.Duration, quit <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			evpool.pruneExpired()
+		case <-quit:
+			return
+		}
+	}
+}
+
+// pruneExpired prunes the pending evidence that has expired by the local
+// clock and the latest height, see StartPruning.
+func (evpool *Pool) pruneExpired() {
+	evpool.pruneMtx.Lock()
+	defer evpool.pruneMtx.Unlock()
+	if evpool.Size() == 0 {
+		return
+	}
+
+	evpool.mtx.RLock()
+	now := evpool.expiryTime
+	evpool.mtx.RUnlock()
+	if clock := evpool.now(); clock.After(now) {
+		now = clock
+	}
+
+	evpool.setPruningPoint(evpool.removeExpiredPendingEvidence(now))
+	evpool.savePruningPoint()
+}
+
+// loadPruningPoint returns the persisted height and time at which to prune
+// expired evidence next, if any.
+func (evpool *Pool) loadPruningPoint() (int64, time.Time, bool) {
+	bz, err := evpool.evidenceStore.Get(prefixToBytes(prefixPruning))
+	if err != nil {
+		evpool.logger.Error("failed to load pruning point", "err", err)
+		return 0, time.Time{}, false
+	}
+	if bz == nil {
+		return 0, time.Time{}, false
+	}
+
+	var height, nanos int64
+	if _, err := orderedcode.Parse(string(bz), &height, &nanos); err != nil {
+		evpool.logger.Error("failed to decode pruning point", "err", err)
+		return 0, time.Time{}, false
+	}
+	return height, time.Unix(0, nanos).UTC(), true
+}
+
+// savePruningPoint persists the height and time at which to prune expired
+// evidence next, so that the pool doesn't need to scan all pending evidence
+// when it is restarted. Failures are only logged, as the pool falls back to the
+// scan.
+func (evpool *Pool) savePruningPoint() {
+	height, t := evpool.NextPrune()
+	bz, err := orderedcode.Append(nil, height, t.UnixNano())
+	if err != nil {
+		evpool.logger.Error("failed to encode pruning point", "err", err)
+		return
+	}
+	if err := evpool.evidenceStore.SetSync(prefixToBytes(prefixPruning), bz); err != nil {
+		evpool.logger.Error("failed to save pruning point", "err", err)
+	}
+}
@@ -0,0 +1,202 @@
+package evidence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/google/orderedcode"
+	dbm "github.com/tendermint/tm-db"
+
+	"github.com/tendermint/tendermint/types"
+)
+
+// maxQuarantinedEvidence is the maximum number of quarantined evidence, so
+// that peers can't fill the store with evidence that can't be verified.
+const maxQuarantinedEvidence = 1000
+
+// RetryQuarantined verifies the quarantined evidence again against the current
+// state and adds the evidence that is now valid to the pending pool. Evidence
+// that still can't be verified stays quarantined and all other evidence is
+// discarded. It is called by Update after every block.
+func (evpool *Pool) RetryQuarantined() error {
+	type entry struct {
+		key   []byte
+		value []byte
+	}
+
+	if evpool.readOnly {
+		return ErrReadOnly
+	}
+
+	// collect the entries first, as the store can't be written while iterating
+	iter, err := dbm.IteratePrefix(evpool.evidenceStore, prefixToBytes(prefixQuarantine))
+	if err != nil {
+		return fmt.Errorf("database error: %v", err)
+	}
+	var entries []entry
+	for ; iter.Valid(); iter.Next() {
+		entries = append(entries, entry{
+			key:   append([]byte(nil), iter.Key()...),
+			value: append([]byte(nil), iter.Value()...),
+		})
+	}
+	err = iter.Error()
+	iter.Close()
+	if err != nil {
+		return err
+	}
+
+	var remaining uint32
+	for _, entry := range entries {
+		keep, err := evpool.retryQuarantined(entry.value)
+		if err != nil {
+			return err
+		}
+		if keep {
+			remaining++
+			continue
+		}
+		if err := evpool.evidenceStore.Delete(entry.key); err != nil {
+			return fmt.Errorf("failed to delete quarantined evidence: %w", err)
+		}
+	}
+	atomic.StoreUint32(&evpool.quarantineSize, remaining)
+
+	return nil
+}
+
+// retryQuarantined verifies the quarantined evidence again, adding it to the
+// pending pool if it is valid, and returns true if it stays quarantined.
+func (evpool *Pool) retryQuarantined(value []byte) (bool, error) {
+	ev, err := bytesToEv(value)
+	if err != nil {
+		evpool.logger.Error("discarding quarantined evidence that failed to decode", "err", err)
+		return false, nil
+	}
+
+	known, err := evpool.isKnown(ev)
+	if err != nil {
+		return true, err
+	}
+	if known {
+		return false, nil
+	}
+
+	err = evpool.verify(ev)
+	switch {
+	case evpool.isQuarantinable(ev, err):
+		return true, nil
+
+	case err != nil:
+		evpool.logger.Info("discarding quarantined evidence", append(evLogFields(ev), "err", err)...)
+		return false, nil
+	}
+
+	err = evpool.addEvidence(context.Background(), ev, false)
+	switch {
+	case errors.Is(err, ErrEvidencePoolFull):
+		return true, nil
+
+	case err != nil:
+		return true, fmt.Errorf("failed to add quarantined evidence: %w", err)
+	}
+	evpool.logger.Info("added quarantined evidence", evLogFields(ev)...)
+	return false, nil
+}
+
+// quarantine stores evidence that failed verification with err for
+// RetryQuarantined if isQuarantinable. It returns whether the evidence is
+// quarantined and the error to report. Evidence failing precheckQuarantined is
+// invalid and its error is returned instead.
+func (evpool *Pool) quarantine(ev types.Evidence, err error) (bool, error) {
+	if !evpool.isQuarantinable(ev, err) {
+		return false, err
+	}
+	if precheckErr := evpool.precheckQuarantined(ev); precheckErr != nil {
+		return false, types.NewErrInvalidEvidence(ev, precheckErr)
+	}
+	if atomic.LoadUint32(&evpool.quarantineSize) >= maxQuarantinedEvidence {
+		evpool.logger.Info("quarantine is full; dropping unverifiable evidence", evLogFields(ev)...)
+		return false, err
+	}
+
+	key := keyQuarantine(ev)
+	ok, hasErr := evpool.evidenceStore.Has(key)
+	if hasErr != nil {
+		return false, err
+	}
+	if ok {
+		return true, err
+	}
+	evpb, protoErr := types.EvidenceToProto(ev)
+	if protoErr != nil {
+		return false, err
+	}
+	evBytes, marshalErr := evpb.Marshal()
+	if marshalErr != nil {
+		return false, err
+	}
+	if setErr := evpool.evidenceStore.SetSync(key, evBytes); setErr != nil {
+		evpool.logger.Error("failed to quarantine evidence", append(evLogFields(ev), "err", setErr)...)
+		return false, err
+	}
+	atomic.AddUint32(&evpool.quarantineSize, 1)
+	evpool.logger.Info("quarantined evidence until it can be verified", evLogFields(ev)...)
+	return true, err
+}
+
+// precheckQuarantined checks what can be checked of the evidence before it is
+// quarantined: its basic validity and, for duplicate vote evidence whose
+// validator set can be loaded, the signatures and voting power of the votes.
+func (evpool *Pool) precheckQuarantined(ev types.Evidence) error {
+	if err := ev.ValidateBasic(); err != nil {
+		return err
+	}
+	dve, ok := ev.(*types.DuplicateVoteEvidence)
+	if !ok {
+		return nil
+	}
+	valSet, err := evpool.loadValidators(ev.Height())
+	if err != nil {
+		return nil
+	}
+	return VerifyDuplicateVote(dve, evpool.State().ChainID, valSet)
+}
+
+// isQuarantinable returns true if the evidence failed verification with err
+// because its validator set couldn't be loaded or its block isn't stored yet,
+// and it is recent enough to become verifiable, i.e. no more than
+// MaxAgeNumBlocks old or maxFutureEvidenceHeights ahead.
+func (evpool *Pool) isQuarantinable(ev types.Evidence, err error) bool {
+	state := evpool.State()
+	switch {
+	case errors.Is(err, ErrNoValidatorSetForHeight):
+		params := evpool.expiryParams(ev, state.ConsensusParams.Evidence)
+		return state.LastBlockHeight-ev.Height() <= params.MaxAgeNumBlocks
+	case errors.Is(err, ErrFutureEvidence):
+		return ev.Height() > state.LastBlockHeight &&
+			ev.Height() <= state.LastBlockHeight+maxFutureEvidenceHeights
+	default:
+		return false
+	}
+}
+
+// countQuarantined sets the number of quarantined evidence from the store.
+func (evpool *Pool) countQuarantined() error {
+	n, err := countKeys(evpool.evidenceStore, prefixQuarantine)
+	if err != nil {
+		return err
+	}
+	atomic.StoreUint32(&evpool.quarantineSize, n)
+	return nil
+}
+
+func keyQuarantine(evidence types.Evidence) []byte {
+	key, err := orderedcode.Append(nil, prefixQuarantine, evidence.Height(), string(evidence.Hash()))
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
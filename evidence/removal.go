@@ -0,0 +1,232 @@
+package evidence
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/google/orderedcode"
+
+	"github.com/tendermint/tendermint/types"
+)
+
+// RemovePendingAtHeight deletes all pending evidence for the given height,
+// for example after a chain upgrade retroactively changed which evidence is
+// valid. Entries at that height that can't be decoded are deleted as well. The
+// removals are recorded as manual. It returns the number of entries deleted.
+func (evpool *Pool) RemovePendingAtHeight(height int64) (int, error) {
+	if evpool.readOnly {
+		return 0, ErrReadOnly
+	}
+	if height <= 0 {
+		return 0, fmt.Errorf("invalid height %d", height)
+	}
+	start, err := orderedcode.Append(nil, prefixPending, height)
+	if err != nil {
+		return 0, err
+	}
+	end, err := orderedcode.Append(nil, prefixPending, height+1)
+	if err != nil {
+		return 0, err
+	}
+
+	// the evidence mustn't be committed or pruned while it's being removed
+	evpool.pruneMtx.Lock()
+	defer evpool.pruneMtx.Unlock()
+	evpool.mtx.Lock()
+	defer evpool.mtx.Unlock()
+
+	iter, err := evpool.evidenceStore.Iterator(start, end)
+	if err != nil {
+		return 0, fmt.Errorf("database error: %v", err)
+	}
+	defer iter.Close()
+
+	var (
+		batch   = evpool.evidenceStore.NewBatch()
+		removed = make(map[string]struct{})
+		deleted int
+		counted uint32
+		size    int64
+		hashes  [][]byte
+	)
+	defer batch.Close()
+
+	for ; iter.Valid(); iter.Next() {
+		// the iterator may reuse the key's buffer
+		key := append([]byte(nil), iter.Key()...)
+		if err := batch.Delete(key); err != nil {
+			return 0, err
+		}
+		deleted++
+		_, hash, err := parseEvidenceKey(key)
+		if err != nil {
+			evpool.logger.Error("found malformed pending evidence key", "key", key, "err", err)
+			continue
+		}
+		infoKey, err := orderedcode.Append(nil, prefixInfo, height, string(hash))
+		if err != nil {
+			return 0, err
+		}
+		if err := batch.Delete(infoKey); err != nil {
+			return 0, err
+		}
+		// the index may point to evidence stored under another key
+		indexed, err := evpool.evidenceStore.Get(keyHashIndex(hash))
+		if err != nil {
+			return 0, err
+		}
+		if bytes.Equal(indexed, key) {
+			if err := batch.Delete(keyHashIndex(hash)); err != nil {
+				return 0, err
+			}
+		}
+		if err := evpool.setTombstone(batch, height, hash, RemovalManual, evpool.state.LastBlockHeight); err != nil {
+			return 0, err
+		}
+		hashes = append(hashes, hash)
+
+		// only evidence that decodes and is stored under its own key was loaded
+		// into the pool and counted
+		if ev, err := bytesToEv(iter.Value()); err == nil && bytes.Equal(keyPending(ev), key) {
+			removed[evMapKey(ev)] = struct{}{}
+			counted++
+			size += evidenceBytes(ev)
+			evpool.accused.Remove(ev)
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return 0, fmt.Errorf("database error: %v", err)
+	}
+	if deleted == 0 {
+		return 0, nil
+	}
+
+	if err := batch.WriteSync(); err != nil {
+		return 0, fmt.Errorf("failed to remove pending evidence: %w", err)
+	}
+
+	evpool.removeEvidenceFromList(removed)
+	evpool.decrementSize(counted, size)
+	for _, hash := range hashes {
+		evpool.publishMutation(MutationRemoved, height, hash)
+	}
+	evpool.logger.Info("removed pending evidence", "height", height, "count", deleted)
+	return deleted, nil
+}
+
+// RemovePending deletes the given pending evidence, for example evidence an
+// operator determined to be spurious. The removal is recorded as manual. It
+// returns an error wrapping ErrNotPending if the evidence isn't pending.
+func (evpool *Pool) RemovePending(ev types.Evidence) error {
+	if evpool.readOnly {
+		return ErrReadOnly
+	}
+	if err := checkKeyable(ev); err != nil {
+		return err
+	}
+
+	evpool.pruneMtx.Lock()
+	defer evpool.pruneMtx.Unlock()
+	evpool.mtx.Lock()
+	defer evpool.mtx.Unlock()
+
+	ok, err := evpool.checkPending(ev)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: %X at height %d", ErrNotPending, ev.Hash(), ev.Height())
+	}
+
+	batch := evpool.evidenceStore.NewBatch()
+	defer batch.Close()
+
+	key := keyPending(ev)
+	if err := batch.Delete(key); err != nil {
+		return err
+	}
+	if err := batch.Delete(keyInfo(ev)); err != nil {
+		return err
+	}
+	// the index may point to evidence stored under another key
+	indexed, err := evpool.evidenceStore.Get(keyHashIndex(ev.Hash()))
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(indexed, key) {
+		if err := batch.Delete(keyHashIndex(ev.Hash())); err != nil {
+			return err
+		}
+	}
+	err = evpool.setTombstone(batch, ev.Height(), ev.Hash(), RemovalManual, evpool.state.LastBlockHeight)
+	if err != nil {
+		return err
+	}
+	if err := batch.WriteSync(); err != nil {
+		return fmt.Errorf("failed to remove pending evidence: %w", err)
+	}
+
+	evpool.removeEvidenceFromList(map[string]struct{}{evMapKey(ev): {}})
+	evpool.decrementSize(1, evidenceBytes(ev))
+	evpool.accused.Remove(ev)
+	evpool.publishMutation(MutationRemoved, ev.Height(), ev.Hash())
+	evpool.logger.Info("removed pending evidence", evLogFields(ev)...)
+	return nil
+}
+
+// RevalidatePending verifies all pending evidence again under the current
+// state, for example after a change of the evidence params, and removes the
+// evidence that has expired or become invalid. Evidence that can't be verified
+// without being invalid is kept. It returns the number of evidence removed.
+func (evpool *Pool) RevalidatePending() (removed int, err error) {
+	if evpool.readOnly {
+		return 0, ErrReadOnly
+	}
+
+	evpool.pruneMtx.Lock()
+	defer evpool.pruneMtx.Unlock()
+
+	evList, _, err := evpool.listEvidence(prefixPending, -1)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list pending evidence: %w", err)
+	}
+
+	height := evpool.State().LastBlockHeight
+	removedEvidence := make(map[string]struct{})
+	for _, ev := range evList {
+		if evpool.isExpired(ev) {
+			if !evpool.removePendingEvidence(ev, RemovalExpired) {
+				continue
+			}
+			evpool.metrics.ExpiredEvidence.Add(1)
+			evpool.publishMutation(MutationExpired, ev.Height(), ev.Hash())
+			evpool.publishEvent(TransitionExpired, ev, height)
+			removedEvidence[evMapKey(ev)] = struct{}{}
+			continue
+		}
+
+		verifyErr := evpool.verify(ev)
+		var invalidErr *types.ErrInvalidEvidence
+		if !errors.As(verifyErr, &invalidErr) {
+			if verifyErr != nil {
+				evpool.logger.Info("failed to verify pending evidence again; keeping it",
+					append(evLogFields(ev), "err", verifyErr)...)
+			}
+			continue
+		}
+		if !evpool.removePendingEvidence(ev, RemovalInvalid) {
+			continue
+		}
+		evpool.publishMutation(MutationRemoved, ev.Height(), ev.Hash())
+		evpool.publishEvent(TransitionRejected, ev, height)
+		removedEvidence[evMapKey(ev)] = struct{}{}
+		evpool.logger.Info("removed pending evidence that is no longer valid",
+			append(evLogFields(ev), "err", verifyErr)...)
+	}
+
+	if len(removedEvidence) != 0 {
+		evpool.removeEvidenceFromList(removedEvidence)
+	}
+	return len(removedEvidence), nil
+}
@@ -0,0 +1,110 @@
+package evidence
+
+import (
+	"fmt"
+
+	"github.com/google/orderedcode"
+	dbm "github.com/tendermint/tm-db"
+)
+
+// schemaVersion is the version of the layout of the evidence store written by
+// this version of the pool. Whenever the layout changes, it must be incremented
+// and a migration from the previous version added to schemaMigrations.
+const schemaVersion = int64(1)
+
+// schemaMigrations holds the migration of the evidence store to each schema
+// version from the version before it. A migration is given the store of the
+// pool, which is prefixed with the chain ID if WithChainIDPrefix is used.
+var schemaMigrations = map[int64]func(db dbm.DB) error{
+	// Version 1 introduced the version key without changing the layout.
+	1: func(dbm.DB) error { return nil },
+}
+
+// migrateStore checks the schema version of the evidence store and migrates
+// the store to schemaVersion, one version at a time. A store without a version
+// key is version 0, unless it holds no keys of the pool, in which case it is
+// new and just gets the current version. A store with a later version than
+// schemaVersion was written by a newer version of the pool and is rejected with
+// ErrUnsupportedSchemaVersion, as is a store that needs migrating in a
+// read-only pool.
+func (evpool *Pool) migrateStore() error {
+	version, err := evpool.loadSchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case version > schemaVersion:
+		return fmt.Errorf("%w: store has version %d, newer than %d", ErrUnsupportedSchemaVersion, version,
+			schemaVersion)
+	case version == schemaVersion:
+		return nil
+	case evpool.readOnly:
+		return fmt.Errorf("%w: store has version %d and needs migrating to %d", ErrUnsupportedSchemaVersion,
+			version, schemaVersion)
+	}
+
+	for version < schemaVersion {
+		version++
+		evpool.logger.Info("migrating evidence store", "version", version)
+		if err := schemaMigrations[version](evpool.evidenceStore); err != nil {
+			return fmt.Errorf("failed to migrate evidence store to version %d: %w", version, err)
+		}
+		if err := evpool.saveSchemaVersion(version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadSchemaVersion returns the schema version of the evidence store. A new
+// store, as opposed to a store written before the version key existed, is
+// reported as schemaVersion and gets the version key unless the pool is
+// read-only.
+func (evpool *Pool) loadSchemaVersion() (int64, error) {
+	bz, err := evpool.evidenceStore.Get(prefixToBytes(prefixVersion))
+	if err != nil {
+		return 0, fmt.Errorf("failed to load schema version: %w", err)
+	}
+	if bz != nil {
+		var version int64
+		if _, err := orderedcode.Parse(string(bz), &version); err != nil {
+			return 0, fmt.Errorf("failed to decode schema version: %w", err)
+		}
+		return version, nil
+	}
+
+	for _, prefix := range poolPrefixes {
+		iter, err := dbm.IteratePrefix(evpool.evidenceStore, prefixToBytes(prefix))
+		if err != nil {
+			return 0, fmt.Errorf("database error: %v", err)
+		}
+		found := iter.Valid()
+		err = iter.Error()
+		iter.Close()
+		if err != nil {
+			return 0, fmt.Errorf("database error: %v", err)
+		}
+		if found {
+			return 0, nil
+		}
+	}
+	if !evpool.readOnly {
+		if err := evpool.saveSchemaVersion(schemaVersion); err != nil {
+			return 0, err
+		}
+	}
+	return schemaVersion, nil
+}
+
+// saveSchemaVersion persists the schema version of the evidence store.
+func (evpool *Pool) saveSchemaVersion(version int64) error {
+	bz, err := orderedcode.Append(nil, version)
+	if err != nil {
+		return fmt.Errorf("failed to encode schema version: %w", err)
+	}
+	if err := evpool.evidenceStore.SetSync(prefixToBytes(prefixVersion), bz); err != nil {
+		return fmt.Errorf("failed to save schema version: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package evidence_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/orderedcode"
+	"github.com/stretchr/testify/require"
+
+	dbm "github.com/tendermint/tm-db"
+
+	"github.com/tendermint/tendermint/evidence"
+	"github.com/tendermint/tendermint/libs/log"
+	"github.com/tendermint/tendermint/types"
+)
+
+func TestSchemaMigration(t *testing.T) {
+	var height int64 = 10
+	val := types.NewMockPV()
+	evidenceDB := dbm.NewMemDB()
+	versionKey, err := orderedcode.Append(nil, int64(20))
+	require.NoError(t, err)
+	requireVersion := func(expected int64) {
+		bz, err := evidenceDB.Get(versionKey)
+		require.NoError(t, err)
+		var version int64
+		_, err = orderedcode.Parse(string(bz), &version)
+		require.NoError(t, err)
+		require.Equal(t, expected, version)
+	}
+
+	var migrations int
+	migrationErr := errors.New("migration failed")
+	var fail bool
+	defer evidence.SetSchemaMigration(evidence.SchemaVersion, func(db dbm.DB) error {
+		migrations++
+		if fail {
+			return migrationErr
+		}
+		return nil
+	})()
+
+	// a new store gets the current version without migrating
+	pool := newTestPool(t, height, val, evidenceDB)
+	requireVersion(evidence.SchemaVersion)
+	require.Zero(t, migrations)
+	ev := newTestDuplicateVoteEvidence(height, val)
+	require.NoError(t, pool.AddEvidence(ev))
+	require.NoError(t, pool.Close())
+
+	// a store written before the version key existed is migrated
+	require.NoError(t, evidenceDB.Delete(versionKey))
+	_, err = evidence.NewPoolReadOnly(log.TestingLogger(), evidenceDB)
+	require.True(t, errors.Is(err, evidence.ErrUnsupportedSchemaVersion), err)
+	fail = true
+	_, err = evidence.NewPool(log.TestingLogger(), evidenceDB, initializeValidatorState(t, val, height),
+		initializeBlockStore(dbm.NewMemDB(), pool.State(), val.PrivKey.PubKey().Address()))
+	require.True(t, errors.Is(err, migrationErr), err)
+	require.Equal(t, 1, migrations)
+	has, err := evidenceDB.Has(versionKey)
+	require.NoError(t, err)
+	require.False(t, has)
+
+	fail = false
+	pool = newTestPool(t, height, val, evidenceDB)
+	require.Equal(t, 2, migrations)
+	requireVersion(evidence.SchemaVersion)
+	require.EqualValues(t, 1, pool.Size())
+	require.NoError(t, pool.Close())
+
+	// once migrated, the store isn't migrated again
+	pool = newTestPool(t, height, val, evidenceDB)
+	require.Equal(t, 2, migrations)
+	require.NoError(t, pool.Close())
+
+	// a store written by a newer version is rejected
+	newer, err := orderedcode.Append(nil, evidence.SchemaVersion+1)
+	require.NoError(t, err)
+	require.NoError(t, evidenceDB.Set(versionKey, newer))
+	_, err = evidence.NewPool(log.TestingLogger(), evidenceDB, initializeValidatorState(t, val, height),
+		initializeBlockStore(dbm.NewMemDB(), pool.State(), val.PrivKey.PubKey().Address()))
+	require.True(t, errors.Is(err, evidence.ErrUnsupportedSchemaVersion), err)
+	_, err = evidence.NewPoolReadOnly(log.TestingLogger(), evidenceDB)
+	require.True(t, errors.Is(err, evidence.ErrUnsupportedSchemaVersion), err)
+	requireVersion(evidence.SchemaVersion + 1)
+	require.Equal(t, 2, migrations)
+}
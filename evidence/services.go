@@ -1,6 +1,7 @@
 package evidence
 
 import (
+	sm "github.com/tendermint/tendermint/state"
 	"github.com/tendermint/tendermint/types"
 )
 
@@ -10,3 +11,29 @@ type BlockStore interface {
 	LoadBlockMeta(height int64) *types.BlockMeta
 	LoadBlockCommit(height int64) *types.Commit
 }
+
+// baser is implemented by block stores which may prune blocks. Base returns
+// the height of the earliest retained block, or 0 if the store is empty.
+type baser interface {
+	Base() int64
+}
+
+// blockLoader is implemented by block stores which can load entire blocks,
+// see WithBlockStoreCommittedLookup.
+type blockLoader interface {
+	LoadBlock(height int64) *types.Block
+}
+
+// ValidatorSetProvider provides the validator set at a given height. The state
+// store satisfies this interface.
+type ValidatorSetProvider interface {
+	LoadValidators(height int64) (*types.ValidatorSet, error)
+}
+
+// Verifier verifies evidence against the given state before it is accepted by
+// the pool. Errors are returned to the caller of AddEvidence or CheckEvidence
+// as they are, so a Verifier should return a *types.ErrInvalidEvidence for
+// evidence that is invalid, as opposed to evidence that can't be verified yet.
+type Verifier interface {
+	Verify(ev types.Evidence, state sm.State) error
+}
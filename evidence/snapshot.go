@@ -0,0 +1,212 @@
+package evidence
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	dbm "github.com/tendermint/tm-db"
+
+	sm "github.com/tendermint/tendermint/state"
+	"github.com/tendermint/tendermint/types"
+)
+
+// PoolSnapshot is an opaque, in-memory capture of the entire pool created by
+// Snapshot and consumed by Restore.
+type PoolSnapshot struct {
+	entries         []snapshotEntry
+	evidenceList    []types.Evidence
+	evidenceSize    uint32
+	pendingBytes    int64
+	state           sm.State
+	consensusBuffer []duplicateVoteSet
+	unpersisted     map[string]types.Evidence
+	pruningHeight   int64
+	pruningTime     time.Time
+	expiryTime      time.Time
+}
+
+type snapshotEntry struct {
+	key   []byte
+	value []byte
+}
+
+// Snapshot captures the pending and committed evidence as well as the
+// in-memory state of the pool so that it can later be returned to exactly this
+// point with Restore. It is intended as an aid for tests and simulations and
+// must not be called concurrently with other pool operations.
+func (evpool *Pool) Snapshot() (PoolSnapshot, error) {
+	evpool.unpersistedMtx.Lock()
+	defer evpool.unpersistedMtx.Unlock()
+	evpool.mtx.RLock()
+	defer evpool.mtx.RUnlock()
+
+	snapshot := PoolSnapshot{
+		evidenceSize:    evpool.Size(),
+		pendingBytes:    evpool.PendingBytes(),
+		state:           evpool.state.Copy(),
+		consensusBuffer: append([]duplicateVoteSet(nil), evpool.consensusBuffer...),
+		unpersisted:     copyEvidenceMap(evpool.unpersisted),
+		expiryTime:      evpool.expiryTime,
+	}
+	snapshot.pruningHeight, snapshot.pruningTime = evpool.NextPrune()
+
+	for e := evpool.evidenceList.Front(); e != nil; e = e.Next() {
+		snapshot.evidenceList = append(snapshot.evidenceList, e.Value.(types.Evidence))
+	}
+
+	for _, prefix := range poolPrefixes {
+		iter, err := dbm.IteratePrefix(evpool.evidenceStore, prefixToBytes(prefix))
+		if err != nil {
+			return PoolSnapshot{}, fmt.Errorf("database error: %v", err)
+		}
+
+		for ; iter.Valid(); iter.Next() {
+			snapshot.entries = append(snapshot.entries, snapshotEntry{
+				key:   append([]byte(nil), iter.Key()...),
+				value: append([]byte(nil), iter.Value()...),
+			})
+		}
+
+		err = iter.Error()
+		iter.Close()
+		if err != nil {
+			return PoolSnapshot{}, err
+		}
+	}
+
+	return snapshot, nil
+}
+
+// Restore returns the pool to the point at which the snapshot was taken,
+// discarding any evidence stored since. Like Snapshot, it is intended for tests
+// and simulations and must not be called concurrently with other pool
+// operations.
+func (evpool *Pool) Restore(snapshot PoolSnapshot) error {
+	if evpool.readOnly {
+		return ErrReadOnly
+	}
+	evpool.unpersistedMtx.Lock()
+	defer evpool.unpersistedMtx.Unlock()
+	evpool.mtx.Lock()
+	defer evpool.mtx.Unlock()
+
+	batch := evpool.evidenceStore.NewBatch()
+	defer batch.Close()
+
+	if err := evpool.deletePoolKeys(batch); err != nil {
+		return err
+	}
+	for _, entry := range snapshot.entries {
+		if err := batch.Set(entry.key, entry.value); err != nil {
+			return err
+		}
+	}
+
+	if err := batch.WriteSync(); err != nil {
+		return fmt.Errorf("failed to restore evidence: %w", err)
+	}
+
+	evpool.clearEvidenceList()
+	for _, ev := range snapshot.evidenceList {
+		evpool.evidenceList.PushBack(ev)
+	}
+
+	atomic.StoreUint32(&evpool.evidenceSize, snapshot.evidenceSize)
+	atomic.StoreInt64(&evpool.pendingBytes, snapshot.pendingBytes)
+	evpool.metrics.Size.Set(float64(snapshot.evidenceSize))
+	evpool.updatePressure()
+	evpool.accused.Reset(snapshot.evidenceList)
+	if err := evpool.countQuarantined(); err != nil {
+		return err
+	}
+	evpool.state = snapshot.state.Copy()
+	// the state store may have been rewound along with the pool
+	evpool.valSetCache.Reset()
+	evpool.committedLookups.Reset()
+	evpool.consensusBuffer = append([]duplicateVoteSet(nil), snapshot.consensusBuffer...)
+	evpool.metrics.ConsensusBufferSize.Set(float64(len(evpool.consensusBuffer)))
+	evpool.unpersisted = copyEvidenceMap(snapshot.unpersisted)
+	evpool.setPruningPoint(snapshot.pruningHeight, snapshot.pruningTime)
+	evpool.resetCommittedCount()
+	evpool.expiryTime = snapshot.expiryTime
+
+	return nil
+}
+
+// Reset deletes everything the pool stored and empties the pending evidence and
+// the consensus buffer, keeping the state. Like Restore, it must not be called
+// concurrently with other pool operations.
+func (evpool *Pool) Reset() error {
+	if evpool.readOnly {
+		return ErrReadOnly
+	}
+	evpool.unpersistedMtx.Lock()
+	evpool.unpersisted = nil
+	evpool.unpersistedMtx.Unlock()
+
+	evpool.mtx.Lock()
+	defer evpool.mtx.Unlock()
+
+	batch := evpool.evidenceStore.NewBatch()
+	defer batch.Close()
+
+	if err := evpool.deletePoolKeys(batch); err != nil {
+		return err
+	}
+	if err := batch.WriteSync(); err != nil {
+		return fmt.Errorf("failed to reset evidence: %w", err)
+	}
+
+	evpool.clearEvidenceList()
+	atomic.StoreUint32(&evpool.evidenceSize, 0)
+	atomic.StoreInt64(&evpool.pendingBytes, 0)
+	evpool.metrics.Size.Set(0)
+	evpool.updatePressure()
+	evpool.accused.Reset(nil)
+	atomic.StoreUint32(&evpool.quarantineSize, 0)
+	evpool.consensusBuffer = make([]duplicateVoteSet, 0)
+	evpool.metrics.ConsensusBufferSize.Set(0)
+	evpool.setPruningPoint(0, time.Time{})
+	evpool.resetCommittedCount()
+
+	return nil
+}
+
+// copyEvidenceMap returns a copy of the map of evidence by evMapKey, or nil if
+// it's empty.
+func copyEvidenceMap(evidence map[string]types.Evidence) map[string]types.Evidence {
+	if len(evidence) == 0 {
+		return nil
+	}
+	evCopy := make(map[string]types.Evidence, len(evidence))
+	for key, ev := range evidence {
+		evCopy[key] = ev
+	}
+	return evCopy
+}
+
+// deletePoolKeys adds the deletion of all keys under the pool's prefixes to
+// the batch.
+func (evpool *Pool) deletePoolKeys(batch dbm.Batch) error {
+	for _, prefix := range poolPrefixes {
+		iter, err := dbm.IteratePrefix(evpool.evidenceStore, prefixToBytes(prefix))
+		if err != nil {
+			return fmt.Errorf("database error: %v", err)
+		}
+
+		for ; iter.Valid(); iter.Next() {
+			if err := batch.Delete(iter.Key()); err != nil {
+				iter.Close()
+				return err
+			}
+		}
+
+		err = iter.Error()
+		iter.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package evidence
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/google/orderedcode"
+	dbm "github.com/tendermint/tm-db"
+)
+
+// storeRetryInterval is how long the pool waits before retrying a write to a
+// temporarily unavailable evidence store.
+const storeRetryInterval = 10 * time.Millisecond
+
+// openStores are the evidence stores of the pools that are open in this
+// process, along with the chain ID prefixes of those pools, see NewPool.
+var (
+	openStoresMtx sync.Mutex
+	openStores    = make(map[dbm.DB]map[string]struct{})
+)
+
+// withStoreRetry calls fn until it succeeds, fails with an error that is not
+// temporary, the store retry timeout has elapsed on the pool clock or ctx is
+// done.
+func (evpool *Pool) withStoreRetry(ctx context.Context, fn func() error) error {
+	err := fn()
+	if evpool.storeRetryTimeout <= 0 || !isTemporary(err) {
+		return err
+	}
+
+	deadline := evpool.now().Add(evpool.storeRetryTimeout)
+	for isTemporary(err) {
+		if evpool.now().Add(storeRetryInterval).After(deadline) {
+			return fmt.Errorf("%w after %v: %v", ErrStoreUnavailable, evpool.storeRetryTimeout, err)
+		}
+		evpool.logger.Debug("evidence store temporarily unavailable; retrying", "err", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(storeRetryInterval):
+		}
+		err = fn()
+	}
+	return err
+}
+
+// acquireStore registers the evidence store as used by an open pool with the
+// given chain ID prefix. It returns ErrPoolAlreadyOpen if a pool with the same
+// prefix is open on the store, or if a pool without a prefix would share the
+// store with any other pool. Stores whose type can't be used as a map key,
+// which no store in tm-db is, can't be registered and are always accepted.
+func acquireStore(db dbm.DB, chainID string) error {
+	if !reflect.TypeOf(db).Comparable() {
+		return nil
+	}
+
+	openStoresMtx.Lock()
+	defer openStoresMtx.Unlock()
+	chainIDs := openStores[db]
+	if _, ok := chainIDs[chainID]; ok {
+		return ErrPoolAlreadyOpen
+	}
+	if _, ok := chainIDs[""]; ok || chainID == "" && len(chainIDs) > 0 {
+		return fmt.Errorf("%w: pools with and without a chain ID prefix can't share it", ErrPoolAlreadyOpen)
+	}
+	if chainIDs == nil {
+		chainIDs = make(map[string]struct{})
+		openStores[db] = chainIDs
+	}
+	chainIDs[chainID] = struct{}{}
+	return nil
+}
+
+// releaseStore removes the evidence store from the stores used by open pools.
+func releaseStore(db dbm.DB, chainID string) {
+	if !reflect.TypeOf(db).Comparable() {
+		return
+	}
+
+	openStoresMtx.Lock()
+	defer openStoresMtx.Unlock()
+	delete(openStores[db], chainID)
+	if len(openStores[db]) == 0 {
+		delete(openStores, db)
+	}
+}
+
+// keyChain returns the prefix of all keys written by a pool with the given
+// chain ID prefix.
+func keyChain(chainID string) []byte {
+	key, err := orderedcode.Append(nil, prefixChain, chainID)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// moveUnprefixedKeys moves all keys under the pool's prefixes in the store,
+// and its schema version, under the namespace of a chain, in a single batch.
+// These are the keys written before the pool was given a chain ID prefix. It
+// must only be called once the store is acquired, so that no pool without a
+// prefix is using the keys.
+func moveUnprefixedKeys(db dbm.DB, namespace []byte) error {
+	batch := db.NewBatch()
+	defer batch.Close()
+
+	var moved int
+	for _, prefix := range append([]int64{prefixVersion}, poolPrefixes...) {
+		iter, err := dbm.IteratePrefix(db, prefixToBytes(prefix))
+		if err != nil {
+			return fmt.Errorf("failed to iterate over evidence store: %w", err)
+		}
+		for ; iter.Valid(); iter.Next() {
+			key := append(append([]byte(nil), namespace...), iter.Key()...)
+			if err := batch.Set(key, iter.Value()); err != nil {
+				iter.Close()
+				return err
+			}
+			if err := batch.Delete(iter.Key()); err != nil {
+				iter.Close()
+				return err
+			}
+			moved++
+		}
+		err = iter.Error()
+		iter.Close()
+		if err != nil {
+			return fmt.Errorf("failed to iterate over evidence store: %w", err)
+		}
+	}
+
+	if moved == 0 {
+		return nil
+	}
+	if err := batch.WriteSync(); err != nil {
+		return fmt.Errorf("failed to move evidence under chain ID prefix: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package evidence
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/google/orderedcode"
+	dbm "github.com/tendermint/tm-db"
+)
+
+// defaultTombstoneRetention is the number of blocks for which the pool keeps a
+// record of why pending evidence was removed.
+const defaultTombstoneRetention = 1000
+
+// RemovalReason is the reason evidence was removed from the pending pool.
+type RemovalReason int64
+
+const (
+	// RemovalCommitted means the evidence was committed in a block.
+	RemovalCommitted RemovalReason = iota + 1
+	// RemovalExpired means the evidence was pruned because it expired.
+	RemovalExpired
+	// RemovalManual means the evidence was removed by an operator, for example
+	// through RemoveCorruptEvidence, RemovePending or RemovePendingAtHeight.
+	RemovalManual
+	// RemovalEvicted means the evidence was evicted from the full pool to make
+	// room for new evidence, see WithEvictionPolicy.
+	RemovalEvicted
+	// RemovalInvalid means the evidence was found to be invalid when it was
+	// verified again by RevalidatePending.
+	RemovalInvalid
+)
+
+func (r RemovalReason) String() string {
+	switch r {
+	case RemovalCommitted:
+		return "committed"
+	case RemovalExpired:
+		return "expired"
+	case RemovalManual:
+		return "manual"
+	case RemovalEvicted:
+		return "evicted"
+	case RemovalInvalid:
+		return "invalid"
+	default:
+		return fmt.Sprintf("RemovalReason(%d)", int64(r))
+	}
+}
+
+// RemovalRecord describes why and when evidence was removed from the pending
+// pool.
+type RemovalRecord struct {
+	Reason RemovalReason
+	// EvidenceHeight is the height of the evidence itself.
+	EvidenceHeight int64
+	// Height is the last block height of the pool when the evidence was
+	// removed and Time the time of the removal according to the pool's clock.
+	Height int64
+	Time   time.Time
+}
+
+// RemovalInfo returns the record of why the pending evidence with the given
+// hash was removed, see WithTombstoneRetention. It scans all retained records.
+func (evpool *Pool) RemovalInfo(hash []byte) (RemovalRecord, bool) {
+	iter, err := dbm.IteratePrefix(evpool.evidenceStore, prefixToBytes(prefixTombstone))
+	if err != nil {
+		evpool.logger.Error("failed to iterate over removal records", "err", err)
+		return RemovalRecord{}, false
+	}
+	defer iter.Close()
+
+	var (
+		record RemovalRecord
+		found  bool
+	)
+	for ; iter.Valid(); iter.Next() {
+		height, keyHash, err := parseEvidenceKey(iter.Key())
+		if err != nil || !bytes.Equal(keyHash, hash) {
+			continue
+		}
+		// later records supersede earlier ones
+		record, err = bytesToRemovalRecord(height, iter.Value())
+		if err != nil {
+			evpool.logger.Error("failed to decode removal record", "key", iter.Key(), "err", err)
+			continue
+		}
+		found = true
+	}
+	if err := iter.Error(); err != nil {
+		evpool.logger.Error("failed to iterate over removal records", "err", err)
+	}
+
+	return record, found
+}
+
+// setTombstone adds a record of the removal of the evidence with the given
+// height and hash to the batch.
+func (evpool *Pool) setTombstone(
+	batch dbm.Batch,
+	evHeight int64,
+	hash []byte,
+	reason RemovalReason,
+	removalHeight int64,
+) error {
+	key, err := orderedcode.Append(nil, prefixTombstone, removalHeight, string(hash))
+	if err != nil {
+		return err
+	}
+	value, err := orderedcode.Append(nil, int64(reason), evHeight, evpool.now().UnixNano())
+	if err != nil {
+		return err
+	}
+	return batch.Set(key, value)
+}
+
+// pruneTombstones deletes all removal records from before the tombstone
+// retention period.
+func (evpool *Pool) pruneTombstones(height int64) {
+	cutoff := height - evpool.tombstoneRetention
+	if cutoff <= 0 {
+		return
+	}
+
+	end, err := orderedcode.Append(nil, prefixTombstone, cutoff)
+	if err != nil {
+		panic(err)
+	}
+	iter, err := evpool.evidenceStore.Iterator(prefixToBytes(prefixTombstone), end)
+	if err != nil {
+		evpool.logger.Error("failed to iterate over removal records", "err", err)
+		return
+	}
+	defer iter.Close()
+
+	batch := evpool.evidenceStore.NewBatch()
+	defer batch.Close()
+	for ; iter.Valid(); iter.Next() {
+		if err := batch.Delete(iter.Key()); err != nil {
+			evpool.logger.Error("failed to prune removal records", "err", err)
+			return
+		}
+	}
+	if err := iter.Error(); err != nil {
+		evpool.logger.Error("failed to iterate over removal records", "err", err)
+		return
+	}
+	if err := batch.Write(); err != nil {
+		evpool.logger.Error("failed to prune removal records", "err", err)
+	}
+}
+
+func bytesToRemovalRecord(removalHeight int64, bz []byte) (RemovalRecord, error) {
+	var reason, evHeight, nanos int64
+	if _, err := orderedcode.Parse(string(bz), &reason, &evHeight, &nanos); err != nil {
+		return RemovalRecord{}, fmt.Errorf("failed to decode removal record: %w", err)
+	}
+	return RemovalRecord{
+		Reason:         RemovalReason(reason),
+		EvidenceHeight: evHeight,
+		Height:         removalHeight,
+		Time:           time.Unix(0, nanos).UTC(),
+	}, nil
+}
@@ -8,10 +8,58 @@ import (
 	"time"
 
 	"github.com/tendermint/tendermint/light"
+	sm "github.com/tendermint/tendermint/state"
 	"github.com/tendermint/tendermint/types"
 )
 
-// verify verifies the evidence fully by checking:
+// maxEvidenceTimeSkew is how far the time of evidence from a committed height
+// may be ahead of the last block time before it is rejected with
+// ErrFutureEvidence.
+const maxEvidenceTimeSkew = 5 * time.Second
+
+// maxFutureEvidenceHeights is the number of heights after the last block height
+// from which evidence is still verified. The state store holds the validator
+// sets up to two heights ahead, and a peer that is ahead may gossip evidence
+// from them. Evidence from later heights is rejected with ErrFutureEvidence.
+const maxFutureEvidenceHeights = 2
+
+// verify verifies the evidence against the current state, using the verifier
+// set with WithVerifier if any and verifyWithState otherwise, limited by
+// WithVerificationConcurrency.
+func (evpool *Pool) verify(evidence types.Evidence) error {
+	state := evpool.State()
+	if err := checkNotFuture(evidence, state); err != nil {
+		return err
+	}
+
+	if evpool.verificationSem != nil {
+		evpool.verificationSem <- struct{}{}
+		defer func() { <-evpool.verificationSem }()
+	}
+
+	if evpool.verifier != nil {
+		return evpool.verifier.Verify(evidence, state)
+	}
+	return evpool.verifyWithState(evidence, state)
+}
+
+// checkNotFuture returns an error wrapping ErrFutureEvidence if the evidence is
+// more than maxFutureEvidenceHeights ahead of the last block, or at a committed
+// height but more than maxEvidenceTimeSkew after the last block time.
+func checkNotFuture(evidence types.Evidence, state sm.State) error {
+	if evidence.Height() > state.LastBlockHeight+maxFutureEvidenceHeights {
+		return fmt.Errorf("evidence from height %d is ahead of the last block height %d: %w",
+			evidence.Height(), state.LastBlockHeight, ErrFutureEvidence)
+	}
+	if evidence.Height() <= state.LastBlockHeight &&
+		evidence.Time().After(state.LastBlockTime.Add(maxEvidenceTimeSkew)) {
+		return fmt.Errorf("evidence time %v is ahead of the last block time %v: %w",
+			evidence.Time(), state.LastBlockTime, ErrFutureEvidence)
+	}
+	return nil
+}
+
+// verifyWithState verifies the evidence fully by checking:
 // - It has not already been committed
 // - it is sufficiently recent (MaxAge)
 // - it is from a key who was a validator at the given height
@@ -22,12 +70,12 @@ import (
 // set for. In these cases, we do not return a ErrInvalidEvidence as not to have
 // the sending peer disconnect. All other errors are treated as invalid evidence
 // (i.e. ErrInvalidEvidence).
-func (evpool *Pool) verify(evidence types.Evidence) error {
+func (evpool *Pool) verifyWithState(evidence types.Evidence, state sm.State) error {
 	var (
-		state          = evpool.State()
 		height         = state.LastBlockHeight
-		evidenceParams = state.ConsensusParams.Evidence
-		ageNumBlocks   = height - evidence.Height()
+		evidenceParams = evpool.expiryParams(evidence, state.ConsensusParams.Evidence)
+		expiryHeight   = evpool.expiryHeight(evidence)
+		ageNumBlocks   = height - expiryHeight
 	)
 
 	// ensure we have the block for the evidence height
@@ -36,8 +84,17 @@ func (evpool *Pool) verify(evidence types.Evidence) error {
 	// able to process because we're too far behind (e.g. syncing), so we DO NOT
 	// return an invalid evidence error because we do not want the peer to
 	// disconnect or signal an error in this particular case.
+	if store, ok := evpool.blockStore.(baser); ok {
+		if base := store.Base(); evidence.Height() < base {
+			return fmt.Errorf("failed to verify evidence from height %d; earliest retained block is %d: %w",
+				evidence.Height(), base, ErrBelowRetainedHeight)
+		}
+	}
 	blockMeta := evpool.blockStore.LoadBlockMeta(evidence.Height())
 	if blockMeta == nil {
+		if evidence.Height() > state.LastBlockHeight {
+			return fmt.Errorf("block at height %d isn't stored yet: %w", evidence.Height(), ErrFutureEvidence)
+		}
 		return fmt.Errorf("failed to verify evidence; missing block for height %d", evidence.Height())
 	}
 
@@ -59,20 +116,20 @@ func (evpool *Pool) verify(evidence types.Evidence) error {
 	if ageDuration > evidenceParams.MaxAgeDuration && ageNumBlocks > evidenceParams.MaxAgeNumBlocks {
 		return types.NewErrInvalidEvidence(
 			evidence,
-			fmt.Errorf(
+			expiredError{fmt.Errorf(
 				"evidence from height %d (created at: %v) is too old; min height is %d and evidence can not be older than %v",
-				evidence.Height(),
+				expiryHeight,
 				evTime,
 				height-evidenceParams.MaxAgeNumBlocks,
 				state.LastBlockTime.Add(evidenceParams.MaxAgeDuration),
-			),
+			)},
 		)
 	}
 
 	// apply the evidence-specific verification logic
 	switch ev := evidence.(type) {
 	case *types.DuplicateVoteEvidence:
-		valSet, err := evpool.stateDB.LoadValidators(evidence.Height())
+		valSet, err := evpool.loadValidators(evidence.Height())
 		if err != nil {
 			return err
 		}
@@ -89,7 +146,7 @@ func (evpool *Pool) verify(evidence types.Evidence) error {
 			return err
 		}
 
-		commonVals, err := evpool.stateDB.LoadValidators(evidence.Height())
+		commonVals, err := evpool.loadValidators(evidence.Height())
 		if err != nil {
 			return err
 		}
@@ -110,7 +167,7 @@ func (evpool *Pool) verify(evidence types.Evidence) error {
 			trustedHeader,
 			commonVals,
 			state.LastBlockTime,
-			state.ConsensusParams.Evidence.MaxAgeDuration,
+			evidenceParams.MaxAgeDuration,
 		)
 		if err != nil {
 			return types.NewErrInvalidEvidence(evidence, err)
@@ -272,15 +329,53 @@ func VerifyDuplicateVote(e *types.DuplicateVoteEvidence, chainID string, valSet
 	vb := e.VoteB.ToProto()
 	// Signatures must be valid
 	if !pubKey.VerifySignature(types.VoteSignBytes(chainID, va), e.VoteA.Signature) {
-		return fmt.Errorf("verifying VoteA: %w", types.ErrVoteInvalidSignature)
+		return fmt.Errorf("verifying VoteA: %w", ErrInvalidSignature)
 	}
 	if !pubKey.VerifySignature(types.VoteSignBytes(chainID, vb), e.VoteB.Signature) {
-		return fmt.Errorf("verifying VoteB: %w", types.ErrVoteInvalidSignature)
+		return fmt.Errorf("verifying VoteB: %w", ErrInvalidSignature)
 	}
 
 	return nil
 }
 
+// loadValidators loads the validator set at the given height from the state
+// store and, if set, the secondary provider, which must agree. Loaded sets are
+// cached. An error wrapping ErrNoValidatorSetForHeight is returned if the state
+// store doesn't have the set.
+func (evpool *Pool) loadValidators(height int64) (*types.ValidatorSet, error) {
+	if valSet, ok := evpool.valSetCache.Get(height); ok {
+		return valSet, nil
+	}
+
+	valSet, err := evpool.stateDB.LoadValidators(height)
+	if err != nil {
+		return nil, fmt.Errorf("%w %d: %v", ErrNoValidatorSetForHeight, height, err)
+	}
+
+	if evpool.secondaryValidators == nil {
+		evpool.valSetCache.Add(height, valSet)
+		return valSet, nil
+	}
+
+	secondaryValSet, err := evpool.secondaryValidators.LoadValidators(height)
+	if err != nil {
+		return nil, fmt.Errorf("secondary validator set provider unavailable at height %d: %w", height, err)
+	}
+
+	if !bytes.Equal(valSet.Hash(), secondaryValSet.Hash()) {
+		evpool.logger.Error(
+			"validator set from state store does not match secondary provider; rejecting evidence",
+			"height", height,
+			"state_vals_hash", valSet.Hash(),
+			"secondary_vals_hash", secondaryValSet.Hash(),
+		)
+		return nil, fmt.Errorf("%w at height %d", ErrValidatorSetMismatch, height)
+	}
+
+	evpool.valSetCache.Add(height, valSet)
+	return valSet, nil
+}
+
 func getSignedHeader(blockStore BlockStore, height int64) (*types.SignedHeader, error) {
 	blockMeta := blockStore.LoadBlockMeta(height)
 	if blockMeta == nil {
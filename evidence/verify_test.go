@@ -1,9 +1,15 @@
 package evidence_test
 
 import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/google/orderedcode"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -17,6 +23,7 @@ import (
 	tmproto "github.com/tendermint/tendermint/proto/tendermint/types"
 	sm "github.com/tendermint/tendermint/state"
 	smmocks "github.com/tendermint/tendermint/state/mocks"
+	"github.com/tendermint/tendermint/store"
 	"github.com/tendermint/tendermint/types"
 	"github.com/tendermint/tendermint/version"
 )
@@ -126,6 +133,486 @@ func TestVerifyLightClientAttack_Lunatic(t *testing.T) {
 
 }
 
+func TestLightClientAttackExpiryBasis(t *testing.T) {
+	const (
+		commonHeight      int64 = 4
+		conflictingHeight int64 = 10
+	)
+
+	commonVals, commonPrivVals := types.RandValidatorSet(2, 10)
+	newVal, newPrivVal := types.RandValidator(false, 9)
+	conflictingVals, err := types.ValidatorSetFromExistingValidators(append(commonVals.Validators, newVal))
+	require.NoError(t, err)
+	conflictingPrivVals := append(commonPrivVals, newPrivVal)
+
+	commonHeader := makeHeaderRandom(commonHeight)
+	commonHeader.Time = defaultEvidenceTime
+	trustedHeader := makeHeaderRandom(conflictingHeight)
+	conflictingHeader := makeHeaderRandom(conflictingHeight)
+	conflictingHeader.Time = defaultEvidenceTime.Add(1 * time.Hour)
+	conflictingHeader.ValidatorsHash = conflictingVals.Hash()
+
+	blockID := makeBlockID(conflictingHeader.Hash(), 1000, []byte("partshash"))
+	voteSet := types.NewVoteSet(evidenceChainID, conflictingHeight, 1, tmproto.SignedMsgType(2), conflictingVals)
+	commit, err := types.MakeCommit(blockID, conflictingHeight, 1, voteSet, conflictingPrivVals, defaultEvidenceTime)
+	require.NoError(t, err)
+
+	trustedBlockID := makeBlockID(trustedHeader.Hash(), 1000, []byte("partshash"))
+	vals, privVals := types.RandValidatorSet(3, 8)
+	trustedVoteSet := types.NewVoteSet(evidenceChainID, conflictingHeight, 1, tmproto.SignedMsgType(2), vals)
+	trustedCommit, err := types.MakeCommit(trustedBlockID, conflictingHeight, 1, trustedVoteSet, privVals,
+		defaultEvidenceTime)
+	require.NoError(t, err)
+
+	// a lunatic attack where the common and conflicting heights differ
+	ev := &types.LightClientAttackEvidence{
+		ConflictingBlock: &types.LightBlock{
+			SignedHeader: &types.SignedHeader{
+				Header: conflictingHeader,
+				Commit: commit,
+			},
+			ValidatorSet: conflictingVals,
+		},
+		CommonHeight:        commonHeight,
+		TotalVotingPower:    20,
+		ByzantineValidators: commonVals.Validators,
+		Timestamp:           defaultEvidenceTime,
+	}
+
+	state := sm.State{
+		LastBlockTime:   defaultEvidenceTime.Add(2 * time.Hour),
+		LastBlockHeight: 11,
+		ConsensusParams: *types.DefaultConsensusParams(),
+	}
+	state.ConsensusParams.Evidence.MaxAgeNumBlocks = 5
+	state.ConsensusParams.Evidence.MaxAgeDuration = 3 * time.Hour
+
+	testCases := []struct {
+		basis      evidence.LightClientAttackExpiryBasis
+		expExpired bool
+	}{
+		// 14 - 4 > 5 blocks
+		{evidence.ExpireFromCommonHeight, true},
+		// 14 - 10 <= 5 blocks
+		{evidence.ExpireFromConflictingHeight, false},
+	}
+
+	for _, tc := range testCases {
+		stateStore := &smmocks.Store{}
+		stateStore.On("LoadValidators", commonHeight).Return(commonVals, nil)
+		stateStore.On("Load").Return(state, nil)
+		blockStore := &mocks.BlockStore{}
+		blockStore.On("LoadBlockMeta", commonHeight).Return(&types.BlockMeta{Header: *commonHeader})
+		blockStore.On("LoadBlockMeta", conflictingHeight).Return(&types.BlockMeta{Header: *trustedHeader})
+		blockStore.On("LoadBlockCommit", commonHeight).Return(commit)
+		blockStore.On("LoadBlockCommit", conflictingHeight).Return(trustedCommit)
+
+		pool, err := evidence.NewPool(log.TestingLogger(), dbm.NewMemDB(), stateStore, blockStore,
+			evidence.WithLightClientAttackExpiryBasis(tc.basis))
+		require.NoError(t, err)
+		require.NoError(t, pool.CheckEvidence(types.EvidenceList{ev}))
+		require.EqualValues(t, 1, pool.Size())
+
+		// the evidence is older than MaxAgeDuration and, depending on the basis,
+		// older than MaxAgeNumBlocks
+		newState := state
+		newState.LastBlockHeight = 14
+		newState.LastBlockTime = defaultEvidenceTime.Add(4 * time.Hour)
+		pool.Update(newState, types.EvidenceList{})
+
+		if tc.expExpired {
+			assert.EqualValues(t, 0, pool.Size())
+			continue
+		}
+		assert.EqualValues(t, 1, pool.Size())
+
+		// the evidence eventually expires relative to the conflicting height
+		newState.LastBlockHeight = conflictingHeight + 7
+		newState.LastBlockTime = defaultEvidenceTime.Add(5 * time.Hour)
+		pool.Update(newState, types.EvidenceList{})
+		assert.EqualValues(t, 0, pool.Size())
+	}
+}
+
+func TestValidatorSetCache(t *testing.T) {
+	var height int64 = 10
+	setA, _ := types.RandValidatorSet(1, 10)
+	setB, _ := types.RandValidatorSet(1, 10)
+
+	state := createState(height, setA)
+	state.NextValidators = setA
+	state.LastValidators = setA
+	stateStore := &smmocks.Store{}
+	stateStore.On("Load").Return(state, nil)
+	for _, h := range []int64{5, height + 2} {
+		stateStore.On("LoadValidators", h).Return(setA, nil).Once()
+		stateStore.On("LoadValidators", h).Return(setB, nil)
+	}
+
+	pool, err := evidence.NewPool(log.TestingLogger(), dbm.NewMemDB(), stateStore, &mocks.BlockStore{})
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		valSet, err := pool.LoadValidators(5)
+		require.NoError(t, err)
+		require.Equal(t, setA.Hash(), valSet.Hash())
+	}
+	stateStore.AssertNumberOfCalls(t, "LoadValidators", 1)
+
+	valSet, err := pool.LoadValidators(height + 2)
+	require.NoError(t, err)
+	require.Equal(t, setA.Hash(), valSet.Hash())
+
+	snapshot, err := pool.Snapshot()
+	require.NoError(t, err)
+
+	// the set of a height that isn't committed yet may change
+	pool.Update(createState(height+1, setA), types.EvidenceList{})
+	valSet, err = pool.LoadValidators(height + 2)
+	require.NoError(t, err)
+	require.Equal(t, setB.Hash(), valSet.Hash())
+	valSet, err = pool.LoadValidators(5)
+	require.NoError(t, err)
+	require.Equal(t, setA.Hash(), valSet.Hash())
+
+	// restoring a snapshot drops all cached sets
+	require.NoError(t, pool.Restore(snapshot))
+	valSet, err = pool.LoadValidators(5)
+	require.NoError(t, err)
+	require.Equal(t, setB.Hash(), valSet.Hash())
+}
+
+// countingStateStore counts how often validator sets are loaded.
+type countingStateStore struct {
+	sm.Store
+	loads int
+}
+
+func (s *countingStateStore) LoadValidators(height int64) (*types.ValidatorSet, error) {
+	s.loads++
+	return s.Store.LoadValidators(height)
+}
+
+func TestVerifyWithoutValidatorSet(t *testing.T) {
+	var height int64 = 10
+	val := types.NewMockPV()
+	stateStore := &prunedStateStore{Store: initializeValidatorState(t, val, height), retainHeight: height - 1}
+	state, err := stateStore.Load()
+	require.NoError(t, err)
+	blockStore := initializeBlockStore(dbm.NewMemDB(), state, val.PrivKey.PubKey().Address())
+	pool, err := evidence.NewPool(log.TestingLogger(), dbm.NewMemDB(), stateStore, blockStore)
+	require.NoError(t, err)
+
+	ev := newTestDuplicateVoteEvidence(height-2, val)
+	err = pool.AddEvidence(ev)
+	require.True(t, errors.Is(err, evidence.ErrNoValidatorSetForHeight), err)
+	_, isInvalid := err.(*types.ErrInvalidEvidence)
+	require.False(t, isInvalid)
+	require.EqualValues(t, 0, pool.Size())
+	require.False(t, pool.IsKnown(ev))
+
+	err = pool.CheckEvidence(types.EvidenceList{ev})
+	require.True(t, errors.Is(err, evidence.ErrNoValidatorSetForHeight), err)
+
+	// evidence from retained heights is unaffected
+	require.NoError(t, pool.AddEvidence(newTestDuplicateVoteEvidence(height-1, val)))
+}
+
+func TestQuarantine(t *testing.T) {
+	var height int64 = 10
+	val := types.NewMockPV()
+	stateStore := &prunedStateStore{Store: initializeValidatorState(t, val, height), retainHeight: height - 1}
+	state, err := stateStore.Load()
+	require.NoError(t, err)
+	blockStore := initializeBlockStore(dbm.NewMemDB(), state, val.PrivKey.PubKey().Address())
+	evidenceDB := dbm.NewMemDB()
+	pool, err := evidence.NewPool(log.TestingLogger(), evidenceDB, stateStore, blockStore)
+	require.NoError(t, err)
+
+	quarantined := func() int {
+		prefix, err := orderedcode.Append(nil, int64(18))
+		require.NoError(t, err)
+		iter, err := dbm.IteratePrefix(evidenceDB, prefix)
+		require.NoError(t, err)
+		defer iter.Close()
+		var n int
+		for ; iter.Valid(); iter.Next() {
+			n++
+		}
+		return n
+	}
+
+	// evidence from a validator that turns out not to be in the validator set
+	valid := newTestDuplicateVoteEvidence(height-2, val)
+	invalid := newTestDuplicateVoteEvidence(height-3, types.NewMockPV())
+	for _, ev := range []types.Evidence{valid, invalid} {
+		err := pool.AddEvidence(ev)
+		require.True(t, errors.Is(err, evidence.ErrNoValidatorSetForHeight), err)
+	}
+	// quarantining the same evidence again changes nothing
+	_, err = pool.AddEvidenceBatch([]types.Evidence{valid})
+	require.True(t, errors.Is(err, evidence.ErrNoValidatorSetForHeight), err)
+	require.EqualValues(t, 0, pool.Size())
+	require.Equal(t, 2, quarantined())
+
+	// the validator sets are still missing
+	require.NoError(t, pool.RetryQuarantined())
+	require.EqualValues(t, 0, pool.Size())
+	require.Equal(t, 2, quarantined())
+
+	// once they are available, the valid evidence is promoted by the next update
+	stateStore.retainHeight = 0
+	state.LastBlockHeight++
+	pool.Update(state, nil)
+	evList, _ := pool.PendingEvidence(-1)
+	require.Equal(t, []types.Evidence{valid}, evList)
+	require.Zero(t, quarantined())
+}
+
+func TestQuarantineIsNotRejection(t *testing.T) {
+	var height int64 = 10
+	val := types.NewMockPV()
+	stateStore := &prunedStateStore{Store: initializeValidatorState(t, val, height), retainHeight: height - 1}
+	state, err := stateStore.Load()
+	require.NoError(t, err)
+	blockStore := initializeBlockStore(dbm.NewMemDB(), state, val.PrivKey.PubKey().Address())
+	pool, err := evidence.NewPool(log.TestingLogger(), dbm.NewMemDB(), stateStore, blockStore)
+	require.NoError(t, err)
+
+	var rejected []types.Evidence
+	pool.SetOnInvalidEvidence(func(ev types.Evidence, reason error, source string) {
+		rejected = append(rejected, ev)
+	})
+	events, unsubscribe := pool.Subscribe(10)
+	defer unsubscribe()
+
+	evA, evB := newTestDuplicateVoteEvidence(height-2, val), newTestDuplicateVoteEvidence(height-3, val)
+	err = pool.AddEvidence(evA)
+	require.True(t, errors.Is(err, evidence.ErrNoValidatorSetForHeight), err)
+	_, err = pool.AddEvidenceBatch([]types.Evidence{evA, evB})
+	require.True(t, errors.Is(err, evidence.ErrNoValidatorSetForHeight), err)
+	require.EqualValues(t, 2, pool.QuarantineSize())
+	require.Empty(t, rejected)
+
+	// the only events are those of the evidence being added once it's verified
+	stateStore.retainHeight = 0
+	state.LastBlockHeight++
+	pool.Update(state, nil)
+	require.EqualValues(t, 2, pool.Size())
+	for i := 0; i < 2; i++ {
+		require.Equal(t, evidence.TransitionAdded, (<-events).Transition)
+	}
+	select {
+	case event := <-events:
+		t.Fatalf("unexpected event %v", event)
+	default:
+	}
+	require.Empty(t, rejected)
+}
+
+func TestQuarantineExpiry(t *testing.T) {
+	var height int64 = 10
+	val := types.NewMockPV()
+	stateStore := &prunedStateStore{Store: initializeValidatorState(t, val, height), retainHeight: height - 1}
+	state, err := stateStore.Load()
+	require.NoError(t, err)
+	blockStore := initializeBlockStore(dbm.NewMemDB(), state, val.PrivKey.PubKey().Address())
+	pool, err := evidence.NewPool(log.TestingLogger(), dbm.NewMemDB(), stateStore, blockStore)
+	require.NoError(t, err)
+
+	ev := newTestDuplicateVoteEvidence(height-2, val)
+	err = pool.AddEvidence(ev)
+	require.True(t, errors.Is(err, evidence.ErrNoValidatorSetForHeight), err)
+	require.EqualValues(t, 1, pool.QuarantineSize())
+
+	// quarantined evidence is kept for MaxAgeNumBlocks, even if it hasn't
+	// expired in time
+	state.LastBlockHeight = ev.Height() + state.ConsensusParams.Evidence.MaxAgeNumBlocks
+	pool.Update(state, nil)
+	require.EqualValues(t, 1, pool.QuarantineSize())
+	state.LastBlockHeight++
+	pool.Update(state, nil)
+	require.Zero(t, pool.QuarantineSize())
+}
+
+func TestQuarantineFlood(t *testing.T) {
+	var height int64 = 10
+	val := types.NewMockPV()
+	stateStore := initializeValidatorState(t, val, height)
+	state, err := stateStore.Load()
+	require.NoError(t, err)
+	nextState := state.Copy()
+	nextState.LastBlockHeight += 2
+	blockStore := &partialBlockStore{
+		BlockStore: initializeBlockStore(dbm.NewMemDB(), nextState, val.PrivKey.PubKey().Address()),
+		height:     height,
+	}
+	pool, err := evidence.NewPool(log.TestingLogger(), dbm.NewMemDB(), stateStore, blockStore)
+	require.NoError(t, err)
+
+	// a peer floods the pool with evidence from far ahead, with evidence
+	// signed by validators that aren't in the validator set and with evidence
+	// whose signatures are forged
+	var flood []types.Evidence
+	for i := int64(0); i < 100; i++ {
+		flood = append(flood,
+			types.NewMockDuplicateVoteEvidenceWithValidator(math.MaxInt64-i, defaultEvidenceTime, val, evidenceChainID),
+			newTestDuplicateVoteEvidence(height+1, types.NewMockPV()))
+		forged := newTestDuplicateVoteEvidence(height+2, val)
+		forged.VoteB.Signature = forged.VoteA.Signature
+		flood = append(flood, forged)
+	}
+	for _, ev := range flood {
+		err := pool.AddEvidence(ev)
+		require.Error(t, err)
+		if ev.Height() <= height+evidence.MaxFutureEvidenceHeights {
+			_, isInvalid := err.(*types.ErrInvalidEvidence)
+			require.True(t, isInvalid, err)
+		}
+	}
+	_, err = pool.AddEvidenceBatch(flood)
+	require.Error(t, err)
+	require.Zero(t, pool.QuarantineSize())
+
+	// evidence from the next heights that is correctly signed is quarantined
+	for h := height + 1; h <= height+evidence.MaxFutureEvidenceHeights; h++ {
+		err := pool.AddEvidence(newTestDuplicateVoteEvidence(h, val))
+		require.True(t, errors.Is(err, evidence.ErrFutureEvidence), err)
+	}
+	require.EqualValues(t, evidence.MaxFutureEvidenceHeights, pool.QuarantineSize())
+}
+
+func TestVerifyFutureEvidence(t *testing.T) {
+	var height int64 = 10
+	val := types.NewMockPV()
+	stateStore := initializeValidatorState(t, val, height)
+	state, err := stateStore.Load()
+	require.NoError(t, err)
+	// the block store doesn't have the next block yet
+	nextState := state.Copy()
+	nextState.LastBlockHeight++
+	nextState.LastBlockTime = nextState.LastBlockTime.Add(time.Minute)
+	blockStore := &partialBlockStore{
+		BlockStore: initializeBlockStore(dbm.NewMemDB(), nextState, val.PrivKey.PubKey().Address()),
+		height:     height,
+	}
+	evidenceDB := dbm.NewMemDB()
+	pool, err := evidence.NewPool(log.TestingLogger(), evidenceDB, stateStore, blockStore)
+	require.NoError(t, err)
+
+	quarantined := func() int {
+		prefix, err := orderedcode.Append(nil, int64(18))
+		require.NoError(t, err)
+		iter, err := dbm.IteratePrefix(evidenceDB, prefix)
+		require.NoError(t, err)
+		defer iter.Close()
+		var n int
+		for ; iter.Valid(); iter.Next() {
+			n++
+		}
+		return n
+	}
+
+	// evidence from a height that isn't committed yet is quarantined
+	futureHeightEv := newTestDuplicateVoteEvidence(height+1, val)
+	err = pool.AddEvidence(futureHeightEv)
+	require.True(t, errors.Is(err, evidence.ErrFutureEvidence), err)
+	_, isInvalid := err.(*types.ErrInvalidEvidence)
+	require.False(t, isInvalid)
+	require.EqualValues(t, 0, pool.Size())
+	require.Equal(t, 1, quarantined())
+	err = pool.CheckEvidence(types.EvidenceList{futureHeightEv})
+	require.True(t, errors.Is(err, evidence.ErrFutureEvidence), err)
+
+	// evidence from too far ahead is rejected, whether or not its block exists
+	err = pool.AddEvidence(newTestDuplicateVoteEvidence(height+3, val))
+	require.True(t, errors.Is(err, evidence.ErrFutureEvidence), err)
+	require.Equal(t, 1, quarantined())
+
+	// evidence from a time ahead of the last block time is rejected, allowing
+	// for some skew
+	lateEv := types.NewMockDuplicateVoteEvidenceWithValidator(height-1, state.LastBlockTime.Add(time.Minute), val,
+		evidenceChainID)
+	err = pool.AddEvidence(lateEv)
+	require.True(t, errors.Is(err, evidence.ErrFutureEvidence), err)
+	lateEv = types.NewMockDuplicateVoteEvidenceWithValidator(height-1, state.LastBlockTime.Add(time.Second), val,
+		evidenceChainID)
+	err = pool.AddEvidence(lateEv)
+	require.False(t, errors.Is(err, evidence.ErrFutureEvidence), err)
+	ev := newTestDuplicateVoteEvidence(height-1, val)
+	require.NoError(t, pool.AddEvidence(ev))
+
+	// the evidence from the future height is added once its block is committed
+	blockStore.height++
+	pool.Update(nextState, nil)
+	evList, _ := pool.PendingEvidence(-1)
+	require.Equal(t, []types.Evidence{ev, futureHeightEv}, evList)
+	require.Zero(t, quarantined())
+}
+
+// prunedStateStore has no validator sets below retainHeight.
+type prunedStateStore struct {
+	sm.Store
+	retainHeight int64
+}
+
+func (s *prunedStateStore) LoadValidators(height int64) (*types.ValidatorSet, error) {
+	if height < s.retainHeight {
+		return nil, sm.ErrNoValSetForHeight{Height: height}
+	}
+	return s.Store.LoadValidators(height)
+}
+
+// partialBlockStore has no blocks above height.
+type partialBlockStore struct {
+	*store.BlockStore
+	height int64
+}
+
+func (bs *partialBlockStore) LoadBlockMeta(height int64) *types.BlockMeta {
+	if height > bs.height {
+		return nil
+	}
+	return bs.BlockStore.LoadBlockMeta(height)
+}
+
+func (bs *partialBlockStore) LoadBlockCommit(height int64) *types.Commit {
+	if height > bs.height {
+		return nil
+	}
+	return bs.BlockStore.LoadBlockCommit(height)
+}
+
+func BenchmarkCheckEvidenceValidatorSetLoads(b *testing.B) {
+	var height int64 = 10
+
+	for _, cacheSize := range []int{0, 100} {
+		b.Run(fmt.Sprintf("cache_size=%d", cacheSize), func(b *testing.B) {
+			val := types.NewMockPV()
+			stateStore := &countingStateStore{Store: initializeValidatorState(b, val, height)}
+			state, err := stateStore.Load()
+			require.NoError(b, err)
+			blockStore := initializeBlockStore(dbm.NewMemDB(), state, val.PrivKey.PubKey().Address())
+			pool, err := evidence.NewPool(log.NewNopLogger(), dbm.NewMemDB(), stateStore, blockStore,
+				evidence.WithValidatorSetCacheSize(cacheSize))
+			require.NoError(b, err)
+
+			evs := make([]types.EvidenceList, b.N)
+			for i := range evs {
+				evs[i] = types.EvidenceList{newTestDuplicateVoteEvidence(height, val)}
+			}
+
+			b.ResetTimer()
+			for _, evList := range evs {
+				if err := pool.CheckEvidence(evList); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(stateStore.loads)/float64(b.N), "loads/op")
+		})
+	}
+}
+
 func TestVerifyLightClientAttack_Equivocation(t *testing.T) {
 	conflictingVals, conflictingPrivVals := types.RandValidatorSet(5, 10)
 	trustedHeader := makeHeaderRandom(10)
@@ -383,6 +870,147 @@ func TestVerifyDuplicateVoteEvidence(t *testing.T) {
 	assert.Error(t, err)
 }
 
+type fakeValidatorSetProvider struct {
+	valSet *types.ValidatorSet
+	err    error
+}
+
+func (p *fakeValidatorSetProvider) LoadValidators(int64) (*types.ValidatorSet, error) {
+	return p.valSet, p.err
+}
+
+func TestVerifyWithSecondaryValidatorSetProvider(t *testing.T) {
+	var height int64 = 10
+
+	provider := &fakeValidatorSetProvider{}
+	pool, val := defaultTestPool(t, height, evidence.WithSecondaryValidatorSetProvider(provider))
+
+	// both providers agree -> evidence is accepted
+	provider.valSet = pool.State().Validators
+	require.NoError(t, pool.AddEvidence(newTestDuplicateVoteEvidence(height, val)))
+
+	// providers disagree -> evidence is rejected with a mismatch error
+	otherVals, _ := types.RandValidatorSet(1, 10)
+	provider.valSet = otherVals
+	err := pool.AddEvidence(newTestDuplicateVoteEvidence(height-1, val))
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, evidence.ErrValidatorSetMismatch))
+
+	// the secondary provider fails -> evidence is not verified but the sender
+	// is not treated as byzantine
+	provider.valSet, provider.err = nil, errors.New("provider offline")
+	err = pool.AddEvidence(newTestDuplicateVoteEvidence(height-2, val))
+	require.Error(t, err)
+	assert.False(t, errors.Is(err, evidence.ErrValidatorSetMismatch))
+	_, isInvalid := err.(*types.ErrInvalidEvidence)
+	assert.False(t, isInvalid)
+
+	evList, _ := pool.PendingEvidence(defaultEvidenceMaxBytes)
+	assert.Len(t, evList, 1)
+}
+
+// verifierFunc is a Verifier backed by a function.
+type verifierFunc func(types.Evidence, sm.State) error
+
+func (f verifierFunc) Verify(ev types.Evidence, state sm.State) error { return f(ev, state) }
+
+func TestWithVerifier(t *testing.T) {
+	var height int64 = 10
+	errRejected := errors.New("rejected by verifier")
+	var verified []types.Evidence
+	pool, val := defaultTestPool(t, height, evidence.WithVerifier(verifierFunc(
+		func(ev types.Evidence, state sm.State) error {
+			require.Equal(t, height, state.LastBlockHeight)
+			verified = append(verified, ev)
+			return errRejected
+		})))
+
+	ev := newTestDuplicateVoteEvidence(height, val)
+	require.Equal(t, errRejected, pool.AddEvidence(ev))
+	require.Equal(t, errRejected, pool.CheckEvidence(types.EvidenceList{ev}))
+	require.Equal(t, []types.Evidence{ev, ev}, verified)
+	require.EqualValues(t, 0, pool.Size())
+
+	// evidence the built-in verification would reject is accepted
+	pool, val = defaultTestPool(t, height, evidence.WithVerifier(verifierFunc(
+		func(types.Evidence, sm.State) error { return nil })))
+	ev = types.NewMockDuplicateVoteEvidenceWithValidator(height, defaultEvidenceTime.Add(time.Second), val,
+		evidenceChainID)
+	require.NoError(t, pool.AddEvidence(ev))
+	require.EqualValues(t, 1, pool.Size())
+}
+
+func TestOnInvalidEvidence(t *testing.T) {
+	var height int64 = 10
+	errRejected := types.NewErrInvalidEvidence(nil, errors.New("rejected by verifier"))
+	pool, val := defaultTestPool(t, height, evidence.WithVerifier(verifierFunc(
+		func(types.Evidence, sm.State) error { return errRejected })))
+
+	type rejection struct {
+		ev     types.Evidence
+		reason error
+		source string
+	}
+	var rejections []rejection
+	pool.SetOnInvalidEvidence(func(ev types.Evidence, reason error, source string) {
+		// the callback may use the pool
+		require.Equal(t, height, pool.State().LastBlockHeight)
+		rejections = append(rejections, rejection{ev, reason, source})
+	})
+
+	evA, evB, evC := newTestDuplicateVoteEvidence(height, val), newTestDuplicateVoteEvidence(height-1, val),
+		newTestDuplicateVoteEvidence(height-2, val)
+	require.Equal(t, errRejected, pool.AddEvidence(evA))
+	_, err := pool.AddEvidenceBatch([]types.Evidence{evB})
+	require.Equal(t, errRejected, err)
+	require.Equal(t, errRejected, pool.CheckEvidence(types.EvidenceList{evC}))
+
+	require.Equal(t, []rejection{
+		{evA, errRejected, evidence.EvidenceSourceGossip},
+		{evB, errRejected, evidence.EvidenceSourceGossip},
+		{evC, errRejected, evidence.EvidenceSourceBlock},
+	}, rejections)
+
+	// the callback can be removed
+	pool.SetOnInvalidEvidence(nil)
+	require.Equal(t, errRejected, pool.AddEvidence(evA))
+	require.Len(t, rejections, 3)
+}
+
+func TestVerificationConcurrency(t *testing.T) {
+	var (
+		height            int64 = 10
+		active, maxActive int32
+	)
+	pool, val := defaultTestPool(t, height, evidence.WithVerificationConcurrency(1), evidence.WithVerifier(verifierFunc(
+		func(types.Evidence, sm.State) error {
+			n := atomic.AddInt32(&active, 1)
+			defer atomic.AddInt32(&active, -1)
+			for {
+				max := atomic.LoadInt32(&maxActive)
+				if n <= max || atomic.CompareAndSwapInt32(&maxActive, max, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			return nil
+		})))
+
+	var wg sync.WaitGroup
+	for h := int64(1); h <= height; h++ {
+		ev := newTestDuplicateVoteEvidence(h, val)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, pool.AddEvidence(ev))
+		}()
+	}
+	wg.Wait()
+
+	require.EqualValues(t, 1, maxActive)
+	require.EqualValues(t, height, pool.Size())
+}
+
 func makeVote(
 	t *testing.T, val types.PrivValidator, chainID string, valIndex int32, height int64,
 	round int32, step int, blockID types.BlockID, time time.Time) *types.Vote {
@@ -0,0 +1,175 @@
+package evidence
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/google/orderedcode"
+	dbm "github.com/tendermint/tm-db"
+
+	"github.com/tendermint/tendermint/crypto/tmhash"
+	tmproto "github.com/tendermint/tendermint/proto/tendermint/types"
+	sm "github.com/tendermint/tendermint/state"
+	"github.com/tendermint/tendermint/types"
+)
+
+// defaultMaxConsensusBufferSize is the number of conflicting vote pairs from
+// consensus buffered until the next height by default.
+const defaultMaxConsensusBufferSize = 1000
+
+// AddDuplicateVote forms DuplicateVoteEvidence from two conflicting votes of a
+// committed height, using the validator set and block time at that height, and
+// adds it like AddEvidence. Unlike with ReportConflictingVotes, the evidence is
+// verified and added right away.
+func (evpool *Pool) AddDuplicateVote(voteA, voteB *types.Vote) error {
+	if evpool.readOnly {
+		return ErrReadOnly
+	}
+	if voteA == nil || voteB == nil {
+		return errors.New("missing vote")
+	}
+
+	height := voteA.Height
+	blockMeta := evpool.blockStore.LoadBlockMeta(height)
+	if blockMeta == nil {
+		return fmt.Errorf("failed to form evidence; missing block for height %d", height)
+	}
+	valSet, err := evpool.loadValidators(height)
+	if err != nil {
+		return fmt.Errorf("failed to form evidence: %w", err)
+	}
+
+	ev := types.NewDuplicateVoteEvidence(voteA, voteB, blockMeta.Header.Time, valSet)
+	if ev == nil {
+		return fmt.Errorf("failed to form evidence; %X was not a validator at height %d",
+			voteA.ValidatorAddress, height)
+	}
+	return evpool.AddEvidence(ev)
+}
+
+// Flush forms evidence from the conflicting votes buffered from consensus for
+// committed heights and adds it to the pending pool right away, rather than
+// with the next Update, for example when the node is stopped between heights.
+// This bypasses waiting one height before evidence from consensus is gossiped
+// and proposed, so it should only be used at shutdown and in tests. The votes
+// of the height in progress stay buffered, as their evidence needs its block
+// time.
+func (evpool *Pool) Flush() {
+	evpool.processCommittedVotes(evpool.State())
+}
+
+// processCommittedVotes forms evidence from the buffered votes of heights
+// committed in the given state. The votes of later heights stay buffered and
+// are returned.
+func (evpool *Pool) processCommittedVotes(state sm.State) []duplicateVoteSet {
+	evpool.mtx.Lock()
+	defer evpool.mtx.Unlock()
+	later := make([]duplicateVoteSet, 0)
+	for _, voteSet := range evpool.consensusBuffer {
+		if voteSet.VoteA.Height <= state.LastBlockHeight {
+			evpool.addEvidenceFromVotes(voteSet, state)
+		} else {
+			later = append(later, voteSet)
+		}
+	}
+	evpool.consensusBuffer = later
+	evpool.metrics.ConsensusBufferSize.Set(float64(len(later)))
+	return later
+}
+
+// flushConsensusBuffer forms evidence from the buffered votes of committed
+// heights and persists the remaining votes.
+func (evpool *Pool) flushConsensusBuffer() error {
+	later := evpool.processCommittedVotes(evpool.State())
+	if len(later) == 0 {
+		return nil
+	}
+
+	batch := evpool.evidenceStore.NewBatch()
+	defer batch.Close()
+	for _, voteSet := range later {
+		key, value, err := voteSet.entry()
+		if err != nil {
+			return err
+		}
+		if err := batch.Set(key, value); err != nil {
+			return err
+		}
+	}
+	if err := batch.WriteSync(); err != nil {
+		return fmt.Errorf("failed to persist consensus buffer: %w", err)
+	}
+	return nil
+}
+
+// loadConsensusBuffer buffers the conflicting votes persisted by Close again
+// and removes them from the store.
+func (evpool *Pool) loadConsensusBuffer() error {
+	iter, err := dbm.IteratePrefix(evpool.evidenceStore, prefixToBytes(prefixVotes))
+	if err != nil {
+		return fmt.Errorf("database error: %v", err)
+	}
+	defer iter.Close()
+
+	batch := evpool.evidenceStore.NewBatch()
+	defer batch.Close()
+
+	var loaded int
+	for ; iter.Valid(); iter.Next() {
+		loaded++
+		var pb tmproto.DuplicateVoteEvidence
+		if err := pb.Unmarshal(iter.Value()); err != nil {
+			return fmt.Errorf("failed to decode buffered votes: %w", err)
+		}
+		voteA, err := types.VoteFromProto(pb.VoteA)
+		if err != nil {
+			return fmt.Errorf("failed to decode buffered votes: %w", err)
+		}
+		voteB, err := types.VoteFromProto(pb.VoteB)
+		if err != nil {
+			return fmt.Errorf("failed to decode buffered votes: %w", err)
+		}
+		evpool.ReportConflictingVotes(voteA, voteB)
+
+		if err := batch.Delete(iter.Key()); err != nil {
+			return err
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	if loaded == 0 {
+		return nil
+	}
+
+	return batch.WriteSync()
+}
+
+// entry returns the key and value under which the votes are persisted.
+func (set duplicateVoteSet) entry() ([]byte, []byte, error) {
+	pb := tmproto.DuplicateVoteEvidence{VoteA: set.VoteA.ToProto(), VoteB: set.VoteB.ToProto()}
+	value, err := pb.Marshal()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal votes: %w", err)
+	}
+	key, err := orderedcode.Append(nil, prefixVotes, set.VoteA.Height, string(tmhash.Sum(value)))
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, value, nil
+}
+
+// sameVotes returns true if both sets consist of the same conflicting votes, in
+// any order, and would thus form the same evidence.
+func (set duplicateVoteSet) sameVotes(other duplicateVoteSet) bool {
+	a, b := set.VoteA, set.VoteB
+	if a.Height != other.VoteA.Height || a.Round != other.VoteA.Round || a.Type != other.VoteA.Type ||
+		!bytes.Equal(a.ValidatorAddress, other.VoteA.ValidatorAddress) {
+		return false
+	}
+	if !a.BlockID.Equals(other.VoteA.BlockID) {
+		a, b = b, a
+	}
+	return a.BlockID.Equals(other.VoteA.BlockID) && b.BlockID.Equals(other.VoteB.BlockID)
+}
@@ -362,6 +362,7 @@ func createEvidenceReactor(
 	dbProvider DBProvider,
 	stateDB dbm.DB,
 	blockStore *store.BlockStore,
+	chainID string,
 	logger log.Logger,
 ) (*p2p.ReactorShim, *evidence.Reactor, *evidence.Pool, error) {
 	evidenceDB, err := dbProvider(&DBContext{"evidence", config})
@@ -371,7 +372,13 @@ func createEvidenceReactor(
 
 	logger = logger.With("module", "evidence")
 
-	evidencePool, err := evidence.NewPool(logger, evidenceDB, sm.NewStore(stateDB), blockStore)
+	metrics := evidence.NopMetrics()
+	if config.Instrumentation.Prometheus {
+		metrics = evidence.PrometheusMetrics(config.Instrumentation.Namespace, "chain_id", chainID)
+	}
+
+	evidencePool, err := evidence.NewPool(logger, evidenceDB, sm.NewStore(stateDB), blockStore,
+		evidence.WithMetrics(metrics))
 	if err != nil {
 		return nil, nil, nil, err
 	}
@@ -766,10 +773,22 @@ func NewNode(config *cfg.Config,
 	csMetrics, p2pMetrics, memplMetrics, smMetrics := metricsProvider(genDoc.ChainID)
 	mpReactorShim, mpReactor, mempool := createMempoolReactor(config, proxyApp, state, memplMetrics, peerMgr, logger)
 
-	evReactorShim, evReactor, evPool, err := createEvidenceReactor(config, dbProvider, stateDB, blockStore, logger)
+	evReactorShim, evReactor, evPool, err := createEvidenceReactor(
+		config, dbProvider, stateDB, blockStore, genDoc.ChainID, logger,
+	)
 	if err != nil {
 		return nil, err
 	}
+	// close the evidence pool if the node can't be created, so that it doesn't
+	// keep the evidence store registered as open
+	created := false
+	defer func() {
+		if !created {
+			if err := evPool.Close(); err != nil {
+				logger.Error("failed to close evidence pool", "err", err)
+			}
+		}
+	}()
 
 	// make block executor for consensus and blockchain reactors to execute blocks
 	blockExec := sm.NewBlockExecutor(
@@ -914,6 +933,7 @@ func NewNode(config *cfg.Config,
 		option(node)
 	}
 
+	created = true
 	return node, nil
 }
 
@@ -1054,6 +1074,11 @@ func (n *Node) OnStop() {
 		n.Logger.Error("failed to stop the evidence reactor", "err", err)
 	}
 
+	// flush the conflicting votes buffered by the evidence pool
+	if err := n.evidencePool.Close(); err != nil {
+		n.Logger.Error("failed to close the evidence pool", "err", err)
+	}
+
 	// stop mempool WAL
 	if n.config.Mempool.WalEnabled() {
 		n.mempool.CloseWAL()
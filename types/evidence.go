@@ -518,6 +518,11 @@ func (err *ErrInvalidEvidence) Error() string {
 	return fmt.Sprintf("Invalid evidence: %v. Evidence: %v", err.Reason, err.Evidence)
 }
 
+// Unwrap returns the reason the evidence is invalid.
+func (err *ErrInvalidEvidence) Unwrap() error {
+	return err.Reason
+}
+
 // ErrEvidenceOverflow is for when there the amount of evidence exceeds the max bytes.
 type ErrEvidenceOverflow struct {
 	Max int64